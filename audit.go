@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/skeema/tengo"
+)
+
+// AuditEntry represents a single DDL statement or external command executed by
+// `skeema push`.
+type AuditEntry struct {
+	Time        time.Time `json:"timestamp"`
+	PushID      string    `json:"push_id"`
+	OSUser      string    `json:"os_user"`
+	Environment string    `json:"environment"`
+	Instance    string    `json:"instance"`
+	Schema      string    `json:"schema"`
+	Table       string    `json:"table,omitempty"`
+	Statement   string    `json:"statement"`
+	Wrapper     bool      `json:"wrapper"`
+	GitCommit   string    `json:"git_commit,omitempty"`
+	Duration    float64   `json:"duration_seconds"`
+	Result      string    `json:"result"` // "success" or "error"
+	Error       string    `json:"error,omitempty"`
+	Output      string    `json:"output,omitempty"` // external command output; audit-log only
+}
+
+// Auditor records AuditEntries to the destinations configured by the
+// audit-log, audit-table, and history-schema options. It is safe for use by
+// multiple goroutines.
+type Auditor struct {
+	environment string
+	osUser      string
+	pushID      string
+	prepared    map[string]bool   // audit-log paths and instance-specific table names that are known to be usable
+	gitCommits  map[string]string // dir path -> git commit of HEAD, or empty string if not in a git repo
+	*sync.Mutex
+}
+
+// NewAuditor returns an Auditor which records entries for the supplied
+// environment name.
+func NewAuditor(environment string) *Auditor {
+	osUser := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		osUser = u.Username
+	}
+	return &Auditor{
+		environment: environment,
+		osUser:      osUser,
+		pushID:      newPushID(),
+		prepared:    make(map[string]bool),
+		gitCommits:  make(map[string]string),
+		Mutex:       new(sync.Mutex),
+	}
+}
+
+// Prepare verifies that the audit destinations configured for t are usable,
+// creating the audit-table and history table on t's instance if they do not
+// already exist. It should be called prior to executing any DDL for t, so that
+// DDL is not executed if it cannot be audited.
+func (a *Auditor) Prepare(t *Target) error {
+	// The lock is only held while accessing a.prepared, so that preparing one
+	// instance does not block other instances. Concurrent preparation of the
+	// same destination is harmless, since each step is idempotent.
+	if logPath := t.Dir.optionPath("audit-log"); logPath != "" && !a.isPrepared(logPath) {
+		f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("Unable to open audit-log: %s", err)
+		}
+		f.Close()
+		a.setPrepared(logPath)
+	}
+	if tableName := t.Dir.Config.Get("audit-table"); tableName != "" && !a.isPrepared(t.Instance.String()+" "+tableName) {
+		escapedName, err := qualifiedTableName("audit-table", tableName)
+		if err != nil {
+			return err
+		}
+		db, err := t.Instance.Connect("", "")
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec(fmt.Sprintf(auditTableCreate, escapedName)); err != nil {
+			return fmt.Errorf("Unable to create audit-table %s on %s: %s", tableName, t.Instance, err)
+		}
+		a.setPrepared(t.Instance.String() + " " + tableName)
+	}
+	if historySchema := t.Dir.Config.Get("history-schema"); historySchema != "" && !a.isPrepared(t.Instance.String()+" "+historySchema) {
+		if err := prepareHistoryTable(t.Instance, historySchema); err != nil {
+			return fmt.Errorf("Unable to create history table in schema %s on %s: %s", historySchema, t.Instance, err)
+		}
+		a.setPrepared(t.Instance.String() + " " + historySchema)
+	}
+	return nil
+}
+
+func (a *Auditor) isPrepared(key string) bool {
+	a.Lock()
+	defer a.Unlock()
+	return a.prepared[key]
+}
+
+func (a *Auditor) setPrepared(key string) {
+	a.Lock()
+	defer a.Unlock()
+	a.prepared[key] = true
+}
+
+// RecordDDL records the execution of ddl, which affected the named table of t
+// and took the supplied duration.
+func (a *Auditor) RecordDDL(t *Target, tableName string, ddl *DDLStatement, duration time.Duration) error {
+	statement := ddl.stmt
+	if ddl.IsShellOut() {
+		// The printable form of the command masks any {PASSWORDX} variable
+		statement = ddl.shellOut.String()
+	}
+	return a.record(t, tableName, statement, ddl.IsShellOut(), ddl.Output(), duration, ddl.Err)
+}
+
+// RecordSchemaDDL records the execution of a schema-level statement (CREATE
+// DATABASE or ALTER DATABASE) for t, which took the supplied duration and
+// resulted in err.
+func (a *Auditor) RecordSchemaDDL(t *Target, statement string, duration time.Duration, err error) error {
+	return a.record(t, "", statement, false, "", duration, err)
+}
+
+func (a *Auditor) record(t *Target, tableName, statement string, wrapper bool, output string, duration time.Duration, execErr error) error {
+	logPath := t.Dir.optionPath("audit-log")
+	auditTable := t.Dir.Config.Get("audit-table")
+	historySchema := t.Dir.Config.Get("history-schema")
+	if logPath == "" && auditTable == "" && historySchema == "" {
+		return nil
+	}
+
+	entry := AuditEntry{
+		Time:        time.Now().UTC(),
+		PushID:      a.pushID,
+		OSUser:      a.osUser,
+		Environment: a.environment,
+		Instance:    t.Instance.String(),
+		Schema:      t.SchemaFromDir.Name,
+		Table:       tableName,
+		Statement:   statement,
+		Wrapper:     wrapper,
+		Output:      output,
+		Duration:    duration.Seconds(),
+		Result:      "success",
+	}
+	if execErr != nil {
+		entry.Result = "error"
+		entry.Error = execErr.Error()
+	}
+
+	entry.GitCommit = a.gitCommit(t.Dir.Path)
+	if logPath != "" {
+		// Serialize appends, so that concurrent entries are never interleaved
+		a.Lock()
+		err := appendAuditLog(logPath, entry)
+		a.Unlock()
+		if err != nil {
+			return fmt.Errorf("Unable to write to audit-log %s: %s", logPath, err)
+		}
+	}
+
+	// Database writes occur without holding the lock, so that a slow or
+	// unresponsive instance does not block recording for other instances
+	if auditTable != "" {
+		if err := insertAuditRow(t.Instance, auditTable, entry); err != nil {
+			return fmt.Errorf("Unable to insert into audit-table %s on %s: %s", auditTable, t.Instance, err)
+		}
+	}
+	if historySchema != "" {
+		if err := insertHistoryRow(t.Instance, historySchema, entry); err != nil {
+			return fmt.Errorf("Unable to insert into history table in schema %s on %s: %s", historySchema, t.Instance, err)
+		}
+	}
+	return nil
+}
+
+// gitCommit returns the git commit of HEAD for dirPath, caching the result.
+func (a *Auditor) gitCommit(dirPath string) string {
+	a.Lock()
+	commit, ok := a.gitCommits[dirPath]
+	a.Unlock()
+	if !ok {
+		commit = gitCommit(dirPath)
+		a.Lock()
+		a.gitCommits[dirPath] = commit
+		a.Unlock()
+	}
+	return commit
+}
+
+// appendAuditLog writes entry to the file at path, as a single line of JSON.
+func appendAuditLog(path string, entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+const auditTableCreate = `CREATE TABLE IF NOT EXISTS %s (
+  id bigint unsigned NOT NULL AUTO_INCREMENT,
+  executed_at datetime NOT NULL,
+  os_user varchar(128) NOT NULL,
+  environment varchar(128) NOT NULL,
+  instance varchar(255) NOT NULL,
+  schema_name varchar(64) NOT NULL,
+  table_name varchar(64) NOT NULL,
+  statement mediumtext NOT NULL,
+  wrapper tinyint(1) NOT NULL,
+  duration_seconds decimal(12,3) NOT NULL,
+  result varchar(16) NOT NULL,
+  error text,
+  PRIMARY KEY (id),
+  KEY executed_at (executed_at)
+)`
+
+// insertAuditRow inserts entry into the named audit table on instance. The
+// table must have already been created by Auditor.Prepare.
+func insertAuditRow(instance *tengo.Instance, tableName string, entry AuditEntry) error {
+	escapedName, err := qualifiedTableName("audit-table", tableName)
+	if err != nil {
+		return err
+	}
+	db, err := instance.Connect("", "")
+	if err != nil {
+		return err
+	}
+	var errText interface{}
+	if entry.Error != "" {
+		errText = entry.Error
+	}
+	query := fmt.Sprintf(`INSERT INTO %s
+		(executed_at, os_user, environment, instance, schema_name, table_name, statement, wrapper, duration_seconds, result, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, escapedName)
+	_, err = db.Exec(query,
+		entry.Time.Format("2006-01-02 15:04:05"), entry.OSUser, entry.Environment, entry.Instance,
+		entry.Schema, entry.Table, entry.Statement, entry.Wrapper, entry.Duration, entry.Result, errText)
+	return err
+}
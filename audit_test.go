@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skeema/tengo"
+)
+
+func TestAuditorRecordDDL(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "skeematest")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	logPath := filepath.Join(tempDir, "audit.log")
+
+	inst, err := tengo.NewInstance("mysql", "root:s3cret@tcp(127.0.0.1:3306)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	target := &Target{
+		Dir: &Dir{
+			Path:   tempDir,
+			Config: getConfig(map[string]string{"audit-log": logPath, "audit-table": "", "history-schema": ""}),
+		},
+		Instance:      inst,
+		SchemaFromDir: &tengo.Schema{Name: "product"},
+	}
+	auditor := NewAuditor("production")
+	if err := auditor.Prepare(target); err != nil {
+		t.Fatalf("Unexpected error from Prepare: %s", err)
+	}
+	ddl := &DDLStatement{
+		shellOut: NewShellOut("/bin/echo --password=s3cret", "/bin/echo --password=XXXXXX"),
+		Err:      errors.New("exit status 1"),
+	}
+	if err := auditor.RecordDDL(target, "widgets", ddl, 1500*time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error from RecordDDL: %s", err)
+	}
+	if err := auditor.RecordSchemaDDL(target, "CREATE DATABASE `product`", time.Second, nil); err != nil {
+		t.Fatalf("Unexpected error from RecordSchemaDDL: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Unable to read audit log: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected audit log to have 2 lines, instead found %d", len(lines))
+	}
+	var entries [2]AuditEntry
+	for n := range lines {
+		if err := json.Unmarshal([]byte(lines[n]), &entries[n]); err != nil {
+			t.Fatalf("Unable to decode audit log line %q: %s", lines[n], err)
+		}
+	}
+	if e := entries[0]; e.Environment != "production" || e.Schema != "product" || e.Table != "widgets" || !e.Wrapper || e.Statement != "/bin/echo --password=XXXXXX" || e.Duration != 1.5 || e.Result != "error" || e.Error != "exit status 1" {
+		t.Errorf("Unexpected contents for first audit entry: %+v", e)
+	}
+	if e := entries[1]; e.Table != "" || e.Wrapper || e.Statement != "CREATE DATABASE `product`" || e.Result != "success" || e.Error != "" {
+		t.Errorf("Unexpected contents for second audit entry: %+v", e)
+	}
+}
+
+func TestAuditorConcurrent(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "skeematest")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	logPath := filepath.Join(tempDir, "audit.log")
+
+	auditor := NewAuditor("production")
+	var wg sync.WaitGroup
+	for n := 0; n < 8; n++ {
+		// NewInstance does not connect; these instances are only used as labels
+		inst, err := tengo.NewInstance("mysql", fmt.Sprintf("root:@tcp(127.0.0.1:%d)/", 3306+n))
+		if err != nil {
+			t.Fatalf("Unable to create instance: %s", err)
+		}
+		target := &Target{
+			Dir: &Dir{
+				Path:   tempDir,
+				Config: getConfig(map[string]string{"audit-log": logPath, "audit-table": "", "history-schema": ""}),
+			},
+			Instance:      inst,
+			SchemaFromDir: &tengo.Schema{Name: "product"},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := auditor.Prepare(target); err != nil {
+				t.Errorf("Unexpected error from Prepare: %s", err)
+			}
+			for i := 0; i < 10; i++ {
+				if err := auditor.RecordSchemaDDL(target, "ALTER DATABASE `product` CHARACTER SET utf8mb4", time.Second, nil); err != nil {
+					t.Errorf("Unexpected error from RecordSchemaDDL: %s", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	contents, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Unable to read audit log: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 80 {
+		t.Fatalf("Expected audit log to have 80 lines, instead found %d", len(lines))
+	}
+	for _, line := range lines {
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Errorf("Unable to decode audit log line %q: %s", line, err)
+		}
+	}
+}
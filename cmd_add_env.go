@@ -15,13 +15,18 @@ environment. For example, if ` + "`" + `skeema init` + "`" + ` was previously us
 for a host with the default "production" environment, ` + "`" + `skeema add-environment` + "`" + `
 could be used to define a "staging" or "development" environment pointing at a different
 host and port, or perhaps a "local" environment pointing at localhost and a
-socket path.`
+socket path.
+
+The new environment may optionally extend an existing environment in the same
+.skeema file, via --extends. In this case, any options set in the existing
+environment's section also apply to the new environment, unless overridden.`
 
 	cmd := mybase.NewCommand("add-environment", summary, desc, AddEnvHandler)
 	cmd.AddOption(mybase.StringOption("host", 'h', "", "Database hostname or IP address"))
 	cmd.AddOption(mybase.StringOption("port", 'P', "3306", "Port to use for database host"))
 	cmd.AddOption(mybase.StringOption("socket", 'S', "/tmp/mysql.sock", "Absolute path to Unix socket file used if host is localhost"))
 	cmd.AddOption(mybase.StringOption("dir", 'd', ".", "Base dir for this host's schemas"))
+	cmd.AddOption(mybase.StringOption("extends", 0, "", "Name of existing environment for the new environment to inherit options from"))
 	cmd.AddArg("environment", "", true)
 	CommandSuite.AddSubCommand(cmd)
 }
@@ -53,12 +58,16 @@ func AddEnvHandler(cfg *mybase.Config) error {
 	if hostOptionFile.HasSection(environment) {
 		return NewExitValue(CodeBadConfig, "Environment name \"%s\" already defined in %s", environment, hostOptionFile.Path())
 	}
+	parent := cfg.Get("extends")
+	if parent != "" && !hostOptionFile.HasSection(parent) {
+		return NewExitValue(CodeBadConfig, "Environment name \"%s\" supplied to --extends is not defined in %s", parent, hostOptionFile.Path())
+	}
 	if !hostOptionFile.SomeSectionHasOption("host") {
 		return NewExitValue(CodeBadConfig, "This command should be run against a --dir whose .skeema file already defines a host for another environment")
 	}
 
-	if !cfg.OnCLI("host") {
-		return NewExitValue(CodeBadConfig, "`skeema add-environment` requires --host to be supplied on CLI")
+	if !OnCLIOrEnv(cfg, "host") {
+		return NewExitValue(CodeBadConfig, "`skeema add-environment` requires --host to be supplied on CLI or via %s", EnvOptionValuer{Prefix: EnvOptionPrefix}.VarName("host"))
 	}
 	inst, err := dir.FirstInstance()
 	if err != nil {
@@ -67,6 +76,9 @@ func AddEnvHandler(cfg *mybase.Config) error {
 		return NewExitValue(CodeBadConfig, "Command line did not specify which instance to connect to")
 	}
 
+	if parent != "" {
+		hostOptionFile.SetSectionExtends(environment, parent)
+	}
 	hostOptionFile.SetOptionValue(environment, "host", inst.Host)
 	if inst.Host == "localhost" && inst.SocketPath != "" {
 		hostOptionFile.SetOptionValue(environment, "socket", inst.SocketPath)
@@ -83,6 +95,10 @@ func AddEnvHandler(cfg *mybase.Config) error {
 	}
 	dir.Config.MarkDirty()
 
-	log.Infof("Added environment [%s] to %s", environment, hostOptionFile.Path())
+	if parent != "" {
+		log.Infof("Added environment [%s] extending [%s] to %s", environment, parent, hostOptionFile.Path())
+	} else {
+		log.Infof("Added environment [%s] to %s", environment, hostOptionFile.Path())
+	}
 	return nil
 }
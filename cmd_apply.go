@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/skeema/mybase"
+	"github.com/skeema/tengo"
+)
+
+func init() {
+	summary := "Run DDL from a plan file previously written by diff"
+	desc := `Runs the DDL stored in a plan file, which was previously written by
+` + "`skeema diff --plan-file`" + `. This permits separating review of DDL from its
+execution: the exact statements that were reviewed are run, rather than
+re-generating DDL from the filesystem.
+
+Before running any DDL, every instance and schema in the plan is introspected
+again, and compared to the fingerprint recorded in the plan. If any schema has
+changed since the plan was created, or any instance cannot be reached, no DDL is
+run at all.
+
+You may optionally pass an environment name as a CLI arg. This must match the
+environment that was used to create the plan. If no environment name is
+supplied, the default is "production".
+
+If interrupted, no further DDL is started, but running DDL is permitted to
+complete. A second interrupt cancels running DDL.
+
+An exit code of 0 will be returned if all DDL in the plan ran successfully, or
+2+ if any error occurred.`
+
+	cmd := mybase.NewCommand("apply", summary, desc, ApplyHandler)
+	cmd.AddOption(mybase.StringOption("plan-file", 0, "", "Path to plan file to run; required"))
+	cmd.AddArg("environment", "production", false)
+	CommandSuite.AddSubCommand(cmd)
+}
+
+// ApplyHandler is the handler method for `skeema apply`
+func ApplyHandler(cfg *mybase.Config) error {
+	// Options specific to other recursive commands may be set in option files, so
+	// make them visible to this command as well. This includes push options that
+	// affect execution, such as alter-wrapper and audit-log.
+	addRecursiveCommandOptions(cfg.CLI.Command)
+	cfg.MarkDirty()
+
+	AddGlobalConfigFiles(cfg)
+
+	planPath := cfg.Get("plan-file")
+	if planPath == "" {
+		return NewExitValue(CodeBadUsage, "Option plan-file is required")
+	}
+	plan, err := ReadPlan(planPath)
+	if os.IsNotExist(err) {
+		return NewExitValue(CodeNoInput, "%s", err)
+	} else if err != nil {
+		return NewExitValue(CodeBadInput, "%s", err)
+	}
+	if environment := cfg.Get("environment"); plan.Environment != environment {
+		return NewExitValue(CodeBadConfig, "Plan file %s was created for environment \"%s\", but environment \"%s\" is in use", planPath, plan.Environment, environment)
+	}
+
+	// The interrupter is created before verifying targets, so that an interrupt
+	// also halts their introspection
+	interrupter := NewInterrupter()
+	defer interrupter.Close()
+
+	// Verify every target before running any DDL at all
+	targets := make([]*Target, 0, len(plan.Targets))
+	var mismatchCount int
+	for _, pt := range plan.Targets {
+		t, err := pt.Target(interrupter.StopContext(), cfg)
+		if interrupter.Stopping() {
+			return NewExitValue(CodeInterrupted, "Interrupted while verifying targets: no statements in plan file %s were run", planPath)
+		} else if err == nil {
+			err = pt.Verify(t)
+		}
+		if err != nil {
+			log.Errorf("%s %s for %s: %s", pt.Instance, pt.Schema, pt.Dir, err)
+			mismatchCount++
+			continue
+		}
+		targets = append(targets, t)
+	}
+	if mismatchCount > 0 {
+		return NewExitValue(CodeFatalError, "Aborting without running any DDL: %d target%s did not match plan file %s", mismatchCount, pluralSuffix(mismatchCount), planPath)
+	}
+
+	auditor := NewAuditor(plan.Environment)
+	var errCount int
+	for n, pt := range plan.Targets {
+		if interrupter.Stopping() {
+			break
+		}
+		errCount += applyPlanTarget(targets[n], pt, auditor, interrupter)
+	}
+	if interrupter.Stopping() {
+		var failures string
+		if errCount > 0 {
+			failures = fmt.Sprintf("; additionally skipped %d operation%s due to error%s", errCount, pluralSuffix(errCount), pluralSuffix(errCount))
+		}
+		return NewExitValue(CodeInterrupted, "Interrupted: remaining statements in plan file %s were not run%s", planPath, failures)
+	}
+	if errCount > 0 {
+		return NewExitValue(CodeFatalError, "Skipped %d operation%s due to error%s", errCount, pluralSuffix(errCount), pluralSuffix(errCount))
+	}
+	return nil
+}
+
+// Target returns a Target corresponding to pt, with its Instance and
+// SchemaFromInstance hydrated from the current state of the database instance.
+// SchemaFromDir only has its name populated, since the plan's DDL is used
+// instead of the filesystem's contents. If ctx is canceled while introspecting
+// the instance, an error is returned.
+func (pt *PlanTarget) Target(ctx context.Context, cfg *mybase.Config) (*Target, error) {
+	dir, err := NewDir(pt.Dir, cfg)
+	if err != nil {
+		return nil, err
+	} else if !dir.Exists() {
+		return nil, fmt.Errorf("Directory %s no longer exists", pt.Dir)
+	}
+	instances, err := dir.Instances()
+	if err != nil {
+		return nil, err
+	}
+	t := &Target{
+		Dir:           dir,
+		SchemaFromDir: &tengo.Schema{Name: pt.Schema},
+	}
+	for _, inst := range instances {
+		if inst.String() == pt.Instance {
+			t.Instance = inst
+			break
+		}
+	}
+	if t.Instance == nil {
+		return nil, fmt.Errorf("Instance %s is no longer configured for this directory", pt.Instance)
+	}
+	var schemasByName map[string]*tengo.Schema
+	err = callWithContext(ctx, func() (err error) {
+		schemasByName, err = t.Instance.SchemasByName()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.SchemaFromInstance = schemasByName[pt.Schema]
+	return t, nil
+}
+
+// Verify returns an error if the schema on t's instance does not match the
+// fingerprint recorded in the plan.
+func (pt *PlanTarget) Verify(t *Target) error {
+	fingerprint, err := SchemaFingerprint(t.SchemaFromInstance)
+	if err != nil {
+		return err
+	} else if fingerprint == pt.Fingerprint {
+		return nil
+	} else if pt.Fingerprint == "" {
+		return fmt.Errorf("Schema has been created since the plan was generated")
+	} else if fingerprint == "" {
+		return fmt.Errorf("Schema has been dropped since the plan was generated")
+	}
+	return fmt.Errorf("Schema has changed since the plan was generated (fingerprint %s, expected %s)", fingerprint, pt.Fingerprint)
+}
+
+// applyPlanTarget runs the DDL in pt against t, returning the number of
+// statements that were skipped or failed. Statements skipped due to an
+// interrupt are not counted.
+func applyPlanTarget(t *Target, pt *PlanTarget, auditor *Auditor, interrupter *Interrupter) (errCount int) {
+	logger := t.Logger()
+	logger.Infof("Applying plan to %s %s", t.Instance, pt.Schema)
+	if err := auditor.Prepare(t); err != nil {
+		logger.Errorf("Skipping %s %s for %s: %s", t.Instance, pt.Schema, t.Dir, err)
+		return len(pt.Statements) + 1
+	}
+	var throttler *LagThrottler
+	if len(pt.Statements) > 0 {
+		var err error
+		if throttler, err = NewLagThrottler(interrupter.StopContext(), t); interrupter.Stopping() {
+			return errCount
+		} else if err != nil {
+			logger.Errorf("Skipping %s %s for %s: %s", t.Instance, pt.Schema, t.Dir, err)
+			return len(pt.Statements) + 1
+		}
+	}
+
+	fmt.Printf("-- instance: %s\n", t.Instance)
+	if pt.SchemaDDL != "" {
+		fmt.Printf("%s;\n", pt.SchemaDDL)
+		db, err := t.Instance.Connect("", "")
+		start := time.Now()
+		if err == nil {
+			_, err = db.ExecContext(interrupter.Context(), pt.SchemaDDL)
+		}
+		if auditErr := auditor.RecordSchemaDDL(t, pt.SchemaDDL, time.Since(start), err); auditErr != nil {
+			logger.Error(auditErr)
+			errCount++
+		}
+		if err != nil {
+			logger.Errorf("Error running DDL on %s: %s", t.Instance, err)
+			return errCount + len(pt.Statements) + 1
+		}
+	}
+
+	fmt.Printf("USE %s;\n", tengo.EscapeIdentifier(pt.Schema))
+	for n, planned := range pt.Statements {
+		ddl := NewPlannedDDLStatement(planned, t)
+		tableLogger := logger.WithField("table", planned.Table).WithField("statement", ddl.String())
+		fmt.Println(ddl.String())
+		if ddl.Err != nil {
+			tableLogger.Errorf("%s. Skipping this and all subsequent statements for %s %s.", ddl.Err, t.Instance, pt.Schema)
+			return errCount + len(pt.Statements) - n
+		}
+		throttler.Wait(interrupter.StopContext())
+		if interrupter.Stopping() {
+			logger.Warnf("Due to interrupt, skipping %d remaining statement%s on %s %s", len(pt.Statements)-n, pluralSuffix(len(pt.Statements)-n), t.Instance, pt.Schema)
+			return errCount
+		}
+		start := time.Now()
+		execErr := ddl.Execute(interrupter.Context())
+		if auditErr := auditor.RecordDDL(t, planned.Table, ddl, time.Since(start)); auditErr != nil {
+			tableLogger.Error(auditErr)
+			errCount++
+		}
+		if execErr != nil {
+			tableLogger.Errorf("Error running DDL on %s %s: %s", t.Instance, pt.Schema, execErr)
+			if skipCount := len(pt.Statements) - n - 1; skipCount > 0 {
+				logger.Warnf("Due to previous error, skipping %d additional statements on %s %s", skipCount, t.Instance, pt.Schema)
+			}
+			return errCount + len(pt.Statements) - n
+		}
+	}
+	logger.Infof("%s %s: apply complete", t.Instance, pt.Schema)
+	return errCount
+}
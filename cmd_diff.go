@@ -54,8 +54,25 @@ func clonePushOptionsToDiff() {
 		"safe-below-size": "Always permit generating destructive operations for tables below this size in bytes",
 	}
 	hiddenRewrites := map[string]bool{
-		"brief":   false,
-		"dry-run": true,
+		"brief":                 false,
+		"plan-file":             false,
+		"dry-run":               true,
+		"audit-log":             true,
+		"audit-table":           true,
+		"rollback-dir":          true,
+		"state-file":            true,
+		"max-replica-lag":       true,
+		"replicas":              true,
+		"replica-wrapper":       true,
+		"heartbeat-table":       true,
+		"lock-wait-timeout":     true,
+		"max-transaction-age":   true,
+		"lock-wait-retries":     true,
+		"lock-wait-retry-delay": true,
+		"resume":                true,
+		"wrapper-output":        true,
+		"isolate-wrappers":      true,
+		"statement-timeout":     true,
 	}
 
 	diffOptions := diff.Options()
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+
+	"github.com/skeema/mybase"
+	"github.com/skeema/tengo"
+)
+
+func init() {
+	summary := "Report drift between the filesystem and DBs, for monitoring"
+	desc := `Compares the contents of the filesystem to the schemas on database instance(s),
+in the same manner as ` + "`skeema diff --brief`" + `, and outputs a machine-readable
+summary for each schema: whether it is in sync, the number of tables added,
+dropped, altered, or unsupported, and the time since the last push if a history
+is available (see history-schema option). No DDL is output. This command is
+intended for use in cron jobs and monitoring systems.
+
+Output is a JSON document by default, or Prometheus text format with
+--drift-format=prometheus, which is suitable for the node exporter's textfile
+collector.
+
+You may optionally pass an environment name as a CLI arg. This will affect which
+section of .skeema config files is used for processing. If no environment name
+is supplied, the default is "production".
+
+An exit code of 0 will be returned if all schemas are in sync, 1 if any schema
+has drifted, 69 if any database instance could not be reached, or 2 for other
+errors.`
+
+	cmd := mybase.NewCommand("drift", summary, desc, DriftHandler)
+	cmd.AddOption(mybase.StringOption("drift-format", 0, "json", `Format of STDOUT output (valid values: "json", "prometheus")`))
+	cmd.AddArg("environment", "production", false)
+	CommandSuite.AddSubCommand(cmd)
+}
+
+// DriftHandler is the handler method for `skeema drift`
+func DriftHandler(cfg *mybase.Config) error {
+	// Options specific to other recursive commands may be set in option files, so
+	// make them visible to this command as well
+	addRecursiveCommandOptions(cfg.CLI.Command)
+	cfg.MarkDirty()
+
+	AddGlobalConfigFiles(cfg)
+	dir, err := NewDir(".", cfg)
+	if err != nil {
+		return err
+	}
+	outputFormat, err := dir.Config.GetEnum("drift-format", "prometheus") // default of "json" is implicitly permitted
+	if err != nil {
+		return NewExitValue(CodeBadConfig, "%s", err)
+	}
+
+	report := NewDriftReport(cfg.Get("environment"))
+	for tg := range dir.TargetGroups(false, true) {
+		for _, t := range tg {
+			report.Add(targetDrift(t))
+		}
+	}
+
+	if outputFormat == "prometheus" {
+		err = report.WritePrometheus(os.Stdout)
+	} else {
+		err = report.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	if count := report.Summary[DriftUnreachable]; count > 0 {
+		return NewExitValue(CodeUnavailable, "Unable to reach database instance for %d schema%s", count, pluralSuffix(count))
+	} else if count := report.Summary[DriftError]; count > 0 {
+		return NewExitValue(CodeFatalError, "Unable to determine drift for %d schema%s due to error%s", count, pluralSuffix(count), pluralSuffix(count))
+	} else if count := report.Summary[DriftDrifted]; count > 0 {
+		return NewExitValue(CodeDifferencesFound, "Found drift in %d schema%s", count, pluralSuffix(count))
+	}
+	return nil
+}
+
+// targetDrift returns a SchemaDrift for t, logging any problems encountered.
+func targetDrift(t *Target) *SchemaDrift {
+	logger := t.Logger()
+	if t.Err != nil {
+		// Targets with an instance but no schema indicate a problem with the
+		// instance, which may be a connectivity problem
+		var unreachable bool
+		if t.Instance != nil && t.SchemaFromDir == nil {
+			ok, err := t.Instance.CanConnect()
+			unreachable = !ok && !tengo.IsDatabaseError(err)
+		}
+		if t.Instance == nil {
+			logger.Errorf("Skipping %s: %s", t.Dir, t.Err)
+		} else {
+			logger.Errorf("Skipping %s for %s: %s", t.Instance, t.Dir, t.Err)
+		}
+		return NewSchemaDriftError(t, unreachable)
+	}
+
+	schemaName := t.SchemaFromDir.Name
+	logger.Debugf("Checking drift of %s %s vs %s/*.sql", t.Instance, schemaName, t.Dir)
+	diff, err := tengo.NewSchemaDiff(t.SchemaFromInstance, t.SchemaFromDir)
+	if err != nil {
+		t.Err = err
+		logger.Errorf("Unable to diff %s %s: %s", t.Instance, schemaName, err)
+		return NewSchemaDriftError(t, false)
+	}
+	ignoreTable, err := t.Dir.Config.GetRegexp("ignore-table")
+	if err != nil {
+		t.Err = err
+		logger.Errorf("Skipping %s %s for %s: %s", t.Instance, schemaName, t.Dir, err)
+		return NewSchemaDriftError(t, false)
+	}
+	sd := NewSchemaDrift(t, diff, ignoreTable)
+
+	if historySchema := t.Dir.Config.Get("history-schema"); historySchema != "" {
+		sd.LastPushAge, err = lastPushAge(t.Instance, historySchema, schemaName)
+		if err != nil {
+			logger.Warnf("Unable to determine time of last push to %s %s: %s", t.Instance, schemaName, err)
+		}
+	}
+	if sd.Status == DriftDrifted {
+		logger.Infof("%s %s: drift found (%d added, %d dropped, %d altered, %d unsupported)", t.Instance, schemaName, sd.TablesAdded, sd.TablesDropped, sd.TablesAltered, sd.TablesUnsupported)
+	} else {
+		logger.Infof("%s %s: in sync", t.Instance, schemaName)
+	}
+	return sd
+}
+
+// pluralSuffix returns "s" if count is not 1, or an empty string otherwise.
+func pluralSuffix(count int) string {
+	if count == 1 {
+		return ""
+	}
+	return "s"
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/skeema/mybase"
+)
+
+func init() {
+	summary := "Display resolved option values for each directory, and where they came from"
+	desc := `Recursively crawls the current directory, displaying the effective value of
+every option for each directory containing a .skeema file. Each value is
+annotated with its source: an option default, the command-line, or the specific
+option file and section that set it. The targets (instance and schema pairs)
+that each directory maps to are also listed.
+
+This is useful for debugging complex configurations involving global option
+files, cascading .skeema files, and multiple environments. Passwords are always
+redacted in the output.
+
+You may optionally pass an environment name as a CLI arg. This will affect which
+section of .skeema config files is used for option values. If no environment
+name is supplied, the default is "production".
+
+An exit code of 0 will be returned if all configuration was resolved without
+error, or 2+ if some configuration error occurred.`
+
+	cmd := mybase.NewCommand("explain-config", summary, desc, ExplainConfigHandler)
+	cmd.AddArg("environment", "production", false)
+	CommandSuite.AddSubCommand(cmd)
+}
+
+// ExplainConfigHandler is the handler method for `skeema explain-config`
+func ExplainConfigHandler(cfg *mybase.Config) error {
+	// Options specific to other recursive commands may be set in option files, so
+	// make them visible to this command as well
+	addRecursiveCommandOptions(cfg.CLI.Command)
+	cfg.MarkDirty()
+
+	AddGlobalConfigFiles(cfg)
+
+	dir, err := NewDir(".", cfg)
+	if err != nil {
+		return err
+	}
+
+	errCount := explainDir(dir, true)
+	if errCount > 0 {
+		var plural string
+		if errCount > 1 {
+			plural = "s"
+		}
+		return NewExitValue(CodeFatalError, "Encountered %d configuration error%s", errCount, plural)
+	}
+	return nil
+}
+
+// explainDir displays resolved option values and targets for dir, and then
+// recurses into its subdirectories. Directories lacking a .skeema file are
+// skipped, unless force is true. The number of errors encountered is returned.
+func explainDir(dir *Dir, force bool) (errCount int) {
+	if force || dir.HasOptionFile() {
+		fmt.Printf("%s (environment \"%s\")\n", dir, dir.section)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		options := dir.Config.CLI.Command.Options()
+		names := make([]string, 0, len(options))
+		for name := range options {
+			if name != "help" && name != "version" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := dir.Config.GetRaw(name)
+			if name == "password" && dir.Config.Changed(name) {
+				value = "*****"
+			}
+			fmt.Fprintf(w, "    %s\t%s\t%s\n", name, value, describeOptionSource(dir, name))
+		}
+		w.Flush()
+
+		if dir.Config.Changed("host") && dir.HasSchema() {
+			fmt.Println("  Targets:")
+			instances, err := dir.Instances()
+			if err != nil {
+				fmt.Printf("    error: %s\n", err)
+				errCount++
+			}
+			for _, inst := range instances {
+				schemaNames, err := dir.SchemaNames(inst)
+				if err != nil {
+					fmt.Printf("    %s error: %s\n", inst, err)
+					errCount++
+					continue
+				}
+				for _, schemaName := range schemaNames {
+					fmt.Printf("    %s %s\n", inst, schemaName)
+				}
+			}
+		}
+		fmt.Println()
+	}
+
+	subdirs, err := dir.Subdirs()
+	if err != nil {
+		fmt.Printf("%s: error: %s\n\n", dir, err)
+		return errCount + 1
+	}
+	for _, subdir := range subdirs {
+		// Skip hidden dirs, for same reasons as generateTargetsForDir
+		if subdir.BaseName()[0] != '.' {
+			errCount += explainDir(subdir, false)
+		}
+	}
+	return errCount
+}
+
+// describeOptionSource returns a human-readable description of where the
+// value of the named option came from in dir's configuration.
+func describeOptionSource(dir *Dir, name string) string {
+	switch source := dir.Config.Source(name).(type) {
+	case *mybase.Command:
+		return "default"
+	case *mybase.CommandLine:
+		return "command line"
+	case EnvOptionValuer:
+		return "environment variable " + source.VarName(name)
+	case *OptionFile:
+		// Determine which section supplied the value, using the sections that were
+		// selected on the file when it was added as a source. This covers the
+		// special sections used by ~/.my.cnf, as well as any sections that the
+		// environment's section extends.
+		// Values obtained via !include or !includedir are reported using the path
+		// of the included file that supplied them.
+		path := source.Path()
+		if origin := source.OptionValueSource(name); origin != nil {
+			path = origin.Path()
+		}
+		hasOption := make(map[string]bool)
+		for _, section := range source.SectionsWithOption(name) {
+			hasOption[section] = true
+		}
+		for _, section := range source.SelectedSections() {
+			if hasOption[section] && section != "" {
+				return fmt.Sprintf("%s [%s]", path, section)
+			}
+		}
+		return path
+	default:
+		return fmt.Sprintf("%T", source)
+	}
+}
+
+// addRecursiveCommandOptions adds to cmd any options belonging to the other
+// commands that recursively crawl directories. This permits commands such as
+// explain-config to resolve values of any option that may appear in a .skeema
+// file. Options already present in cmd are left as-is.
+func addRecursiveCommandOptions(cmd *mybase.Command) {
+	existing := cmd.Options()
+	for _, name := range []string{"diff", "drift", "lint", "pull", "push"} {
+		other, ok := CommandSuite.SubCommands[name]
+		if !ok || other == cmd {
+			continue
+		}
+		for optName, opt := range other.Options() {
+			if _, already := existing[optName]; !already {
+				cmd.AddOption(opt)
+				existing[optName] = opt
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skeema/mybase"
+)
+
+func TestDescribeOptionSource(t *testing.T) {
+	root := optionFileTestDir(t, map[string]string{
+		".my.cnf":          "[client]\nuser=myuser\n[production]\nport=1234\n",
+		".skeema":          "[production]\ndefault-character-set=utf8mb4\n",
+		"proj/.git/HEAD":   "",
+		"proj/.skeema":     "host=db1\n[base]\nport=3307\n[production]\n!extends base\n",
+		"proj/sub/.skeema": "!include inc.cnf\n[client]\ndefault-character-set=latin1\n",
+		"proj/sub/inc.cnf": "temp-schema=_inc_tmp\n[production]\nconcurrent-instances=2\n",
+	})
+	defer os.RemoveAll(root)
+	origHome := os.Getenv("HOME")
+	defer os.Setenv("HOME", origHome)
+	os.Setenv("HOME", root)
+
+	// Global options are normally added to CommandSuite by main()
+	if _, ok := CommandSuite.Options()["host"]; !ok {
+		AddGlobalOptions(CommandSuite)
+	}
+	cfg := mybase.ParseFakeCLI(t, CommandSuite, "skeema explain-config production")
+	addRecursiveCommandOptions(cfg.CLI.Command)
+	cfg.MarkDirty()
+	AddGlobalConfigFiles(cfg)
+
+	dir, err := NewDir(filepath.Join(root, "proj", "sub"), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error from NewDir: %s", err)
+	}
+	expected := map[string]string{
+		"user":                  filepath.Join(root, ".my.cnf") + " [client]",
+		"host":                  filepath.Join(root, "proj", ".skeema"),
+		"port":                  filepath.Join(root, "proj", ".skeema") + " [base]",
+		"default-character-set": filepath.Join(root, ".skeema") + " [production]",
+		"temp-schema":           filepath.Join(root, "proj", "sub", "inc.cnf"),
+		"concurrent-instances":  filepath.Join(root, "proj", "sub", "inc.cnf") + " [production]",
+		"debug":                 "default",
+	}
+	for name, source := range expected {
+		if actual := describeOptionSource(dir, name); actual != source {
+			t.Errorf("Expected source of %s to be %q, instead found %q", name, source, actual)
+		}
+	}
+}
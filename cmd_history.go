@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/skeema/mybase"
+)
+
+func init() {
+	summary := "Display the history of schema changes made by push"
+	desc := `Recursively crawls the current directory, and for each schema targeted by the
+configuration, displays the DDL previously executed by ` + "`skeema push`" + ` on each
+database instance, newest first. The history is read from a table in the schema
+named by the history-schema option, which must have been set when push was run.
+
+Each entry includes the time the statement was executed, the table affected, the
+result and duration, and the git commit of the schema repo at the time of the
+push, if available. Entries with the same push ID were executed by the same run
+of ` + "`skeema push`" + `.
+
+You may optionally pass an environment name as a CLI arg. This will affect which
+section of .skeema config files is used for processing. If no environment name
+is supplied, the default is "production".
+
+An exit code of 0 will be returned if history was retrieved from all targets
+without error, or 2+ if some error occurred.`
+
+	cmd := mybase.NewCommand("history", summary, desc, HistoryHandler)
+	cmd.AddOption(mybase.StringOption("limit", 0, "20", "Maximum number of entries to display per schema; 0 for no limit"))
+	cmd.AddOption(mybase.StringOption("table", 0, "", "Only display entries affecting this table"))
+	cmd.AddArg("environment", "production", false)
+	CommandSuite.AddSubCommand(cmd)
+}
+
+// HistoryHandler is the handler method for `skeema history`
+func HistoryHandler(cfg *mybase.Config) error {
+	// Options specific to other recursive commands may be set in option files, so
+	// make them visible to this command as well
+	addRecursiveCommandOptions(cfg.CLI.Command)
+	cfg.MarkDirty()
+
+	AddGlobalConfigFiles(cfg)
+
+	dir, err := NewDir(".", cfg)
+	if err != nil {
+		return err
+	}
+	limit, err := cfg.GetInt("limit")
+	if err != nil || limit < 0 {
+		return NewExitValue(CodeBadConfig, "Option limit must be a non-negative integer")
+	}
+
+	errCount := historyForDir(dir, limit)
+	if errCount > 0 {
+		var plural string
+		if errCount > 1 {
+			plural = "s"
+		}
+		return NewExitValue(CodeFatalError, "Encountered %d error%s retrieving history", errCount, plural)
+	}
+	return nil
+}
+
+// historyForDir displays history entries for each instance and schema targeted
+// by dir, and then recurses into its subdirectories. The number of errors
+// encountered is returned.
+func historyForDir(dir *Dir, limit int) (errCount int) {
+	if dir.Config.Changed("host") && dir.HasSchema() {
+		historySchema := dir.Config.Get("history-schema")
+		if historySchema == "" {
+			log.Errorf("Skipping %s: option history-schema is not set", dir)
+			return 1
+		}
+		instances, err := dir.Instances()
+		if err != nil {
+			log.Errorf("Skipping %s: %s", dir, err)
+			errCount++
+		}
+		for _, inst := range instances {
+			schemaNames, err := dir.SchemaNames(inst)
+			if err != nil {
+				log.Errorf("Skipping %s for %s: %s", inst, dir, err)
+				errCount++
+				continue
+			}
+			for _, schemaName := range schemaNames {
+				entries, err := queryHistory(inst, historySchema, schemaName, dir.Config.Get("table"), limit)
+				if err != nil {
+					log.Errorf("Unable to retrieve history for %s %s: %s", inst, schemaName, err)
+					errCount++
+					continue
+				}
+				printHistory(inst.String(), schemaName, entries)
+			}
+		}
+	}
+
+	subdirs, err := dir.Subdirs()
+	if err != nil {
+		log.Errorf("Cannot list subdirs of %s: %s", dir, err)
+		return errCount + 1
+	}
+	for _, subdir := range subdirs {
+		// Skip hidden dirs, for same reasons as generateTargetsForDir
+		if subdir.BaseName()[0] != '.' {
+			errCount += historyForDir(subdir, limit)
+		}
+	}
+	return errCount
+}
+
+// printHistory displays entries for the named instance and schema in a
+// tabular format.
+func printHistory(instance, schemaName string, entries []HistoryEntry) {
+	fmt.Printf("%s %s\n", instance, schemaName)
+	if len(entries) == 0 {
+		fmt.Printf("  (no history recorded)\n\n")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  EXECUTED AT\tPUSH ID\tUSER\tCOMMIT\tTABLE\tRESULT\tDURATION\tSTATEMENT")
+	for _, entry := range entries {
+		commit := "-"
+		if entry.GitCommit != nil && len(*entry.GitCommit) > 0 {
+			commit = *entry.GitCommit
+			if len(commit) > 12 {
+				commit = commit[0:12]
+			}
+		}
+		table := entry.Table
+		if table == "" {
+			table = "-"
+		}
+		result := entry.Result
+		if entry.Error != nil && *entry.Error != "" {
+			result = fmt.Sprintf("%s: %s", result, singleLine(*entry.Error))
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\t%.3fs\t%s\n", entry.ExecutedAt, entry.PushID, entry.OSUser, commit, table, result, entry.Duration, singleLine(entry.Statement))
+	}
+	w.Flush()
+	fmt.Println()
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"path"
 	"strconv"
 	"strings"
@@ -51,8 +50,8 @@ func InitHandler(cfg *mybase.Config) error {
 	onlySchema := cfg.Get("schema")
 	separateSchemaSubdir := (onlySchema == "")
 
-	if !cfg.OnCLI("host") {
-		return NewExitValue(CodeBadConfig, "Option --host must be supplied on the command-line")
+	if !OnCLIOrEnv(cfg, "host") {
+		return NewExitValue(CodeBadConfig, "Option --host must be supplied on the command-line or via %s", EnvOptionValuer{Prefix: EnvOptionPrefix}.VarName("host"))
 	}
 
 	if !cfg.Changed("dir") { // default for dir is to base it on the hostname
@@ -74,7 +73,7 @@ func InitHandler(cfg *mybase.Config) error {
 	if hostDir.HasOptionFile() {
 		return NewExitValue(CodeBadConfig, "Cannot use dir %s: already has .skeema file", hostDir.Path)
 	}
-	if hostDir.Config.Changed("schema") && !hostDir.Config.OnCLI("schema") {
+	if hostDir.Config.Changed("schema") && !OnCLIOrEnv(hostDir.Config, "schema") {
 		return NewExitValue(CodeBadConfig, "Cannot use dir %s: a parent dir already defines a schema", hostDir.Path)
 	}
 
@@ -175,8 +174,8 @@ func InitHandler(cfg *mybase.Config) error {
 // responsibility to ensure its .skeema option file exists and maps to the
 // correct schema name.
 func PopulateSchemaDir(s *tengo.Schema, parentDir *Dir, makeSubdir bool) error {
-	// Ignore any attempt to populate a dir for the temp schema
-	if s.Name == parentDir.Config.Get("temp-schema") {
+	// Ignore any attempt to populate a dir for the temp schema or history schema
+	if s.Name == parentDir.Config.Get("temp-schema") || s.Name == parentDir.Config.Get("history-schema") {
 		return nil
 	}
 
@@ -248,6 +247,6 @@ func PopulateSchemaDir(s *tengo.Schema, parentDir *Dir, makeSubdir bool) error {
 		}
 		log.Infof("Wrote %s (%d bytes)", sf.Path(), length)
 	}
-	os.Stderr.WriteString("\n")
+	logSpacer()
 	return nil
 }
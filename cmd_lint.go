@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"path"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/skeema/mybase"
@@ -12,7 +12,8 @@ func init() {
 	summary := "Verify table files and reformat them in a standardized way"
 	desc := `Reformats the filesystem representation of tables to match the format of SHOW
 CREATE TABLE. Verifies that all table files contain valid SQL in their CREATE
-TABLE statements.
+TABLE statements. If any naming-* options are configured, also verifies that all
+table, column, index, and foreign key names follow those naming conventions.
 
 This command relies on accessing database instances to test the SQL DDL. All DDL
 will be run against a temporary schema, with no impact on the real schema.
@@ -26,9 +27,12 @@ supplied, the default is "production".
 
 An exit code of 0 will be returned if all files were already formatted properly,
 1 if some files were reformatted but all SQL was valid, or 2+ if at least one
-file had SQL syntax errors or some other error occurred.`
+file had SQL syntax errors, naming convention violations, or some other error
+occurred.`
 
 	cmd := mybase.NewCommand("lint", summary, desc, LintHandler)
+	cmd.AddOption(mybase.StringOption("report-format", 0, "", `Also write results to report-file in this format (valid values: "junit", "checkstyle")`))
+	cmd.AddOption(mybase.StringOption("report-file", 0, "", "Path to write report to; requires report-format"))
 	cmd.AddArg("environment", "production", false)
 	CommandSuite.AddSubCommand(cmd)
 }
@@ -40,12 +44,18 @@ func LintHandler(cfg *mybase.Config) error {
 	if err != nil {
 		return err
 	}
+	reportFormat, reportPath, err := reportOptions(cfg)
+	if err != nil {
+		return err
+	}
+	report := NewReport("lint")
 
-	var errCount, sqlErrCount, reformatCount int
+	var errCount, sqlErrCount, reformatCount, namingErrCount int
 	for _, t := range dir.Targets() {
 		if t.Err != nil {
 			log.Errorf("Skipping %s:", t.Dir)
 			log.Errorf("    %s\n", t.Err)
+			report.AddCase(t.Dir.Path, path.Base(t.Dir.Path), path.Join(t.Dir.Path, ".skeema")).AddFinding(SeverityError, "skeema.target", "%s", t.Err)
 			errCount++
 			continue
 		}
@@ -61,6 +71,7 @@ func LintHandler(cfg *mybase.Config) error {
 
 		for _, sf := range t.SQLFileErrors {
 			log.Error(sf.Error)
+			report.AddCase(t.Dir.Path, sf.FileName, sf.Path()).AddFinding(SeverityError, "skeema.syntax", "%s", sf.Error)
 			sqlErrCount++
 		}
 
@@ -68,6 +79,10 @@ func LintHandler(cfg *mybase.Config) error {
 		if err != nil {
 			return err
 		}
+		namingPolicy, err := NewNamingPolicy(t.Dir.Config)
+		if err != nil {
+			return err
+		}
 		tables, _ := t.SchemaFromDir.Tables() // can ignore error since table list already guaranteed to be cached
 		for _, table := range tables {
 			if ignoreTable != nil && ignoreTable.MatchString(table.Name) {
@@ -84,6 +99,12 @@ func LintHandler(cfg *mybase.Config) error {
 			for _, warning := range sf.Warnings {
 				log.Debug(warning)
 			}
+			rc := report.AddCase(t.Dir.Path, sf.FileName, sf.Path())
+			for _, violation := range namingPolicy.Violations(table) {
+				log.Errorf("%s: %s", sf.Path(), violation)
+				rc.AddFinding(SeverityError, "skeema.naming", "%s", violation)
+				namingErrCount++
+			}
 			if table.CreateStatement() != sf.Contents {
 				sf.Contents = table.CreateStatement()
 				var length int
@@ -91,10 +112,18 @@ func LintHandler(cfg *mybase.Config) error {
 					return fmt.Errorf("Unable to write to %s: %s", sf.Path(), err)
 				}
 				log.Infof("Wrote %s (%d bytes) -- updated file to normalize format", sf.Path(), length)
+				rc.AddFinding(SeverityWarning, "skeema.format", "File was reformatted to match SHOW CREATE TABLE")
 				reformatCount++
 			}
 		}
-		os.Stderr.WriteString("\n")
+		logSpacer()
+	}
+
+	if reportFormat != "" {
+		if err := report.Write(reportFormat, reportPath); err != nil {
+			return NewExitValue(CodeCantCreate, "Unable to write report to %s: %s", reportPath, err)
+		}
+		log.Infof("Wrote %s report to %s", reportFormat, reportPath)
 	}
 
 	var plural string
@@ -106,6 +135,11 @@ func LintHandler(cfg *mybase.Config) error {
 		return NewExitValue(CodeFatalError, "Skipped %d operation%s due to error%s", errCount, plural, plural)
 	case sqlErrCount > 0:
 		return NewExitValue(CodeFatalError, "Found syntax error%s in %d SQL file%s", plural, sqlErrCount, plural)
+	case namingErrCount > 0:
+		if namingErrCount > 1 {
+			plural = "s"
+		}
+		return NewExitValue(CodeFatalError, "Found %d naming convention violation%s", namingErrCount, plural)
 	case reformatCount > 0:
 		return NewExitValue(CodeDifferencesFound, "")
 	default:
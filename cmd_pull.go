@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/skeema/mybase"
@@ -233,7 +232,7 @@ func PullHandler(cfg *mybase.Config) error {
 			}
 		}
 
-		os.Stderr.WriteString("\n")
+		logSpacer()
 	}
 
 	if err := findNewSchemas(dir); err != nil {
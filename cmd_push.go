@@ -2,12 +2,17 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/skeema/mybase"
 	"github.com/skeema/tengo"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 func init() {
@@ -22,7 +27,10 @@ which section of .skeema config files is used for processing. For example,
 running ` + "`" + `skeema push staging` + "`" + ` will apply config directives from the
 [staging] section of config files, as well as any sectionless directives at the
 top of the file. If no environment name is supplied, the default is
-"production".`
+"production".
+
+If interrupted, no further DDL is started, but running DDL is permitted to
+complete. A second interrupt cancels running DDL.`
 
 	cmd := mybase.NewCommand("push", summary, desc, PushHandler)
 	cmd.AddOption(mybase.BoolOption("verify", 0, true, "Test all generated ALTER statements on temp schema to verify correctness"))
@@ -35,8 +43,33 @@ top of the file. If no environment name is supplied, the default is
 	cmd.AddOption(mybase.StringOption("alter-lock", 0, "", `Apply a LOCK clause to all ALTER TABLEs (valid values: "NONE", "SHARED", "EXCLUSIVE")`))
 	cmd.AddOption(mybase.StringOption("alter-algorithm", 0, "", `Apply an ALGORITHM clause to all ALTER TABLEs (valid values: "INPLACE", "COPY")`))
 	cmd.AddOption(mybase.StringOption("ddl-wrapper", 'X', "", "Like --alter-wrapper, but applies to all DDL types (CREATE, DROP, ALTER)"))
+	cmd.AddOption(mybase.StringOption("osc-tool", 0, "", `Use built-in integration with an online schema change tool for ALTER TABLE (valid values: "pt-osc", "gh-ost")`))
+	cmd.AddOption(mybase.StringOption("osc-tool-path", 0, "", "Path to executable for osc-tool, if not in PATH under its usual name"))
+	cmd.AddOption(mybase.StringOption("osc-tool-options", 0, "", "Additional command-line options to pass to osc-tool"))
+	cmd.AddOption(mybase.StringOption("wrapper-output", 0, "direct", `How to output external commands' STDOUT and STDERR (valid values: "direct", "prefix", "buffer")`))
+	cmd.AddOption(mybase.BoolOption("isolate-wrappers", 0, false, "Run external commands in their own process group without STDIN, so the first interrupt does not reach them"))
 	cmd.AddOption(mybase.StringOption("safe-below-size", 0, "0", "Always permit destructive operations for tables below this size in bytes"))
 	cmd.AddOption(mybase.StringOption("concurrent-instances", 'c', "1", "Perform operations on this number of instances concurrently"))
+	cmd.AddOption(mybase.BoolOption("enforce-naming", 0, false, "Skip all DDL for a schema if any created or altered table violates naming-* options"))
+	cmd.AddOption(mybase.StringOption("audit-log", 0, "", "Append a JSON record of each executed DDL statement to this file"))
+	cmd.AddOption(mybase.StringOption("rollback-dir", 0, "", "Before running DDL, write a script reversing it to a file in this directory"))
+	cmd.AddOption(mybase.StringOption("audit-table", 0, "", "Insert a record of each executed DDL statement into this table (format schema.table) on each instance"))
+	cmd.AddOption(mybase.StringOption("lock-wait-timeout", 0, "0", "Session lock_wait_timeout in seconds for DDL run directly; 0 to use server default"))
+	cmd.AddOption(mybase.StringOption("max-transaction-age", 0, "0", "Before ALTER or DROP, refuse if a transaction locking tables in the schema is open longer than this many seconds; 0 to disable (see docs for limitations)"))
+	cmd.AddOption(mybase.StringOption("lock-wait-retries", 0, "0", "Number of times to retry DDL that could not obtain a metadata lock"))
+	cmd.AddOption(mybase.StringOption("lock-wait-retry-delay", 0, "5", "Seconds to wait before first lock-wait-retries retry; doubles with each retry"))
+	cmd.AddOption(mybase.StringOption("statement-timeout", 0, "0", "Kill any single DDL statement or external command running longer than this many seconds; 0 for no limit"))
+	cmd.AddOption(mybase.StringOption("max-replica-lag", 0, "0", "Before each DDL statement, wait until lag of all replicas is at most this many seconds; 0 to disable"))
+	cmd.AddOption(mybase.StringOption("replicas", 0, "", "Comma-separated list of replicas to check for max-replica-lag, instead of discovering them"))
+	cmd.AddOption(mybase.StringOption("replica-wrapper", 0, "", "External bin to shell out to for replica lookup for max-replica-lag; see manual for template vars"))
+	cmd.AddOption(mybase.StringOption("heartbeat-table", 0, "", "Measure replica lag using this pt-heartbeat table (format schema.table), instead of SHOW SLAVE STATUS"))
+	cmd.AddOption(mybase.StringOption("state-file", 0, "", "Track completed targets and statements in this file, for use with --resume"))
+	cmd.AddOption(mybase.BoolOption("resume", 0, false, "Continue a partially-failed push tracked by state-file, skipping completed targets"))
+	cmd.AddOption(mybase.BoolOption("table-diff", 0, false, "Output a unified diff of each altered table's CREATE TABLE before its ALTER TABLE"))
+	cmd.AddOption(mybase.StringOption("output-format", 0, "sql", `Format of STDOUT output (valid values: "sql", "json")`))
+	cmd.AddOption(mybase.StringOption("plan-file", 0, "", "Write generated DDL and schema fingerprints to this file, for use by `skeema apply`").Hidden())
+	cmd.AddOption(mybase.StringOption("report-format", 0, "", `Also write results to report-file in this format (valid values: "junit", "checkstyle")`))
+	cmd.AddOption(mybase.StringOption("report-file", 0, "", "Path to write report to; requires report-format"))
 	cmd.AddArg("environment", "production", false)
 	CommandSuite.AddSubCommand(cmd)
 	clonePushOptionsToDiff()
@@ -47,9 +80,20 @@ type sharedPushState struct {
 	targetGroups       <-chan TargetGroup
 	dryRun             bool
 	briefOutput        bool
+	jsonOutput         bool
+	colorize           bool            // whether to colorize table-diff output
+	results            []*TargetResult // only populated if jsonOutput is true or plan is non-nil
+	plan               *Plan           // only non-nil if plan-file is in use
+	report             *Report
+	auditor            *Auditor
+	state              *PushState   // only non-nil if state-file is in use
+	interrupter        *Interrupter // only non-nil if not dry-run
+	startTime          time.Time
 	errCount           int
 	diffCount          int
 	unsupportedCount   int
+	execCount          int // statements run successfully
+	interruptCount     int // statements skipped due to interrupt
 	lastStdoutInstance string
 	lastStdoutSchema   string
 	seenInstance       map[string]bool
@@ -73,17 +117,53 @@ func PushHandler(cfg *mybase.Config) error {
 	if err != nil {
 		return err
 	}
+	outputFormat, err := dir.Config.GetEnum("output-format", "json") // default of "sql" is implicitly permitted
+	if err != nil {
+		return err
+	}
+	jsonOutput := (outputFormat == "json")
+	reportFormat, reportPath, err := reportOptions(cfg)
+	if err != nil {
+		return err
+	}
+	planPath := dir.optionPath("plan-file")
+	if planPath != "" && (!cfg.GetBool("dry-run") || cfg.GetBool("brief")) {
+		return NewExitValue(CodeBadConfig, "Option plan-file may only be used with `skeema diff`, and cannot be combined with brief")
+	}
 
-	// The 2nd param of dir.TargetGroups indicates that SQLFile errors are to be
-	// treated as fatal. This is required for push and diff. Otherwise, a file with
-	// invalid CREATE TABLE SQL would lead to a table being missing in the temp
-	// schema, which would confuse the logic that diffs schemas.
 	sps := &sharedPushState{
-		targetGroups: dir.TargetGroups(cfg.GetBool("first-only"), true),
-		dryRun:       cfg.GetBool("dry-run"),
-		briefOutput:  cfg.GetBool("brief") && cfg.GetBool("dry-run"),
-		Mutex:        new(sync.Mutex),
-		WaitGroup:    new(sync.WaitGroup),
+		dryRun:      cfg.GetBool("dry-run"),
+		briefOutput: cfg.GetBool("brief") && cfg.GetBool("dry-run") && !jsonOutput,
+		jsonOutput:  jsonOutput,
+		colorize:    terminal.IsTerminal(int(os.Stdout.Fd())),
+		report:      NewReport(cfg.CLI.Command.Name),
+		auditor:     NewAuditor(cfg.Get("environment")),
+		startTime:   time.Now(),
+		Mutex:       new(sync.Mutex),
+		WaitGroup:   new(sync.WaitGroup),
+	}
+	if planPath != "" {
+		sps.plan = NewPlan(cfg.Get("environment"))
+	}
+	statePath := dir.optionPath("state-file")
+	if sps.state, err = openPushState(statePath, cfg); err != nil {
+		return err
+	}
+
+	// The interrupter is created before generating targets, so that an interrupt
+	// also halts the introspection and temp schema work for remaining targets.
+	if !sps.dryRun {
+		sps.interrupter = NewInterrupter()
+		defer sps.interrupter.Close()
+	}
+
+	// The 3rd param of dir.TargetGroupsContext indicates that SQLFile errors are
+	// to be treated as fatal. This is required for push and diff. Otherwise, a
+	// file with invalid CREATE TABLE SQL would lead to a table being missing in
+	// the temp schema, which would confuse the logic that diffs schemas.
+	sps.targetGroups = dir.TargetGroupsContext(sps.interrupter.StopContext(), cfg.GetBool("first-only"), true)
+	if sps.state != nil {
+		sps.targetGroups = queueTargetGroups(sps.targetGroups, sps.state)
 	}
 
 	for n := 0; n < workerCount; n++ {
@@ -92,9 +172,41 @@ func PushHandler(cfg *mybase.Config) error {
 	}
 
 	sps.Wait()
+	sps.interrupter.Close()
+	if sps.state != nil {
+		logPendingTargets(sps.state, statePath)
+		if err := sps.state.Err(); err != nil {
+			sps.setFatalError(NewExitValue(CodeCantCreate, "Unable to write state file %s: %s", statePath, err))
+		}
+	}
+	if sps.jsonOutput {
+		if err := sps.writeJSON(cfg); err != nil && sps.fatalError == nil {
+			return err
+		}
+	}
+	if sps.plan != nil && sps.fatalError == nil {
+		if skipCount := sps.errCount + sps.unsupportedCount; skipCount > 0 {
+			return NewExitValue(CodeFatalError, "Plan file not written, since %d operation%s could not be planned due to unsupported features or errors", skipCount, pluralSuffix(skipCount))
+		} else if err := sps.plan.Write(planPath); err != nil {
+			return NewExitValue(CodeCantCreate, "Unable to write plan file %s: %s", planPath, err)
+		}
+		log.Infof("Wrote plan for %d target%s to %s", len(sps.plan.Targets), pluralSuffix(len(sps.plan.Targets)), planPath)
+	}
+	if reportFormat != "" {
+		if err := sps.report.Write(reportFormat, reportPath); err == nil {
+			log.Infof("Wrote %s report to %s", reportFormat, reportPath)
+		} else if sps.fatalError == nil {
+			return NewExitValue(CodeCantCreate, "Unable to write report to %s: %s", reportPath, err)
+		} else {
+			log.Errorf("Unable to write report to %s: %s", reportPath, err)
+		}
+	}
 	if sps.fatalError != nil {
 		return sps.fatalError
 	}
+	if sps.interrupter.Stopping() {
+		return sps.interruptedExitValue()
+	}
 
 	if sps.errCount+sps.unsupportedCount == 0 {
 		if sps.dryRun && sps.diffCount > 0 {
@@ -127,17 +239,26 @@ func pushWorker(sps *sharedPushState) {
 
 	for tg := range sps.targetGroups { // consume a TargetGroup from the channel
 		for _, t := range tg { // iterate over each Target in the TargetGroup
-			if sps.fatalError != nil {
+			if sps.fatalError != nil || sps.interrupter.Stopping() {
 				return
 			}
+			logger := t.Logger()
+			if sps.state.Completed(t) {
+				logger.Infof("Skipping %s %s for %s: already completed according to state file\n", t.Instance, t.SchemaFromDir.Name, t.Dir)
+				continue
+			}
+			previousStatements := sps.state.Begin(t)
+			result := sps.addResult(t)
 			if t.Err != nil {
+				sps.state.Fail(t, "%s", t.Err)
 				if t.Instance == nil {
-					log.Errorf("Skipping %s: %s\n", t.Dir, t.Err)
+					logger.Errorf("Skipping %s: %s\n", t.Dir, t.Err)
 				} else if t.SchemaFromDir == nil {
-					log.Errorf("Skipping %s for %s: %s\n", t.Instance, t.Dir, t.Err)
+					logger.Errorf("Skipping %s for %s: %s\n", t.Instance, t.Dir, t.Err)
 				} else {
-					log.Errorf("Skipping %s %s for %s: %s\n", t.Instance, t.SchemaFromDir.Name, t.Dir, t.Err)
+					logger.Errorf("Skipping %s %s for %s: %s\n", t.Instance, t.SchemaFromDir.Name, t.Dir, t.Err)
 				}
+				sps.report.AddCase(t.Dir.Path, path.Base(t.Dir.Path), path.Join(t.Dir.Path, ".skeema")).AddFinding(SeverityError, "skeema.target", "%s", t.Err)
 				sps.incrementErrCount(1)
 				continue
 			}
@@ -145,14 +266,15 @@ func pushWorker(sps *sharedPushState) {
 			// Get schema name from t.SchemaFromDir, NOT t.SchemaFromInstance, since
 			// t.SchemaFromInstance will be nil if the schema doesn't exist yet
 			schemaName := t.SchemaFromDir.Name
+			reportSuite := fmt.Sprintf("%s %s", t.Instance, schemaName)
 
 			if sps.dryRun {
-				log.Infof("Generating diff of %s %s vs %s/*.sql", t.Instance, schemaName, t.Dir)
+				logger.Infof("Generating diff of %s %s vs %s/*.sql", t.Instance, schemaName, t.Dir)
 			} else {
-				log.Infof("Pushing changes from %s/*.sql to %s %s", t.Dir, t.Instance, schemaName)
+				logger.Infof("Pushing changes from %s/*.sql to %s %s", t.Dir, t.Instance, schemaName)
 			}
 			for _, warning := range t.SQLFileWarnings {
-				log.Debug(warning)
+				logger.Debug(warning)
 			}
 
 			diff, err := tengo.NewSchemaDiff(t.SchemaFromInstance, t.SchemaFromDir)
@@ -160,33 +282,73 @@ func pushWorker(sps *sharedPushState) {
 				sps.setFatalError(err)
 				return
 			}
-			var targetStmtCount int
+			ignoreTable, err := t.Dir.Config.GetRegexp("ignore-table")
+			if err != nil {
+				sps.setFatalError(err)
+				return
+			}
 
-			if diff.SchemaDDL != "" {
-				sps.syncPrintf(t.Instance, "", "%s;\n", diff.SchemaDDL)
-				targetStmtCount++
-				if !sps.dryRun {
-					if strings.HasPrefix(diff.SchemaDDL, "CREATE DATABASE") && t.SchemaFromInstance == nil {
-						t.SchemaFromInstance, err = t.Instance.CreateSchema(schemaName, t.SchemaFromDir.CharSet, t.SchemaFromDir.Collation)
-						if err != nil {
-							sps.setFatalError(fmt.Errorf("Error creating schema %s on %s: %s", schemaName, t.Instance, err))
-							return
-						}
-					} else if strings.HasPrefix(diff.SchemaDDL, "ALTER DATABASE") {
-						err = t.Instance.AlterSchema(t.SchemaFromInstance, t.SchemaFromDir.CharSet, t.SchemaFromDir.Collation)
-						if err != nil {
-							sps.setFatalError(fmt.Errorf("Unable to alter defaults for schema %s on %s: %s", t.SchemaFromInstance.Name, t.Instance, err))
-							return
-						}
-					} else {
-						sps.setFatalError(fmt.Errorf("Refusing to run unexpectedly-generated schema-level DDL: %s", diff.SchemaDDL))
-						return
+			// If requested, enforce naming conventions before running any DDL at all
+			// for this target
+			if t.Dir.Config.GetBool("enforce-naming") {
+				policy, err := NewNamingPolicy(t.Dir.Config)
+				if err != nil {
+					sps.setFatalError(err)
+					return
+				}
+				if violations := policy.DiffViolations(diff, ignoreTable); len(violations) > 0 {
+					rc := sps.report.AddCase(reportSuite, "naming", "")
+					for _, violation := range violations {
+						logger.Error(violation)
+						rc.AddFinding(SeverityError, "skeema.naming", "%s", violation)
+					}
+					logger.Errorf("Skipping %s %s for %s due to naming convention violations. See --help for more information.\n", t.Instance, schemaName, t.Dir)
+					if result != nil {
+						result.Error = fmt.Sprintf("Skipped due to %d naming convention violations", len(violations))
+					}
+					sps.state.Fail(t, "Skipped due to %d naming convention violations", len(violations))
+					sps.incrementErrCount(len(diff.TableDiffs))
+					continue
+				}
+			}
+
+			// Ensure that any DDL can be audited before running any DDL at all for this
+			// target
+			if !sps.dryRun && (diff.SchemaDDL != "" || len(diff.TableDiffs) > 0) {
+				if err := sps.auditor.Prepare(t); err != nil {
+					logger.Errorf("Skipping %s %s for %s: %s\n", t.Instance, schemaName, t.Dir, err)
+					sps.report.AddCase(reportSuite, "audit", "").AddFinding(SeverityError, "skeema.audit", "%s", err)
+					if result != nil {
+						result.Error = err.Error()
 					}
+					sps.state.Fail(t, "%s", err)
+					sps.incrementErrCount(len(diff.TableDiffs) + 1)
+					continue
+				}
+			}
+
+			// If requested, determine which replicas' lag to monitor before running
+			// any DDL at all for this target
+			var throttler *LagThrottler
+			if !sps.dryRun && len(diff.TableDiffs) > 0 {
+				if throttler, err = NewLagThrottler(sps.interrupter.StopContext(), t); sps.interrupter.Stopping() {
+					return
+				} else if err != nil {
+					logger.Errorf("Skipping %s %s for %s: %s\n", t.Instance, schemaName, t.Dir, err)
+					sps.report.AddCase(reportSuite, "replicas", "").AddFinding(SeverityError, "skeema.replicas", "%s", err)
+					if result != nil {
+						result.Error = err.Error()
+					}
+					sps.state.Fail(t, "%s", err)
+					sps.incrementErrCount(len(diff.TableDiffs) + 1)
+					continue
 				}
 			}
 
 			if t.Dir.Config.GetBool("verify") && len(diff.TableDiffs) > 0 && !sps.briefOutput {
-				if err := t.verifyDiff(diff); err != nil {
+				if err := t.verifyDiff(sps.interrupter.StopContext(), diff); sps.interrupter.Stopping() {
+					return
+				} else if err != nil {
 					sps.setFatalError(err)
 					return
 				}
@@ -205,13 +367,67 @@ func pushWorker(sps *sharedPushState) {
 				sps.setFatalError(err)
 				return
 			}
-			ignoreTable, err := t.Dir.Config.GetRegexp("ignore-table")
-			if err != nil {
-				sps.setFatalError(err)
-				return
+			ddls := make([]*DDLStatement, len(diff.TableDiffs))
+			for n, tableDiff := range diff.TableDiffs {
+				ddls[n] = NewDDLStatement(tableDiff, mods, t)
+			}
+
+			// If requested, write a rollback script before running any DDL at all for
+			// this target
+			if !sps.dryRun && t.Dir.Config.Changed("rollback-dir") {
+				if err := sps.writeRollback(t, diff, ddls, ignoreTable); err != nil {
+					logger.Errorf("Skipping %s %s for %s: unable to write rollback script: %s\n", t.Instance, schemaName, t.Dir, err)
+					sps.report.AddCase(reportSuite, "rollback", "").AddFinding(SeverityError, "skeema.rollback", "%s", err)
+					if result != nil {
+						result.Error = err.Error()
+					}
+					sps.state.Fail(t, "Unable to write rollback script: %s", err)
+					sps.incrementErrCount(len(diff.TableDiffs) + 1)
+					continue
+				}
 			}
+
+			var targetStmtCount int
+			var interrupted bool
+
+			if diff.SchemaDDL != "" {
+				sps.syncPrintf(t.Instance, "", "%s;\n", diff.SchemaDDL)
+				if result != nil {
+					result.SchemaDDL = diff.SchemaDDL
+				}
+				targetStmtCount++
+				if !sps.dryRun {
+					var schemaErr error
+					start := time.Now()
+					if strings.HasPrefix(diff.SchemaDDL, "CREATE DATABASE") && t.SchemaFromInstance == nil {
+						t.SchemaFromInstance, err = t.Instance.CreateSchema(schemaName, t.SchemaFromDir.CharSet, t.SchemaFromDir.Collation)
+						if err != nil {
+							schemaErr = fmt.Errorf("Error creating schema %s on %s: %s", schemaName, t.Instance, err)
+						}
+					} else if strings.HasPrefix(diff.SchemaDDL, "ALTER DATABASE") {
+						err = t.Instance.AlterSchema(t.SchemaFromInstance, t.SchemaFromDir.CharSet, t.SchemaFromDir.Collation)
+						if err != nil {
+							schemaErr = fmt.Errorf("Unable to alter defaults for schema %s on %s: %s", t.SchemaFromInstance.Name, t.Instance, err)
+						}
+					} else {
+						sps.setFatalError(fmt.Errorf("Refusing to run unexpectedly-generated schema-level DDL: %s", diff.SchemaDDL))
+						return
+					}
+					if auditErr := sps.auditor.RecordSchemaDDL(t, diff.SchemaDDL, time.Since(start), err); auditErr != nil {
+						logger.Error(auditErr)
+						sps.incrementErrCount(1)
+					}
+					if schemaErr != nil {
+						sps.state.Fail(t, "%s", schemaErr)
+						sps.setFatalError(schemaErr)
+						return
+					}
+					sps.state.RecordStatement(t, "", diff.SchemaDDL)
+				}
+			}
+
 			for n, tableDiff := range diff.TableDiffs {
-				ddl := NewDDLStatement(tableDiff, mods, t)
+				ddl := ddls[n]
 				if ddl == nil {
 					// skip blank DDL (which may happen due to NextAutoInc modifier)
 					continue
@@ -228,40 +444,117 @@ func pushWorker(sps *sharedPushState) {
 					sps.setFatalError(fmt.Errorf("Unsupported diff type %T", td))
 					return
 				}
+				tableLogger := logger.WithField("table", tableName)
 				if ignoreTable != nil && ignoreTable.MatchString(tableName) {
-					log.Warnf("Skipping table %s because ignore-table='%s'", tableName, ignoreTable)
+					tableLogger.Warnf("Skipping table %s because ignore-table='%s'", tableName, ignoreTable)
 					continue
 				}
 				targetStmtCount++
 				sps.incrementDiffCount()
+				rc := sps.report.AddCase(reportSuite, tableName, path.Join(t.Dir.Path, tableName+".sql"))
+				if _, forbidden := ddl.Err.(*tengo.ForbiddenDiffError); forbidden {
+					rc.AddFinding(SeverityError, "skeema.unsafe", "%s", ddl.Err)
+				} else if ddl.Err != nil {
+					rc.AddFinding(SeverityError, "skeema.error", "%s", ddl.Err)
+				} else if tableDiffUnsafe(tableDiff) {
+					rc.AddFinding(SeverityWarning, "skeema.unsafe", "Statement is potentially destructive: %s", ddl.stmt)
+				}
+				tableLogger = tableLogger.WithField("statement", ddl.String())
 				if ddl.Err != nil {
-					log.Errorf("%s. The affected DDL statement will be skipped. See --help for more information.", ddl.Err)
+					tableLogger.Errorf("%s. The affected DDL statement will be skipped. See --help for more information.", ddl.Err)
 					sps.incrementErrCount(1)
+					sps.state.Fail(t, "Skipped DDL for table %s: %s", tableName, ddl.Err)
+				}
+				var tableDiffText string
+				if alter, ok := tableDiff.(tengo.AlterTable); ok && t.Dir.Config.GetBool("table-diff") {
+					tableDiffText = t.tableDiffComment(alter.Table.Name, sps.colorize)
 				}
-				sps.syncPrintf(t.Instance, schemaName, "%s\n", ddl.String())
-				if !sps.dryRun && ddl.Err == nil && ddl.Execute() != nil {
-					log.Errorf("Error running DDL on %s %s: %s", t.Instance, schemaName, ddl.Err)
+				sps.syncPrintf(t.Instance, schemaName, "%s%s\n", tableDiffText, ddl.String())
+				var tdr *TableDiffResult
+				if result != nil {
+					tdr = result.AddTableDiff(tableDiff, ddl)
+					if ddl.IsShellOut() {
+						// Keep external command output from corrupting the JSON document
+						ddl.shellOut.Stdout = os.Stderr
+					}
+				}
+				if sps.dryRun || ddl.Err != nil {
+					continue
+				}
+				if previousStatements[ddl.stmt] {
+					tableLogger.Warnf("State file indicates this statement already ran successfully, but it is needed again; running it again")
+				}
+				throttler.Wait(sps.interrupter.StopContext())
+				if sps.interrupter.Stopping() {
+					skipCount := len(diff.TableDiffs) - n
+					logger.Warnf("Due to interrupt, skipping %d remaining statement%s on %s %s", skipCount, pluralSuffix(skipCount), t.Instance, schemaName)
+					if result != nil {
+						result.Error = fmt.Sprintf("Skipped %d statement%s due to interrupt", skipCount, pluralSuffix(skipCount))
+					}
+					sps.incrementInterruptCount(skipCount)
+					sps.state.Fail(t, "Interrupted before running DDL for table %s", tableName)
+					interrupted = true
+					break
+				}
+				start := time.Now()
+				execErr := ddl.Execute(sps.interrupter.Context())
+				if auditErr := sps.auditor.RecordDDL(t, tableName, ddl, time.Since(start)); auditErr != nil {
+					tableLogger.Error(auditErr)
+					sps.incrementErrCount(1)
+				}
+				if tdr != nil {
+					tdr.Output = ddl.Output()
+				}
+				if execErr != nil {
+					tableLogger.Errorf("Error running DDL on %s %s: %s", t.Instance, schemaName, ddl.Err)
+					rc.AddFinding(SeverityError, "skeema.execute", "%s", ddl.Err)
+					if tdr != nil {
+						tdr.Error = ddl.Err.Error()
+					}
 					skipCount := len(diff.TableDiffs) - n
 					if skipCount > 1 {
-						log.Warnf("Due to previous error, skipping %d additional statements on %s %s", skipCount-1, t.Instance, schemaName)
+						logger.Warnf("Due to previous error, skipping %d additional statements on %s %s", skipCount-1, t.Instance, schemaName)
+						if result != nil {
+							result.Error = fmt.Sprintf("Skipped %d additional statements due to previous error", skipCount-1)
+						}
 					}
 					sps.incrementErrCount(skipCount)
+					sps.state.Fail(t, "Error running DDL for table %s: %s", tableName, ddl.Err)
 					break
 				}
+				sps.incrementExecCount()
+				sps.state.RecordStatement(t, tableName, ddl.stmt)
 			}
 			for _, table := range diff.UnsupportedTables {
 				sps.incrementUnsupportedCount()
+				if result != nil {
+					result.UnsupportedTables = append(result.UnsupportedTables, table.Name)
+				}
+				rc := sps.report.AddCase(reportSuite, table.Name, path.Join(t.Dir.Path, table.Name+".sql"))
+				rc.AddFinding(SeverityError, "skeema.unsupported", "Unable to generate ALTER TABLE due to use of unsupported features")
+				sps.state.Warn(t, "Unable to generate ALTER TABLE for table %s due to use of unsupported features", table.Name)
 				targetStmtCount++
+				tableLogger := logger.WithField("table", table.Name)
 				if t.Dir.Config.GetBool("debug") {
-					log.Warnf("Skipping table %s: unable to generate ALTER TABLE due to use of unsupported features", table.Name)
+					tableLogger.Warnf("Skipping table %s: unable to generate ALTER TABLE due to use of unsupported features", table.Name)
 					t.logUnsupportedTableDiff(table.Name)
 				} else {
-					log.Warnf("Skipping table %s: unable to generate ALTER TABLE due to use of unsupported features. Use --debug for more information.", table.Name)
+					tableLogger.Warnf("Skipping table %s: unable to generate ALTER TABLE due to use of unsupported features. Use --debug for more information.", table.Name)
+				}
+			}
+
+			if sps.plan != nil {
+				if err := sps.plan.AddTarget(t, result); err != nil {
+					sps.setFatalError(err)
+					return
 				}
 			}
 
+			sps.state.Finish(t)
 			if targetStmtCount == 0 {
-				log.Infof("%s %s: No differences found\n", t.Instance, schemaName)
+				logger.Infof("%s %s: No differences found\n", t.Instance, schemaName)
+			} else if interrupted {
+				logger.Warnf("%s %s: push interrupted\n", t.Instance, schemaName)
 			} else {
 				var verb string
 				if sps.dryRun {
@@ -269,12 +562,183 @@ func pushWorker(sps *sharedPushState) {
 				} else {
 					verb = "push"
 				}
-				log.Infof("%s %s: %s complete\n", t.Instance, schemaName, verb)
+				logger.Infof("%s %s: %s complete\n", t.Instance, schemaName, verb)
 			}
 		}
 	}
 }
 
+// tableDiffUnsafe returns true if tableDiff is potentially destructive: a
+// DROP TABLE, or an ALTER TABLE with at least one unsafe clause.
+func tableDiffUnsafe(tableDiff tengo.TableDiff) bool {
+	switch td := tableDiff.(type) {
+	case tengo.DropTable:
+		return true
+	case tengo.AlterTable:
+		for _, clause := range td.Clauses {
+			if clause.Unsafe() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeRollback writes a rollback script for the forward diff of t, if there
+// is anything to roll back. Only tables which have a valid DDL statement in
+// ddls, and which are not ignored, are included.
+func (sps *sharedPushState) writeRollback(t *Target, diff *tengo.SchemaDiff, ddls []*DDLStatement, ignoreTable *regexp.Regexp) error {
+	included := make(map[string]bool)
+	for n, tableDiff := range diff.TableDiffs {
+		if ddls[n] == nil || ddls[n].Err != nil {
+			continue
+		}
+		var tableName string
+		switch td := tableDiff.(type) {
+		case tengo.CreateTable:
+			tableName = td.Table.Name
+		case tengo.DropTable:
+			tableName = td.Table.Name
+		case tengo.AlterTable:
+			tableName = td.Table.Name
+		}
+		if ignoreTable == nil || !ignoreTable.MatchString(tableName) {
+			included[tableName] = true
+		}
+	}
+	script, err := RollbackScript(t, diff, included, sps.startTime)
+	if err != nil || script == "" {
+		return err
+	}
+	rollbackPath := rollbackPath(t.Dir.optionPath("rollback-dir"), t, sps.startTime)
+	if err := writeRollbackScript(rollbackPath, script); err != nil {
+		return err
+	}
+	t.Logger().Infof("Wrote rollback script for %s %s to %s", t.Instance, t.SchemaFromDir.Name, rollbackPath)
+	return nil
+}
+
+// openPushState returns the PushState to use for tracking progress in the
+// file at statePath, or nil if no state file is in use. If the resume option
+// is enabled, the state is read from the existing file; otherwise, a new file
+// is written, unless an existing file still has pending targets.
+func openPushState(statePath string, cfg *mybase.Config) (*PushState, error) {
+	resume := cfg.GetBool("resume")
+	if resume && statePath == "" {
+		return nil, NewExitValue(CodeBadConfig, "Option resume requires option state-file")
+	} else if statePath == "" || cfg.GetBool("dry-run") {
+		return nil, nil
+	}
+	environment := cfg.Get("environment")
+	existing, err := ReadPushState(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, NewExitValue(CodeBadInput, "%s", err)
+	}
+
+	if resume {
+		if existing == nil {
+			return nil, NewExitValue(CodeNoInput, "Cannot resume: state file %s does not exist", statePath)
+		} else if existing.Environment != environment {
+			return nil, NewExitValue(CodeBadConfig, "Cannot resume: state file %s is for environment \"%s\", but environment \"%s\" is in use", statePath, existing.Environment, environment)
+		}
+		pendingCount := len(existing.Pending())
+		log.Infof("Resuming push from state file %s: %d target%s already complete, %d pending", statePath, len(existing.Targets)-pendingCount, pluralSuffix(len(existing.Targets)-pendingCount), pendingCount)
+		return existing, nil
+	}
+
+	if existing != nil {
+		if pendingCount := len(existing.Pending()); pendingCount > 0 {
+			return nil, NewExitValue(CodeBadConfig, "State file %s has %d pending target%s from a previous push. Use --resume to continue that push, or remove the file to start over.", statePath, pendingCount, pluralSuffix(pendingCount))
+		}
+	}
+	state := NewPushState(statePath, environment)
+	if err := state.Write(); err != nil {
+		return nil, NewExitValue(CodeCantCreate, "Unable to write state file %s: %s", statePath, err)
+	}
+	return state, nil
+}
+
+// queueTargetGroups records all targets from groups as pending in state, and
+// returns a new channel supplying the same TargetGroups. This way, the state
+// file lists every target, even if workers stop early due to an interrupt or
+// fatal error. Since all targets are generated before the first TargetGroup is
+// supplied by the original channel, this does not delay the workers.
+func queueTargetGroups(groups <-chan TargetGroup, state *PushState) <-chan TargetGroup {
+	var all []TargetGroup
+	var targets []*Target
+	for tg := range groups {
+		all = append(all, tg)
+		targets = append(targets, tg...)
+	}
+	state.Queue(targets)
+	queued := make(chan TargetGroup, len(all))
+	for _, tg := range all {
+		queued <- tg
+	}
+	close(queued)
+	return queued
+}
+
+// logPendingTargets logs the targets in state which are not yet complete,
+// along with the most recent error for each.
+func logPendingTargets(state *PushState, statePath string) {
+	pending := state.Pending()
+	if len(pending) == 0 {
+		log.Infof("All targets in state file %s are complete", statePath)
+		return
+	}
+	log.Warnf("%d target%s still pending in state file %s. Run push again with --resume to continue:", len(pending), pluralSuffix(len(pending)), statePath)
+	for _, ts := range pending {
+		reason := ts.Error
+		if reason == "" {
+			reason = "not attempted, or interrupted"
+		}
+		if ts.Instance == "" {
+			log.Warnf("  %s: %s", ts.Dir, reason)
+		} else if ts.Schema == "" {
+			log.Warnf("  %s for %s: %s", ts.Instance, ts.Dir, reason)
+		} else {
+			log.Warnf("  %s %s for %s: %s", ts.Instance, ts.Schema, ts.Dir, reason)
+		}
+	}
+}
+
+// addResult returns a new TargetResult for t, tracking it for subsequent JSON
+// output or plan file. If neither is in use, nil is returned.
+func (sps *sharedPushState) addResult(t *Target) *TargetResult {
+	if !sps.jsonOutput && sps.plan == nil {
+		return nil
+	}
+	result := NewTargetResult(t)
+	sps.Lock()
+	sps.results = append(sps.results, result)
+	sps.Unlock()
+	return result
+}
+
+// writeJSON outputs the results of all workers to STDOUT as a single JSON
+// document. This must only be called once all workers have completed.
+func (sps *sharedPushState) writeJSON(cfg *mybase.Config) error {
+	pr := &PushResult{
+		Command:     cfg.CLI.Command.Name,
+		Environment: cfg.Get("environment"),
+		DryRun:      sps.dryRun,
+		Targets:     sps.results,
+		Summary: PushSummary{
+			Differences: sps.diffCount,
+			Errors:      sps.errCount,
+			Unsupported: sps.unsupportedCount,
+		},
+	}
+	if pr.Targets == nil {
+		pr.Targets = []*TargetResult{}
+	}
+	if sps.fatalError != nil {
+		pr.Error = sps.fatalError.Error()
+	}
+	return pr.WriteJSON(os.Stdout)
+}
+
 func (sps *sharedPushState) incrementErrCount(n int) {
 	sps.Lock()
 	sps.errCount += n
@@ -293,6 +757,31 @@ func (sps *sharedPushState) incrementUnsupportedCount() {
 	sps.Unlock()
 }
 
+func (sps *sharedPushState) incrementExecCount() {
+	sps.Lock()
+	sps.execCount++
+	sps.Unlock()
+}
+
+func (sps *sharedPushState) incrementInterruptCount(n int) {
+	sps.Lock()
+	sps.interruptCount += n
+	sps.Unlock()
+}
+
+// interruptedExitValue returns an ExitValue summarizing a push which was
+// stopped by an interrupt.
+func (sps *sharedPushState) interruptedExitValue() *ExitValue {
+	summary := fmt.Sprintf("Interrupted after running %d statement%s", sps.execCount, pluralSuffix(sps.execCount))
+	if sps.interruptCount > 0 {
+		summary += fmt.Sprintf("; skipped %d remaining statement%s on targets in progress", sps.interruptCount, pluralSuffix(sps.interruptCount))
+	}
+	if skipCount := sps.errCount + sps.unsupportedCount; skipCount > 0 {
+		summary += fmt.Sprintf("; skipped %d operation%s due to errors or unsupported features", skipCount, pluralSuffix(skipCount))
+	}
+	return NewExitValue(CodeInterrupted, "%s. Targets not yet started were not processed.", summary)
+}
+
 func (sps *sharedPushState) setFatalError(err error) {
 	sps.Lock()
 	if sps.fatalError == nil {
@@ -303,9 +792,14 @@ func (sps *sharedPushState) setFatalError(err error) {
 
 // syncPrintf prevents interleaving of STDOUT output from multiple workers.
 // It also adds instance and schema lines before output if the previous STDOUT
-// was for a different instance or schema.
-// TODO: buffer output from external commands and also prevent interleaving there
+// was for a different instance or schema. Nothing is output if JSON output is
+// in use, since results are instead output as a single document once all
+// workers have completed. Output from external commands is handled separately,
+// according to the wrapper-output option.
 func (sps *sharedPushState) syncPrintf(instance *tengo.Instance, schemaName string, format string, a ...interface{}) {
+	if sps.jsonOutput {
+		return
+	}
 	sps.Lock()
 	defer sps.Unlock()
 
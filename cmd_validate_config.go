@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/skeema/mybase"
+)
+
+func init() {
+	summary := "Check all option files for unknown options and invalid values"
+	desc := `Parses every global option file, every .skeema file in the current directory's
+parent hierarchy, and every .skeema file in the current directory tree, along
+with any files they include via !include or !includedir. Every section of each
+file is checked, regardless of environment. This command verifies that option
+files have valid syntax, that all option names are known (suggesting the
+closest match for any that aren't), and that option values are valid for
+options which accept a limited set of values. Options which are only read
+globally, such as log-format, are reported if set in a .skeema file.
+
+This command does not connect to any database instances.
+
+An exit code of 0 will be returned if no problems were found, or 78 if at least
+one problem was found.`
+
+	cmd := mybase.NewCommand("validate-config", summary, desc, ValidateConfigHandler)
+	CommandSuite.AddSubCommand(cmd)
+}
+
+// ValidateConfigHandler is the handler method for `skeema validate-config`
+func ValidateConfigHandler(cfg *mybase.Config) error {
+	// Validators use cfg.CLI.Command to interpret values, so it needs to know
+	// about all options that may be set in .skeema files
+	addRecursiveCommandOptions(cfg.CLI.Command)
+	cfg.MarkDirty()
+
+	var files []*mybase.File
+	myCnf := make(map[*mybase.File]bool)
+	for _, path := range globalOptionFilePaths() {
+		f := mybase.NewFile(path)
+		if f.Exists() {
+			files = append(files, f)
+			myCnf[f] = strings.HasSuffix(path, ".my.cnf")
+		}
+	}
+
+	globalCount := len(files)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	dir := &Dir{Path: cwd, Config: cfg}
+	dirFiles, err := dir.cascadingOptionFiles()
+	if err != nil {
+		return NewExitValue(CodeBadInput, "Unable to read option file: %s", err)
+	}
+	for _, f := range dirFiles {
+		files = append(files, f.File)
+	}
+
+	// Walk the directory tree for all other .skeema files. The current dir's
+	// file has already been handled by cascadingOptionFiles.
+	err = filepath.Walk(dir.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != dir.Path && info.Name()[0] == '.' {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && info.Name() == ".skeema" && filepath.Dir(path) != dir.Path {
+			files = append(files, mybase.NewFile(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return NewExitValue(CodeBadInput, "Unable to walk directory tree: %s", err)
+	}
+
+	problems, checkedCount := validateOptionFiles(cfg, files, myCnf)
+	for _, f := range files[globalCount:] {
+		problems = append(problems, globalOnlyOptionProblems(f)...)
+	}
+	for _, problem := range problems {
+		log.Error(problem)
+	}
+	problemCount := len(problems)
+
+	if problemCount > 0 {
+		var plural string
+		if problemCount > 1 {
+			plural = "s"
+		}
+		return NewExitValue(CodeBadConfig, "Found %d problem%s in option files", problemCount, plural)
+	}
+	log.Infof("Checked %d option files: no problems found", checkedCount)
+	return nil
+}
+
+// validateOptionFiles checks each of files, along with any files they include
+// via !include or !includedir, using validateOptionFile. Files included by a
+// file in ignoreUnknown are also permitted to contain unknown options. Each
+// distinct path is only checked once. A slice of problem descriptions is
+// returned, along with the number of files checked.
+func validateOptionFiles(cfg *mybase.Config, files []*mybase.File, ignoreUnknown map[*mybase.File]bool) (problems []string, checkedCount int) {
+	checked := make(map[string]bool)
+	var helper func(f *mybase.File, ignoreUnknown bool)
+	helper = func(f *mybase.File, ignoreUnknown bool) {
+		if checked[f.Path()] {
+			return
+		}
+		checked[f.Path()] = true
+		fileProblems := validateOptionFile(cfg, f, ignoreUnknown)
+		problems = append(problems, fileProblems...)
+
+		// OptionFile resolves directives, but stops at the first unknown option; so
+		// it is used here only to find included files and to report problems with
+		// the directives themselves. Errors already reported above are skipped.
+		of := NewOptionFile(f.Path())
+		of.IgnoreUnknownOptions = true
+		if err := of.Parse(cfg); err != nil {
+			for _, problem := range fileProblems {
+				if problem == err.Error() {
+					return
+				}
+			}
+			problems = append(problems, err.Error())
+			return
+		}
+		for _, included := range of.IncludedFiles() {
+			// Use a fresh File, since included already contains values merged in from
+			// its own includes
+			helper(mybase.NewFile(included.Path()), ignoreUnknown)
+		}
+	}
+	for _, f := range files {
+		helper(f, ignoreUnknown[f])
+	}
+	return problems, len(checked)
+}
+
+// validateOptionFile checks a single option file for syntax errors, unknown
+// option names, and invalid option values in any section. Unknown option names
+// are permitted if ignoreUnknown is true, as is the case with ~/.my.cnf. A
+// slice of problem descriptions is returned. If the file cannot be parsed,
+// unknown option names are still reported, but option values are not checked.
+func validateOptionFile(cfg *mybase.Config, f *mybase.File, ignoreUnknown bool) (problems []string) {
+	if err := f.Read(); err != nil {
+		return []string{err.Error()}
+	}
+
+	// Unknown options are checked separately, using the raw contents, in order to
+	// find all of them rather than just the first one
+	f.IgnoreUnknownOptions = true
+	parseErr := f.Parse(cfg)
+	if parseErr != nil {
+		problems = append(problems, parseErr.Error())
+	}
+	if !ignoreUnknown {
+		contents, err := ioutil.ReadFile(f.Path())
+		if err != nil {
+			return append(problems, err.Error())
+		}
+		problems = append(problems, unknownOptionProblems(cfg, f.Path(), string(contents))...)
+	}
+	if parseErr != nil {
+		return problems
+	}
+
+	names := make([]string, 0, len(optionValidators))
+	for name := range optionValidators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, section := range f.SectionsWithOption(name) {
+			_ = f.UseSection(section) // can ignore error since section is known to exist
+			value, _ := f.OptionValue(name)
+			if err := validateOptionValue(cfg.CLI.Command, name, value); err != nil {
+				location := f.Path()
+				if section != "" {
+					location = fmt.Sprintf("%s [%s]", location, section)
+				}
+				problems = append(problems, fmt.Sprintf("%s: %s", location, err))
+			}
+		}
+	}
+	return problems
+}
+
+// globalOnlyOptions lists options which are only read from global option files,
+// the command-line, or environment variables. Setting them in a per-directory
+// option file has no effect.
+var globalOnlyOptions = []string{"log-format"}
+
+// globalOnlyOptionProblems returns a problem description for each section of a
+// per-directory option file which sets an option in globalOnlyOptions. f must
+// already be parsed.
+func globalOnlyOptionProblems(f *mybase.File) (problems []string) {
+	for _, name := range globalOnlyOptions {
+		for _, section := range f.SectionsWithOption(name) {
+			location := f.Path()
+			if section != "" {
+				location = fmt.Sprintf("%s [%s]", location, section)
+			}
+			problems = append(problems, fmt.Sprintf("%s: option %s has no effect in a per-directory option file; set it in a global option file, on the command-line, or via an environment variable instead", location, name))
+		}
+	}
+	return problems
+}
+
+// unknownOptionProblems scans the raw contents of an option file, returning a
+// problem description for each line that refers to an unknown option. Lines
+// using the loose- prefix are permitted to refer to unknown options.
+func unknownOptionProblems(cfg *mybase.Config, path, contents string) (problems []string) {
+	var lineNumber int
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.ContainsRune("#;[!", rune(line[0])) {
+			continue
+		}
+		if pos := strings.IndexAny(line, "=#"); pos > -1 {
+			line = line[0:pos]
+		}
+		name, _, _, loose := mybase.NormalizeOptionToken(line)
+		if name == "" || loose || cfg.FindOption(name) != nil {
+			continue
+		}
+		problem := fmt.Sprintf("%s line %d: unknown option \"%s\"", path, lineNumber, name)
+		if suggestion := closestOptionName(name); suggestion != "" {
+			problem = fmt.Sprintf("%s (did you mean \"%s\"?)", problem, suggestion)
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// validateOptionValue returns an error if value is not a valid value for the
+// named option. Options without a registered validator, or that are not known
+// to cmd, are always considered valid.
+func validateOptionValue(cmd *mybase.Command, name, value string) error {
+	validator, ok := optionValidators[name]
+	if !ok {
+		return nil
+	}
+	if _, ok := cmd.Options()[name]; !ok {
+		return nil
+	}
+	cli := &mybase.CommandLine{
+		Command:      cmd,
+		OptionValues: map[string]string{name: value},
+	}
+	return validator(mybase.NewConfig(cli), name)
+}
+
+// closestOptionName returns the name of the known option which is most similar
+// to name, or an empty string if no option is similar enough to be a likely
+// typo.
+func closestOptionName(name string) string {
+	var best string
+	bestDistance := len(name)/3 + 1
+	if bestDistance < 3 {
+		bestDistance = 3
+	}
+	for _, candidate := range knownOptionNames() {
+		if distance := levenshteinDistance(name, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// knownOptionNames returns a sorted list of every option name in any command.
+func knownOptionNames() []string {
+	seen := make(map[string]bool)
+	var helper func(*mybase.Command)
+	helper = func(cmd *mybase.Command) {
+		for name := range cmd.Options() {
+			seen[name] = true
+		}
+		for _, sub := range cmd.SubCommands {
+			helper(sub)
+		}
+	}
+	helper(CommandSuite)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// levenshteinDistance returns the minimum number of single-character
+// insertions, deletions, or substitutions needed to transform a into b.
+func levenshteinDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
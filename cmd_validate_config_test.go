@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/skeema/mybase"
+)
+
+func TestLevenshteinDistance(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"alter-wrapper", "alter-wrapper", 0},
+		{"alter-wraper", "alter-wrapper", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, c := range cases {
+		if actual := levenshteinDistance(c.a, c.b); actual != c.expected {
+			t.Errorf("Expected levenshteinDistance(%q, %q) to return %d, instead found %d", c.a, c.b, c.expected, actual)
+		}
+	}
+}
+
+func TestClosestOptionName(t *testing.T) {
+	AddGlobalOptions(CommandSuite)
+	assertClosest := func(name, expected string) {
+		if actual := closestOptionName(name); actual != expected {
+			t.Errorf("Expected closestOptionName(%q) to return %q, instead found %q", name, expected, actual)
+		}
+	}
+	assertClosest("alter-wraper", "alter-wrapper")
+	assertClosest("ignore-tables", "ignore-table")
+	assertClosest("conect-options", "connect-options")
+	assertClosest("totally-unrelated-thing", "")
+}
+
+func TestValidateOptionValue(t *testing.T) {
+	AddGlobalOptions(CommandSuite)
+	cmd := CommandSuite.SubCommands["validate-config"]
+	addRecursiveCommandOptions(cmd)
+	assertValid := func(name, value string, expectValid bool) {
+		err := validateOptionValue(cmd, name, value)
+		if expectValid && err != nil {
+			t.Errorf("Expected %s=%s to be valid, instead found error %s", name, value, err)
+		} else if !expectValid && err == nil {
+			t.Errorf("Expected %s=%s to be invalid, but no error returned", name, value)
+		}
+	}
+	assertValid("alter-lock", "none", true)
+	assertValid("alter-lock", "nonee", false)
+	assertValid("alter-algorithm", "INPLACE", true)
+	assertValid("alter-algorithm", "instant", false)
+	assertValid("safe-below-size", "10M", true)
+	assertValid("safe-below-size", "10X", false)
+	assertValid("concurrent-instances", "4", true)
+	assertValid("concurrent-instances", "four", false)
+	assertValid("ignore-table", "^_", true)
+	assertValid("ignore-table", "[unterminated", false)
+	assertValid("connect-options", "sql_mode='STRICT_ALL_TABLES',wait_timeout=300", true)
+	assertValid("connect-options", "foo=bar,", false)
+	assertValid("output-format", "JSON", true)
+	assertValid("output-format", "yaml", false)
+	assertValid("alter-wrapper", "anything goes", true)
+}
+
+func TestValidateOptionFilesIncludes(t *testing.T) {
+	if _, ok := CommandSuite.Options()["host"]; !ok {
+		AddGlobalOptions(CommandSuite)
+	}
+	root := optionFileTestDir(t, map[string]string{
+		".skeema":         "host=127.0.0.1\n!include shared.cnf\n!includedir conf.d\n",
+		"shared.cnf":      "alter-wraper=echo\n!include nested.cnf\n",
+		"nested.cnf":      "[production]\nalter-lock=nonee\n",
+		"conf.d/a.cnf":    "port=3306\n!include ../shared.cnf\n",
+		"other/.skeema":   "!include ../shared.cnf\n",
+		"missing/.skeema": "!include nope.cnf\n",
+		"my/.my.cnf":      "!include extra.cnf\n",
+		"my/extra.cnf":    "totally-unknown=1\nalter-lock=nonee\n",
+		"bad/.skeema":     "alter-wraper=echo\n[production\nhost=db1\n",
+	})
+	defer os.RemoveAll(root)
+	cfg := mybase.ParseFakeCLI(t, CommandSuite, "skeema validate-config")
+	addRecursiveCommandOptions(cfg.CLI.Command)
+	cfg.MarkDirty()
+
+	// Problems in included files, including nested ones, are reported once each
+	// even if multiple files include them
+	main := mybase.NewFile(root, ".skeema")
+	other := mybase.NewFile(root, "other", ".skeema")
+	problems, checkedCount := validateOptionFiles(cfg, []*mybase.File{main, other}, nil)
+	if checkedCount != 5 {
+		t.Errorf("Expected 5 files to be checked, instead found %d", checkedCount)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, instead found %d: %v", len(problems), problems)
+	}
+	if !strings.Contains(problems[0], "shared.cnf line 1") || !strings.Contains(problems[0], `did you mean "alter-wrapper"`) {
+		t.Errorf("Unexpected problem for typo in included file: %s", problems[0])
+	}
+	if !strings.Contains(problems[1], "nested.cnf [production]") {
+		t.Errorf("Unexpected problem for invalid value in nested included file: %s", problems[1])
+	}
+
+	// Missing included files are reported
+	problems, _ = validateOptionFiles(cfg, []*mybase.File{mybase.NewFile(root, "missing", ".skeema")}, nil)
+	if len(problems) != 1 || !strings.Contains(problems[0], "nope.cnf") {
+		t.Errorf("Unexpected problems for missing included file: %v", problems)
+	}
+
+	// Unknown options are still reported in files with syntax errors
+	problems = validateOptionFile(cfg, mybase.NewFile(root, "bad", ".skeema"), false)
+	if len(problems) != 2 || !strings.Contains(problems[1], `unknown option "alter-wraper"`) {
+		t.Errorf("Unexpected problems for file with syntax error: %v", problems)
+	}
+
+	// Files included by a file permitting unknown options also permit them
+	myCnf := mybase.NewFile(root, "my", ".my.cnf")
+	problems, _ = validateOptionFiles(cfg, []*mybase.File{myCnf}, map[*mybase.File]bool{myCnf: true})
+	if len(problems) != 1 || !strings.Contains(problems[0], "extra.cnf") || !strings.Contains(problems[0], "alter-lock") {
+		t.Errorf("Unexpected problems for file included by .my.cnf: %v", problems)
+	}
+}
+
+func TestGlobalOnlyOptionProblems(t *testing.T) {
+	if _, ok := CommandSuite.Options()["host"]; !ok {
+		AddGlobalOptions(CommandSuite)
+	}
+	root := optionFileTestDir(t, map[string]string{
+		".skeema": "log-format=json\n[production]\ndebug\nhost=db1\n",
+	})
+	defer os.RemoveAll(root)
+	cfg := mybase.ParseFakeCLI(t, CommandSuite, "skeema validate-config")
+	f := mybase.NewFile(root, ".skeema")
+	if err := f.Parse(cfg); err != nil {
+		t.Fatalf("Unexpected error from Parse: %s", err)
+	}
+	problems := globalOnlyOptionProblems(f)
+	if len(problems) != 1 || !strings.Contains(problems[0], ".skeema: option log-format") {
+		t.Errorf("Unexpected result from globalOnlyOptionProblems: %v", problems)
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"github.com/skeema/mybase"
+	"github.com/skeema/tengo"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -30,15 +31,42 @@ func AddGlobalOptions(cmd *mybase.Command) {
 	cmd.AddOption(mybase.StringOption("ignore-table", 0, "", "Ignore tables that match regex").Hidden())
 	cmd.AddOption(mybase.StringOption("default-character-set", 0, "", "Schema-level default character set").Hidden())
 	cmd.AddOption(mybase.StringOption("default-collation", 0, "", "Schema-level default collation").Hidden())
+	cmd.AddOption(mybase.StringOption("naming-table", 0, "", "Require table names to match regex").Hidden())
+	cmd.AddOption(mybase.StringOption("naming-column", 0, "", "Require column names to match regex").Hidden())
+	cmd.AddOption(mybase.StringOption("naming-index", 0, "", "Require index names to match regex").Hidden())
+	cmd.AddOption(mybase.StringOption("naming-unique-index", 0, "", "Require unique index names to match regex").Hidden())
+	cmd.AddOption(mybase.StringOption("naming-foreign-key", 0, "", "Require foreign key constraint names to match regex").Hidden())
 
 	// Visible global options
 	cmd.AddOption(mybase.StringOption("user", 'u', "root", "Username to connect to database host"))
 	cmd.AddOption(mybase.StringOption("password", 'p', "<no password>", "Password for database user; supply with no value to prompt").ValueOptional())
+	cmd.AddOption(mybase.StringOption("password-file", 0, "", "Read password for database user from this file, if password option not set"))
 	cmd.AddOption(mybase.StringOption("host-wrapper", 'H', "", "External bin to shell out to for host lookup; see manual for template vars"))
 	cmd.AddOption(mybase.StringOption("temp-schema", 't', "_skeema_tmp", "Name of temporary schema for intermediate operations, created and dropped each run unless --reuse-temp-schema"))
+	cmd.AddOption(mybase.StringOption("history-schema", 0, "", "Name of schema for recording history of push on each instance; history is not recorded if empty"))
 	cmd.AddOption(mybase.StringOption("connect-options", 'o', "", "Comma-separated session options to set upon connecting to each database instance"))
+	cmd.AddOption(mybase.StringOption("ssl-mode", 0, "", `Security state of connections to database instances (valid values: "DISABLED", "PREFERRED", "REQUIRED", "VERIFY_CA", "VERIFY_IDENTITY")`))
+	cmd.AddOption(mybase.StringOption("ssl-ca", 0, "", "Path to file containing trusted SSL certificate authorities for connecting to database instances"))
+	cmd.AddOption(mybase.StringOption("ssl-cert", 0, "", "Path to client SSL certificate file for connecting to database instances"))
+	cmd.AddOption(mybase.StringOption("ssl-key", 0, "", "Path to client SSL private key file for connecting to database instances"))
+	cmd.AddOption(mybase.StringOption("ssh-host", 0, "", "Connect to database instances through an SSH tunnel via this bastion host"))
+	cmd.AddOption(mybase.StringOption("ssh-user", 0, "", "Username for ssh-host; defaults to current OS user"))
+	cmd.AddOption(mybase.StringOption("ssh-key", 0, "", "Path to private key file for ssh-host; defaults to keys in ~/.ssh and SSH agent"))
 	cmd.AddOption(mybase.BoolOption("reuse-temp-schema", 0, false, "Do not drop temp-schema when done"))
 	cmd.AddOption(mybase.BoolOption("debug", 0, false, "Enable debug logging"))
+	cmd.AddOption(mybase.StringOption("log-format", 0, "text", `Format of log output to STDERR (valid values: "text", "json"); not read from per-directory option files`))
+}
+
+// globalOptionFilePaths returns the paths of all global option files that
+// Skeema checks, in order from lowest priority to highest priority. The files
+// need not exist.
+func globalOptionFilePaths() []string {
+	paths := []string{"/etc/skeema", "/usr/local/etc/skeema"}
+	home := filepath.Clean(os.Getenv("HOME"))
+	if home != "" {
+		paths = append(paths, path.Join(home, ".my.cnf"), path.Join(home, ".skeema"))
+	}
+	return paths
 }
 
 // AddGlobalConfigFiles takes the mybase.Config generated from the CLI and adds
@@ -46,13 +74,8 @@ func AddGlobalOptions(cmd *mybase.Command) {
 // options. Generally, subcommand handlers should call AddGlobalConfigFiles at
 // the top of the method.
 func AddGlobalConfigFiles(cfg *mybase.Config) {
-	globalFilePaths := []string{"/etc/skeema", "/usr/local/etc/skeema"}
-	home := filepath.Clean(os.Getenv("HOME"))
-	if home != "" {
-		globalFilePaths = append(globalFilePaths, path.Join(home, ".my.cnf"), path.Join(home, ".skeema"))
-	}
-	for _, path := range globalFilePaths {
-		f := mybase.NewFile(path)
+	for _, path := range globalOptionFilePaths() {
+		f := NewOptionFile(path)
 		if !f.Exists() {
 			continue
 		}
@@ -76,9 +99,14 @@ func AddGlobalConfigFiles(cfg *mybase.Config) {
 		cfg.AddSource(f)
 	}
 
+	// Environment variables override global option files, but not per-directory
+	// option files or the command-line
+	cfg.AddSource(EnvOptionValuer{Prefix: EnvOptionPrefix})
+
 	// The host and schema options are special -- most commands only expect
 	// to find them when recursively crawling directory configs. So if these
-	// options have been set globally (via CLI or a global config file), and
+	// options have been set globally (via CLI, a global config file, or an
+	// environment variable), and
 	// the current subcommand hasn't explicitly overridden these options (as
 	// init and add-environment do), silently ignore the value.
 	for _, name := range []string{"host", "schema"} {
@@ -99,11 +127,53 @@ func AddGlobalConfigFiles(cfg *mybase.Config) {
 		fmt.Println()
 	}
 
+	if logFormat, err := cfg.GetEnum("log-format", "json"); err != nil {
+		Exit(NewExitValue(CodeBadConfig, "%s", err))
+	} else {
+		setLogFormat(logFormat)
+	}
 	if cfg.GetBool("debug") {
 		log.SetLevel(log.DebugLevel)
 	}
 }
 
+// EnvOptionPrefix is the prefix used for environment variable names that
+// correspond to options.
+const EnvOptionPrefix = "SKEEMA_"
+
+// EnvOptionValuer is a mybase.OptionValuer which obtains option values from
+// environment variables. The variable name for an option is formed by
+// upper-casing the option name, replacing dashes with underscores, and adding
+// Prefix. For example, with a Prefix of "SKEEMA_", the value for option
+// connect-options is obtained from variable SKEEMA_CONNECT_OPTIONS.
+type EnvOptionValuer struct {
+	Prefix string
+}
+
+// VarName returns the name of the environment variable corresponding to the
+// supplied option name.
+func (ev EnvOptionValuer) VarName(optionName string) string {
+	return ev.Prefix + strings.ToUpper(strings.Replace(optionName, "-", "_", -1))
+}
+
+// OptionValue returns the value of the environment variable corresponding to
+// optionName, if that variable is set. This satisfies the mybase.OptionValuer
+// interface.
+func (ev EnvOptionValuer) OptionValue(optionName string) (string, bool) {
+	return os.LookupEnv(ev.VarName(optionName))
+}
+
+// OnCLIOrEnv returns true if the specified option name was set on the
+// command-line or via an environment variable. Panics if the option does not
+// exist.
+func OnCLIOrEnv(cfg *mybase.Config, name string) bool {
+	if cfg.OnCLI(name) {
+		return true
+	}
+	_, fromEnv := cfg.Source(name).(EnvOptionValuer)
+	return fromEnv
+}
+
 // PromptPassword reads a password from STDIN without echoing the typed
 // characters. Requires that STDIN is a TTY.
 func PromptPassword() (string, error) {
@@ -233,3 +303,94 @@ func RealConnectOptions(connectOpts string) (string, error) {
 	}
 	return connectOpts, nil
 }
+
+// OptionValidator is a function that checks whether the named option has a
+// valid value in cfg, returning a descriptive error if not.
+type OptionValidator func(cfg *mybase.Config, name string) error
+
+// qualifiedTableName converts a value of the named option, which must be in
+// format "schema.table", into an escaped identifier.
+func qualifiedTableName(optionName, value string) (string, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("Option %s must be in format schema.table; found %q", optionName, value)
+	}
+	return fmt.Sprintf("%s.%s", tengo.EscapeIdentifier(parts[0]), tengo.EscapeIdentifier(parts[1])), nil
+}
+
+// optionValidators maps option names to functions which validate their
+// values. This is used by `skeema validate-config` to check option values in
+// option files without needing to execute any other command logic. Any new
+// option with restrictions on its value should have an entry here.
+var optionValidators = map[string]OptionValidator{
+	"alter-algorithm":        enumValidator("INPLACE", "COPY", "DEFAULT"),
+	"alter-lock":             enumValidator("NONE", "SHARED", "EXCLUSIVE", "DEFAULT"),
+	"alter-wrapper-min-size": bytesValidator,
+	"safe-below-size":        bytesValidator,
+	"concurrent-instances":   intValidator,
+	"port":                   intValidator,
+	"ignore-schema":          regexpValidator,
+	"ignore-table":           regexpValidator,
+	"naming-table":           regexpValidator,
+	"naming-column":          regexpValidator,
+	"naming-index":           regexpValidator,
+	"naming-unique-index":    regexpValidator,
+	"naming-foreign-key":     regexpValidator,
+	"connect-options":        connectOptionsValidator,
+	"output-format":          enumValidator("json"),
+	"log-format":             enumValidator("json"),
+	"report-format":          enumValidator("junit", "checkstyle"),
+	"ssl-mode":               enumValidator("DISABLED", "PREFERRED", "REQUIRED", "VERIFY_CA", "VERIFY_IDENTITY"),
+	"audit-table":            qualifiedTableValidator,
+	"heartbeat-table":        qualifiedTableValidator,
+	"max-replica-lag":        intValidator,
+	"lock-wait-timeout":      intValidator,
+	"max-transaction-age":    intValidator,
+	"lock-wait-retries":      intValidator,
+	"lock-wait-retry-delay":  intValidator,
+	"osc-tool":               enumValidator("pt-osc", "gh-ost"),
+	"wrapper-output":         enumValidator("prefix", "buffer"),
+	"statement-timeout":      intValidator,
+	"drift-format":           enumValidator("prometheus"),
+}
+
+func enumValidator(allowedValues ...string) OptionValidator {
+	return func(cfg *mybase.Config, name string) error {
+		_, err := cfg.GetEnum(name, allowedValues...)
+		return err
+	}
+}
+
+func bytesValidator(cfg *mybase.Config, name string) error {
+	if _, err := cfg.GetBytes(name); err != nil {
+		return fmt.Errorf("Option %s must be a byte size, optionally with K, M, or G suffix; found %q", name, cfg.Get(name))
+	}
+	return nil
+}
+
+func intValidator(cfg *mybase.Config, name string) error {
+	if _, err := cfg.GetInt(name); err != nil {
+		return fmt.Errorf("Option %s must be an integer; found %q", name, cfg.Get(name))
+	}
+	return nil
+}
+
+func regexpValidator(cfg *mybase.Config, name string) error {
+	_, err := cfg.GetRegexp(name)
+	return err
+}
+
+func connectOptionsValidator(cfg *mybase.Config, name string) error {
+	if _, err := SplitConnectOptions(cfg.Get(name)); err != nil {
+		return fmt.Errorf("Option %s has invalid syntax: %s", name, err)
+	}
+	return nil
+}
+
+func qualifiedTableValidator(cfg *mybase.Config, name string) error {
+	if value := cfg.Get(name); value != "" {
+		_, err := qualifiedTableName(name, value)
+		return err
+	}
+	return nil
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"os"
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/skeema/mybase"
 )
 
 func TestSplitConnectOptions(t *testing.T) {
@@ -64,3 +67,57 @@ func TestRealConnectOptions(t *testing.T) {
 	assertResult("strict=1,foo=2,charset='utf8mb4,utf8'", "foo=2")
 	assertResult("timeout=10ms,TIMEOUT=20ms,timeOut=30ms", "")
 }
+
+func TestEnvOptionValuer(t *testing.T) {
+	ev := EnvOptionValuer{Prefix: "SKEEMATEST_"}
+	if varName := ev.VarName("connect-options"); varName != "SKEEMATEST_CONNECT_OPTIONS" {
+		t.Errorf("Unexpected result from VarName: %s", varName)
+	}
+
+	os.Setenv("SKEEMATEST_USER", "envuser")
+	os.Setenv("SKEEMATEST_PASSWORD", "")
+	defer os.Unsetenv("SKEEMATEST_USER")
+	defer os.Unsetenv("SKEEMATEST_PASSWORD")
+	if value, ok := ev.OptionValue("user"); !ok || value != "envuser" {
+		t.Errorf("Expected OptionValue(\"user\") to return \"envuser\", true; instead found %q, %t", value, ok)
+	}
+	if value, ok := ev.OptionValue("password"); !ok || value != "" {
+		t.Errorf("Expected OptionValue(\"password\") to return \"\", true; instead found %q, %t", value, ok)
+	}
+	if value, ok := ev.OptionValue("host"); ok {
+		t.Errorf("Expected OptionValue(\"host\") to return \"\", false; instead found %q, %t", value, ok)
+	}
+
+	// Environment should override lower-priority sources, and CLI should override
+	// the environment
+	cmd := mybase.NewCommand("test", "1.0", "this is for testing", nil)
+	AddGlobalOptions(cmd)
+	cli := &mybase.CommandLine{
+		Command:      cmd,
+		OptionValues: map[string]string{"password": "clipass"},
+	}
+	cfg := mybase.NewConfig(cli, dummySource{"user": "fileuser", "password": "filepass"}, ev)
+	if cfg.Get("user") != "envuser" || !OnCLIOrEnv(cfg, "user") {
+		t.Errorf("Expected user to come from environment; instead found %q from %T", cfg.Get("user"), cfg.Source("user"))
+	}
+	if cfg.Get("password") != "clipass" || !OnCLIOrEnv(cfg, "password") {
+		t.Errorf("Expected password to come from CLI; instead found %q from %T", cfg.Get("password"), cfg.Source("password"))
+	}
+	if OnCLIOrEnv(cfg, "port") {
+		t.Error("Expected OnCLIOrEnv to return false for option with default value")
+	}
+}
+
+func TestQualifiedTableName(t *testing.T) {
+	if escaped, err := qualifiedTableName("audit-table", "ops.skeema_audit"); err != nil || escaped != "`ops`.`skeema_audit`" {
+		t.Errorf("Unexpected result from qualifiedTableName: %q / %v", escaped, err)
+	}
+	if escaped, err := qualifiedTableName("heartbeat-table", "percona.heartbeat"); err != nil || escaped != "`percona`.`heartbeat`" {
+		t.Errorf("Unexpected result from qualifiedTableName: %q / %v", escaped, err)
+	}
+	for _, value := range []string{"skeema_audit", "ops.", ".skeema_audit", "a.b.c"} {
+		if _, err := qualifiedTableName("audit-table", value); err == nil || !strings.Contains(err.Error(), "audit-table") {
+			t.Errorf("Expected error mentioning audit-table from qualifiedTableName(%q), instead found %v", value, err)
+		}
+	}
+}
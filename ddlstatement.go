@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
+	"github.com/skeema/mybase"
 	"github.com/skeema/tengo"
 )
 
@@ -23,9 +27,18 @@ type DDLStatement struct {
 
 	stmt     string
 	shellOut *ShellOut
+	oscTool  string // non-empty if shellOut runs a built-in osc-tool integration
+
+	outputMode string      // value of wrapper-output option
+	output     *syncBuffer // output captured from shellOut, once executed
+	isolate    bool        // value of isolate-wrappers option
 
 	instance   *tengo.Instance
 	schemaName string
+	tableName  string
+	tableSize  int64
+	lockWait   lockWaitOptions
+	timeout    time.Duration // value of statement-timeout option, or 0 for no limit
 }
 
 // NewDDLStatement creates and returns a DDLStatement. It may return nil if
@@ -56,6 +69,16 @@ func NewDDLStatement(diff tengo.TableDiff, mods tengo.StatementModifiers, target
 		err = nil
 	}
 	ddl.setErr(err)
+	ddl.tableName = tableName
+	ddl.tableSize = tableSize
+	ddl.lockWait, err = newLockWaitOptions(target.Dir.Config)
+	ddl.setErr(err)
+	ddl.outputMode, err = target.Dir.Config.GetEnum("wrapper-output", WrapperOutputDirect, WrapperOutputPrefix, WrapperOutputBuffer)
+	ddl.setErr(err)
+	ddl.timeout, err = statementTimeout(target.Dir.Config)
+	ddl.setErr(err)
+	ddl.isolate = target.Dir.Config.GetBool("isolate-wrappers")
+	logger := target.Logger().WithField("table", tableName)
 
 	// If --safe-below-size option in use, enable additional statement modifier
 	// if the table's size is less than the supplied option value
@@ -63,15 +86,29 @@ func NewDDLStatement(diff tengo.TableDiff, mods tengo.StatementModifiers, target
 	ddl.setErr(err)
 	if ddl.Err == nil && tableSize < int64(safeBelowSize) {
 		mods.AllowUnsafe = true
-		log.Debugf("Allowing unsafe operations for table %s: size=%d < safe-below-size=%d", tableName, tableSize, safeBelowSize)
+		logger.Debugf("Allowing unsafe operations for table %s: size=%d < safe-below-size=%d", tableName, tableSize, safeBelowSize)
 	}
 
-	// Options may indicate some/all DDL gets executed by shelling out to another program.
+	// Options may indicate some/all DDL gets executed by shelling out to another
+	// program. For ALTER TABLE, this may be a built-in osc-tool integration.
 	wrapper := target.Dir.Config.Get("ddl-wrapper")
-	if _, isAlter := diff.(tengo.AlterTable); isAlter && target.Dir.Config.Changed("alter-wrapper") {
+	oscTool, err := target.Dir.Config.GetEnum("osc-tool", OSCToolPTOSC, OSCToolGhost)
+	ddl.setErr(err)
+	var useOSCTool bool
+	if _, isAlter := diff.(tengo.AlterTable); isAlter && (target.Dir.Config.Changed("alter-wrapper") || oscTool != "") {
+		if oscTool != "" && target.Dir.Config.Changed("alter-wrapper") {
+			ddl.setErr(errors.New("Options osc-tool and alter-wrapper cannot both be used"))
+		}
 		minSize, err := target.Dir.Config.GetBytes("alter-wrapper-min-size")
 		ddl.setErr(err)
-		if tableSize >= int64(minSize) {
+		if tableSize >= int64(minSize) && oscTool != "" {
+			useOSCTool = true
+			logger.Debugf("Using osc-tool=%s for table %s: size=%d >= alter-wrapper-min-size=%d", oscTool, tableName, tableSize, minSize)
+
+			// OSC tools reject ALGORITHM and LOCK clauses
+			mods.AlgorithmClause = ""
+			mods.LockClause = ""
+		} else if tableSize >= int64(minSize) {
 			wrapper = target.Dir.Config.Get("alter-wrapper")
 
 			// If alter-wrapper-min-size is set, and the table is big enough to use
@@ -80,15 +117,15 @@ func NewDDLStatement(diff tengo.TableDiff, mods tengo.StatementModifiers, target
 			// external OSC tool for large tables, without risk of ALGORITHM or LOCK
 			// clauses breaking expectations of the OSC tool.
 			if minSize > 0 {
-				log.Debugf("Using alter-wrapper for table %s: size=%d >= alter-wrapper-min-size=%d", tableName, tableSize, minSize)
+				logger.Debugf("Using alter-wrapper for table %s: size=%d >= alter-wrapper-min-size=%d", tableName, tableSize, minSize)
 				if mods.AlgorithmClause != "" || mods.LockClause != "" {
-					log.Debug("Ignoring --alter-algorithm and --alter-lock for generating DDL for alter-wrapper")
+					logger.Debug("Ignoring --alter-algorithm and --alter-lock for generating DDL for alter-wrapper")
 					mods.AlgorithmClause = ""
 					mods.LockClause = ""
 				}
 			}
 		} else {
-			log.Debugf("Skipping alter-wrapper for table %s: size=%d < alter-wrapper-min-size=%d", tableName, tableSize, minSize)
+			logger.Debugf("Skipping alter-wrapper for table %s: size=%d < alter-wrapper-min-size=%d", tableName, tableSize, minSize)
 		}
 	}
 
@@ -102,44 +139,114 @@ func NewDDLStatement(diff tengo.TableDiff, mods tengo.StatementModifiers, target
 		return nil
 	}
 
-	// Apply wrapper if relevant
-	if wrapper != "" {
-		extras := map[string]string{
-			"HOST":   ddl.instance.Host,
-			"PORT":   strconv.Itoa(ddl.instance.Port),
-			"SCHEMA": ddl.schemaName,
-			"DDL":    ddl.stmt,
-			"TABLE":  tableName,
-			"SIZE":   strconv.FormatInt(tableSize, 10),
-		}
-		if ddl.instance.SocketPath != "" {
-			delete(extras, "PORT")
-			extras["SOCKET"] = ddl.instance.SocketPath
-		}
-
-		switch diff := diff.(type) {
+	// Apply osc-tool or wrapper if relevant
+	if useOSCTool {
+		ddl.setOSCTool(oscTool, target.Dir)
+	} else if wrapper != "" {
+		var ddlType string
+		switch diff.(type) {
 		case tengo.AlterTable:
-			prefix := fmt.Sprintf("%s ", diff.Table.AlterStatement())
-			extras["CLAUSES"] = strings.Replace(ddl.stmt, prefix, "", 1)
-			extras["TYPE"] = "ALTER"
+			ddlType = "ALTER"
 		case tengo.CreateTable:
-			prefix := fmt.Sprintf("CREATE TABLE %s ", tengo.EscapeIdentifier(diff.Table.Name))
-			extras["CLAUSES"] = strings.Replace(ddl.stmt, prefix, "", 1)
-			extras["TYPE"] = "CREATE"
+			ddlType = "CREATE"
 		case tengo.DropTable:
-			extras["CLAUSES"] = ""
-			extras["TYPE"] = "DROP"
+			ddlType = "DROP"
 		default: // currently includes case tengo.RenameTable
 			ddl.setErr(fmt.Errorf("TableDiff type %T not yet supported", diff))
 		}
+		ddl.setWrapper(wrapper, target.Dir, ddlType, tableName)
+	}
 
-		ddl.shellOut, err = NewInterpolatedShellOut(wrapper, target.Dir, extras)
-		ddl.setErr(err)
+	return ddl
+}
+
+// NewPlannedDDLStatement creates and returns a DDLStatement for a statement
+// previously recorded in a plan file by `skeema diff`, for execution against
+// target. The statement is used as-is. If the plan indicates the statement
+// uses a wrapper, the external command is built from target's current
+// configuration of osc-tool, alter-wrapper, or ddl-wrapper, since commands are
+// not stored in plans in a runnable form. The printable form of that command
+// must match the one recorded in the plan, or the DDLStatement has an error.
+func NewPlannedDDLStatement(planned *TableDiffResult, target *Target) *DDLStatement {
+	ddl := &DDLStatement{
+		stmt:       planned.Statement,
+		instance:   target.Instance,
+		schemaName: target.SchemaFromDir.Name,
+		tableName:  planned.Table,
+		tableSize:  planned.TableSize,
+	}
+	var err error
+	ddl.lockWait, err = newLockWaitOptions(target.Dir.Config)
+	ddl.setErr(err)
+	ddl.outputMode, err = target.Dir.Config.GetEnum("wrapper-output", WrapperOutputDirect, WrapperOutputPrefix, WrapperOutputBuffer)
+	ddl.setErr(err)
+	ddl.timeout, err = statementTimeout(target.Dir.Config)
+	ddl.setErr(err)
+	ddl.isolate = target.Dir.Config.GetBool("isolate-wrappers")
+	oscTool, err := target.Dir.Config.GetEnum("osc-tool", OSCToolPTOSC, OSCToolGhost)
+	ddl.setErr(err)
+	if planned.Wrapper && planned.Type == "ALTER" && oscTool != "" {
+		ddl.setOSCTool(oscTool, target.Dir)
+	} else if planned.Wrapper {
+		wrapper := target.Dir.Config.Get("ddl-wrapper")
+		if planned.Type == "ALTER" && target.Dir.Config.Changed("alter-wrapper") {
+			wrapper = target.Dir.Config.Get("alter-wrapper")
+		}
+		if wrapper == "" {
+			ddl.setErr(fmt.Errorf("Plan requires a wrapper for table %s, but neither alter-wrapper nor ddl-wrapper is configured", planned.Table))
+		} else {
+			ddl.setWrapper(wrapper, target.Dir, planned.Type, planned.Table)
+		}
 	}
 
+	// The command is rebuilt from the current configuration, so confirm it still
+	// matches the reviewed plan, rather than running something different
+	if ddl.shellOut != nil && ddl.shellOut.String() != planned.Command {
+		ddl.setErr(fmt.Errorf("Wrapper command for table %s no longer matches plan: planned %q, but current configuration yields %q", planned.Table, planned.Command, ddl.shellOut.String()))
+	}
 	return ddl
 }
 
+// setWrapper configures ddl to be executed by shelling out to the external
+// command wrapper. Template variables in wrapper are interpolated using ddl's
+// statement, the supplied DDL type ("CREATE", "ALTER", or "DROP"), and the
+// supplied table name.
+func (ddl *DDLStatement) setWrapper(wrapper string, dir *Dir, ddlType, tableName string) {
+	extras := map[string]string{
+		"HOST":   ddl.instance.Host,
+		"PORT":   strconv.Itoa(ddl.instance.Port),
+		"SCHEMA": ddl.schemaName,
+		"DDL":    ddl.stmt,
+		"TABLE":  tableName,
+		"SIZE":   strconv.FormatInt(ddl.tableSize, 10),
+		"TYPE":   ddlType,
+
+		// Password may have been obtained per-instance from password-file or an
+		// external command, so supply the instance's actual password
+		"PASSWORD":  ddl.instance.Password,
+		"PASSWORDX": ddl.instance.Password,
+	}
+	if ddl.instance.SocketPath != "" {
+		delete(extras, "PORT")
+		extras["SOCKET"] = ddl.instance.SocketPath
+	}
+
+	switch ddlType {
+	case "ALTER":
+		prefix := fmt.Sprintf("ALTER TABLE %s ", tengo.EscapeIdentifier(tableName))
+		extras["CLAUSES"] = strings.Replace(ddl.stmt, prefix, "", 1)
+	case "CREATE":
+		prefix := fmt.Sprintf("CREATE TABLE %s ", tengo.EscapeIdentifier(tableName))
+		extras["CLAUSES"] = strings.Replace(ddl.stmt, prefix, "", 1)
+	default:
+		extras["CLAUSES"] = ""
+	}
+
+	var err error
+	ddl.shellOut, err = NewInterpolatedShellOut(wrapper, dir, extras)
+	ddl.setErr(err)
+}
+
 // IsShellOut returns true if the DDL is to be executed via shelling out to an
 // external binary, or false if the DDL represents SQL to be executed directly
 // via a standard database connection.
@@ -168,29 +275,135 @@ func (ddl *DDLStatement) String() string {
 }
 
 // Execute runs the DDL statement, either by running a SQL query against a DB,
-// or shelling out to an external program, as appropriate.
-func (ddl *DDLStatement) Execute() error {
+// or shelling out to an external program, as appropriate. If ctx is canceled
+// while the statement is running, a query is killed via KILL QUERY, or an
+// external program is sent SIGINT. If the statement-timeout option is set and
+// the statement runs for longer, it is killed in the same way, except that an
+// external program is sent SIGTERM.
+func (ddl *DDLStatement) Execute(ctx context.Context) error {
 	// Refuse to execute no-ops or errors
 	if ddl == nil {
 		return nil
 	} else if ddl.Err != nil {
 		return ddl.Err
 	}
+	if ddl.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ddl.timeout)
+		defer cancel()
+	}
 	if ddl.IsShellOut() {
-		ddl.Err = ddl.shellOut.Run()
+		s, finish := ddl.captureShellOut()
+		s.Isolate = ddl.isolate
+		if ddl.oscTool != "" {
+			ddl.Err = ddl.runOSCTool(ctx, s)
+		} else {
+			ddl.Err = s.RunContext(ctx)
+		}
+		finish()
 	} else {
 		if ddl.stmt == "" {
 			return errors.New("Attempted to execute empty DDL statement")
 		}
-		if db, err := ddl.instance.Connect(ddl.schemaName, ""); err != nil {
-			ddl.Err = err
-		} else {
-			_, ddl.Err = db.Exec(ddl.stmt)
-		}
+		ddl.Err = ddl.executeDirect(ctx)
+	}
+	if ddl.Err != nil && ctx.Err() == context.DeadlineExceeded {
+		ddl.Err = fmt.Errorf("Killed after exceeding statement-timeout=%ds: %s", int(ddl.timeout/time.Second), ddl.Err)
 	}
 	return ddl.Err
 }
 
+// executeDirect runs the DDL statement against the DB, using the configured
+// session lock_wait_timeout if any. Unless the statement is a CREATE, it first
+// checks for long-running transactions if max-transaction-age is set. If the
+// statement cannot obtain a metadata lock, it is retried after a delay that
+// doubles with each attempt, up to the configured number of retries.
+func (ddl *DDLStatement) executeDirect(ctx context.Context) error {
+	lw := ddl.lockWait
+	db, err := ddl.instance.Connect(ddl.schemaName, lw.params())
+	if err != nil {
+		return err
+	}
+	checkTrx := lw.maxTrxAge > 0 && !strings.HasPrefix(ddl.stmt, "CREATE ")
+	delay := lw.retryDelay
+	for attempt := 1; ; attempt++ {
+		if checkTrx {
+			err = checkLongTransactions(ctx, db, ddl.schemaName, lw.maxTrxAge)
+		}
+		if err == nil {
+			err = ddl.execKillable(ctx, db)
+		}
+		if err == nil || !lockWaitRetryable(err) || attempt > lw.retries {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"instance": ddl.instance.String(),
+			"schema":   ddl.schemaName,
+			"table":    ddl.tableName,
+		}).Warnf("%s. Retrying in %s (retry %d of %d)", err, delay, attempt, lw.retries)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// execKillable runs the DDL statement on a single connection from db. If ctx
+// is canceled before the statement completes, the statement is killed using
+// KILL QUERY from a separate connection. This is used instead of relying on
+// the driver's own context handling, which merely closes the connection while
+// leaving the statement running on the server.
+func (ddl *DDLStatement) execKillable(ctx context.Context, db *sqlx.DB) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var connID int64
+	if err := conn.QueryRowContext(context.Background(), "SELECT CONNECTION_ID()").Scan(&connID); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	killed := make(chan struct{})
+	go func() {
+		defer close(killed)
+		select {
+		case <-ctx.Done():
+			logger := log.WithFields(log.Fields{
+				"instance": ddl.instance.String(),
+				"schema":   ddl.schemaName,
+				"table":    ddl.tableName,
+			})
+			logger.Warnf("Killing running statement on %s (connection ID %d)", ddl.instance, connID)
+			if _, err := db.Exec(fmt.Sprintf("KILL QUERY %d", connID)); err != nil {
+				logger.Errorf("Unable to kill connection ID %d on %s: %s", connID, ddl.instance, err)
+			}
+		case <-done:
+		}
+	}()
+	_, err = conn.ExecContext(context.Background(), ddl.stmt)
+	close(done)
+	<-killed
+	return err
+}
+
+// statementTimeout returns the value of the statement-timeout option in cfg.
+func statementTimeout(cfg *mybase.Config) (time.Duration, error) {
+	timeout, err := cfg.GetInt("statement-timeout")
+	if err != nil {
+		return 0, err
+	} else if timeout < 0 {
+		return 0, errors.New("Option statement-timeout cannot be negative")
+	}
+	return time.Duration(timeout) * time.Second, nil
+}
+
 // setErr sets ddl.Err if the supplied err is non-nil and ddl.Err is nil.
 // DDLStatement uses this slightly unusual error convention because errors
 // intentionally do not cause an early return in NewDDLStatement; instead they
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skeema/tengo"
+)
+
+func TestStatementTimeout(t *testing.T) {
+	cases := map[string]time.Duration{
+		"0":   0,
+		"30":  30 * time.Second,
+		"600": 10 * time.Minute,
+	}
+	for value, expected := range cases {
+		timeout, err := statementTimeout(getConfig(map[string]string{"statement-timeout": value}))
+		if err != nil || timeout != expected {
+			t.Errorf("Expected statement-timeout=%s to return %s, instead found %s, %v", value, expected, timeout, err)
+		}
+	}
+	for _, value := range []string{"-1", "abc"} {
+		if _, err := statementTimeout(getConfig(map[string]string{"statement-timeout": value})); err == nil {
+			t.Errorf("Expected statement-timeout=%s to return an error, but err was nil", value)
+		}
+	}
+}
+
+func TestDDLStatementExecuteTimeout(t *testing.T) {
+	inst, err := tengo.NewInstance("mysql", "root:@tcp(127.0.0.1:3306)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	ddl := &DDLStatement{
+		stmt:       "ALTER TABLE `users` ADD COLUMN `age` int",
+		shellOut:   &ShellOut{Command: "trap 'echo terminated; exit 4' TERM; sleep 10", Stdout: ioutil.Discard, Stderr: ioutil.Discard},
+		instance:   inst,
+		schemaName: "product",
+		tableName:  "users",
+		timeout:    time.Second,
+		isolate:    true,
+		outputMode: WrapperOutputBuffer, // output is not captured in direct mode
+	}
+	start := time.Now()
+	err = ddl.Execute(context.Background())
+	if err == nil || !strings.HasPrefix(err.Error(), "Killed after exceeding statement-timeout=1s") {
+		t.Errorf("Unexpected error from Execute: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected statement-timeout to stop command promptly, but it ran for %s", elapsed)
+	}
+	if output := ddl.Output(); !strings.Contains(output, "terminated\n") {
+		t.Errorf("Expected command to receive SIGTERM, but output was %q", output)
+	}
+
+	// Statements which complete in time should not be affected
+	ddl.Err = nil
+	ddl.shellOut.Command = "true"
+	if err := ddl.Execute(context.Background()); err != nil {
+		t.Errorf("Unexpected error from Execute: %s", err)
+	}
+}
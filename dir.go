@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/url"
@@ -10,6 +12,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -147,24 +150,6 @@ func (dir *Dir) Instances() ([]*tengo.Instance, error) {
 		return nil, nil
 	}
 
-	// Before looping over hostnames, do a single lookup of user, password,
-	// connect-options, port, socket.
-	var userAndPass string
-	if !dir.Config.Changed("password") {
-		userAndPass = dir.Config.Get("user")
-	} else {
-		userAndPass = fmt.Sprintf("%s:%s", dir.Config.Get("user"), dir.Config.Get("password"))
-	}
-	params, err := dir.InstanceDefaultParams()
-	if err != nil {
-		return nil, fmt.Errorf("Invalid connection options: %s", err)
-	}
-	portValue := dir.Config.GetIntOrDefault("port")
-	portWasSupplied := dir.Config.Supplied("port")
-	portIsntDefault := dir.Config.Changed("port")
-	socketValue := dir.Config.Get("socket")
-	socketWasSupplied := dir.Config.Supplied("socket")
-
 	// Interpret the host value: if host-wrapper is set, use it to interpret the
 	// host list; otherwise assume host is a comma-separated list of literal
 	// hostnames.
@@ -181,32 +166,78 @@ func (dir *Dir) Instances() ([]*tengo.Instance, error) {
 		hosts = dir.Config.GetSlice("host", ',', true)
 	}
 
+	return dir.instancesForHosts(hosts, true)
+}
+
+// instancesForHosts returns a slice of instances corresponding to the supplied
+// hostnames, each of which may optionally include a port. All other connection
+// information, such as user, password, and connect-options, is obtained from
+// the directory's configuration. If strictPort is true, an error is returned
+// if a hostname includes a port which conflicts with an explicitly-configured
+// port option.
+func (dir *Dir) instancesForHosts(hosts []string, strictPort bool) ([]*tengo.Instance, error) {
+	// Before looping over hostnames, do a single lookup of user, connect-options,
+	// port, socket. The password is looked up separately for each host, since it
+	// may be obtained from an external command.
+	user := dir.Config.Get("user")
+	params, err := dir.InstanceDefaultParams()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid connection options: %s", err)
+	}
+	portValue := dir.Config.GetIntOrDefault("port")
+	portWasSupplied := dir.Config.Supplied("port")
+	portIsntDefault := dir.Config.Changed("port")
+	socketValue := dir.Config.Get("socket")
+	socketWasSupplied := dir.Config.Supplied("socket")
+
+	// If an SSH bastion host is configured, all connections use a custom network
+	// which tunnels through it, instead of tcp or unix
+	var sshNet string
+	if sshOpts := dir.SSHOptions(); sshOpts.Enabled() {
+		if sshNet, err = sshOpts.DriverNet(); err != nil {
+			return nil, err
+		}
+	}
+
 	// For each hostname, construct a DSN and use it to create an Instance
 	var instances []*tengo.Instance
 	for _, host := range hosts {
-		var dsn string
 		thisPortValue := portValue
 		// TODO also support cloudsql DSNs
-		if host == "localhost" && (socketWasSupplied || !portWasSupplied) {
-			dsn = fmt.Sprintf("%s@unix(%s)/?%s", userAndPass, socketValue, params)
-		} else {
+		useSocket := (sshNet == "" && host == "localhost" && (socketWasSupplied || !portWasSupplied))
+		if !useSocket {
 			splitHost, splitPort, err := tengo.SplitHostOptionalPort(host)
 			if err != nil {
 				return nil, err
 			}
 			if splitPort > 0 {
-				if portIsntDefault && portValue != splitPort {
+				if strictPort && portIsntDefault && portValue != splitPort {
 					return nil, fmt.Errorf("Port was supplied as %d inside hostname %s but as %d in option file", splitPort, host, portValue)
 				}
 				host = splitHost
 				thisPortValue = splitPort
 			}
+		}
+		password, err := dir.Password(host, thisPortValue)
+		if err != nil {
+			return nil, err
+		}
+		userAndPass := user
+		if password != "" {
+			userAndPass = fmt.Sprintf("%s:%s", user, password)
+		}
+		var dsn string
+		if useSocket {
+			dsn = fmt.Sprintf("%s@unix(%s)/?%s", userAndPass, socketValue, params)
+		} else if sshNet != "" {
+			dsn = fmt.Sprintf("%s@%s(%s:%d)/?%s", userAndPass, sshNet, host, thisPortValue, params)
+		} else {
 			dsn = fmt.Sprintf("%s@tcp(%s:%d)/?%s", userAndPass, host, thisPortValue, params)
 		}
 		instance, err := tengo.NewInstance("mysql", dsn)
 		if err != nil || instance == nil {
-			if dir.Config.Changed("password") {
-				safeUserPass := fmt.Sprintf("%s:*****", dir.Config.Get("user"))
+			if password != "" {
+				safeUserPass := fmt.Sprintf("%s:*****", user)
 				dsn = strings.Replace(dsn, userAndPass, safeUserPass, 1)
 			}
 			return nil, fmt.Errorf("Invalid connection information for %s (DSN=%s): %s", dir, dsn, err)
@@ -216,6 +247,104 @@ func (dir *Dir) Instances() ([]*tengo.Instance, error) {
 	return instances, nil
 }
 
+// passwordCache stores passwords obtained from external commands, keyed by the
+// fully-interpolated command line. This avoids repeatedly running the same
+// command when multiple dirs map to the same host.
+var passwordCache = struct {
+	sync.Mutex
+	byCommand map[string]string
+}{byCommand: make(map[string]string)}
+
+// Password returns the password to use when connecting to the supplied host
+// and port. If the password option is a backtick-wrapped value, it is run as
+// an external command, with {HOST} and {PORT} interpolated. Otherwise, if the
+// password option is not set but password-file is, the password is read from
+// that file. Leading and trailing whitespace is stripped from command output
+// and file contents. An empty string is returned if no password is configured.
+// Passwords are never logged.
+func (dir *Dir) Password(host string, port int) (string, error) {
+	if dir.Config.Changed("password") {
+		value := dir.Config.Get("password")       // Get strips quotes (including backticks) from fully quoted-wrapped values
+		rawValue := dir.Config.GetRaw("password") // GetRaw does not strip quotes
+		if rawValue == value || rawValue[0] != '`' {
+			return value, nil
+		}
+		extras := map[string]string{
+			"HOST": host,
+			"PORT": strconv.Itoa(port),
+		}
+		s, err := NewInterpolatedShellOut(value, dir, extras)
+		if err != nil {
+			return "", err
+		}
+		passwordCache.Lock()
+		defer passwordCache.Unlock()
+		if password, ok := passwordCache.byCommand[s.Command]; ok {
+			return password, nil
+		}
+		output, err := s.RunCapture()
+		if err != nil {
+			return "", fmt.Errorf("Unable to obtain password for %s:%d via external command: %s", host, port, err)
+		}
+		password := strings.TrimSpace(output)
+		passwordCache.byCommand[s.Command] = password
+		return password, nil
+	}
+
+	if dir.Config.Changed("password-file") {
+		contents, err := ioutil.ReadFile(dir.optionPath("password-file"))
+		if err != nil {
+			return "", fmt.Errorf("Unable to read password-file: %s", err)
+		}
+		return strings.TrimSpace(string(contents)), nil
+	}
+
+	return "", nil
+}
+
+// TLSOptions returns the values of the ssl-* options. Any relative file paths
+// are resolved using optionPath.
+func (dir *Dir) TLSOptions() (opts TLSOptions, err error) {
+	opts.Mode, err = dir.Config.GetEnum("ssl-mode", "DISABLED", "PREFERRED", "REQUIRED", "VERIFY_CA", "VERIFY_IDENTITY")
+	if err != nil {
+		return opts, err
+	}
+	if dir.Config.Changed("ssl-ca") {
+		opts.CA = dir.optionPath("ssl-ca")
+	}
+	if dir.Config.Changed("ssl-cert") {
+		opts.Cert = dir.optionPath("ssl-cert")
+	}
+	if dir.Config.Changed("ssl-key") {
+		opts.Key = dir.optionPath("ssl-key")
+	}
+	return opts, nil
+}
+
+// SSHOptions returns the values of the ssh-* options. Any relative key file
+// path is resolved using optionPath.
+func (dir *Dir) SSHOptions() SSHOptions {
+	return SSHOptions{
+		Host: dir.Config.Get("ssh-host"),
+		User: dir.Config.Get("ssh-user"),
+		Key:  dir.optionPath("ssh-key"),
+	}
+}
+
+// optionPath returns the value of the named option, interpreted as a file
+// path. If the value is a relative path, it is interpreted relative to the
+// directory of the option file that set the option, or relative to the working
+// directory if the option was set elsewhere (e.g. on the command-line).
+func (dir *Dir) optionPath(name string) string {
+	filePath := dir.Config.Get(name)
+	if f, ok := dir.Config.Source(name).(*OptionFile); ok && filePath != "" && !filepath.IsAbs(filePath) {
+		if source := f.OptionValueSource(name); source != nil {
+			filePath = filepath.Join(source.Dir, filePath)
+		}
+	}
+	return filePath
+}
+
 // FirstInstance returns at most one tengo.Instance based on the directory's
 // configuration. If the config maps to multiple instances, only the first will
 // be returned. If the config maps to no instances, nil will be returned. The
@@ -276,8 +405,11 @@ func (dir *Dir) SchemaNames(instance *tengo.Instance) ([]string, error) {
 			return nil, err
 		}
 		schemaNames := make([]string, 0, len(schemasByName))
+		historySchema := dir.Config.Get("history-schema")
 		for name := range schemasByName {
-			schemaNames = append(schemaNames, name)
+			if name != historySchema {
+				schemaNames = append(schemaNames, name)
+			}
 		}
 		return schemaNames, nil
 	}
@@ -327,6 +459,27 @@ func (dir *Dir) InstanceDefaultParams() (string, error) {
 		v.Set(name, value)
 	}
 
+	// Set tls based on ssl-* options. This conflicts with setting tls directly in
+	// connect-options, since it isn't clear which should take precedence.
+	tlsOpts, err := dir.TLSOptions()
+	if err != nil {
+		return "", err
+	}
+	if tlsOpts.Enabled() {
+		for name := range options {
+			if strings.ToLower(name) == "tls" {
+				return "", errors.New("connect-options cannot contain tls when ssl-ca, ssl-cert, ssl-key, or ssl-mode is set")
+			}
+		}
+		tlsParam, err := tlsOpts.DriverParam()
+		if err != nil {
+			return "", err
+		}
+		if tlsParam != "" {
+			v.Set("tls", tlsParam)
+		}
+	}
+
 	// Set non-overridable options
 	v.Set("interpolateParams", "true")
 	v.Set("foreign_key_checks", "0")
@@ -439,10 +592,18 @@ func (dir *Dir) CreateOptionFile(optionFile *mybase.File) error {
 // fatalSQLFileErrors is true, any file with an invalid CREATE TABLE will cause
 // a single instanceless error Target to be used for the directory.
 func (dir *Dir) TargetGroups(firstOnly, fatalSQLFileErrors bool) <-chan TargetGroup {
+	return dir.TargetGroupsContext(context.Background(), firstOnly, fatalSQLFileErrors)
+}
+
+// TargetGroupsContext behaves like TargetGroups, but stops performing
+// operations on database instances once ctx is canceled. Any directory which
+// was not fully processed by then is represented by an instanceless error
+// Target.
+func (dir *Dir) TargetGroupsContext(ctx context.Context, firstOnly, fatalSQLFileErrors bool) <-chan TargetGroup {
 	groups := make(chan TargetGroup)
 	go func() {
 		targetsByInstance := NewTargetGroupMap()
-		goodDirCount, badDirCount := generateTargetsForDir(dir, targetsByInstance, firstOnly, fatalSQLFileErrors)
+		goodDirCount, badDirCount := generateTargetsForDir(ctx, dir, targetsByInstance, firstOnly, fatalSQLFileErrors)
 		for _, tg := range targetsByInstance {
 			groups <- tg
 		}
@@ -465,7 +626,7 @@ func (dir *Dir) TargetGroups(firstOnly, fatalSQLFileErrors bool) <-chan TargetGr
 func (dir *Dir) Targets() []*Target {
 	targets := make([]*Target, 0)
 	targetsByInstance := NewTargetGroupMap()
-	goodDirCount, badDirCount := generateTargetsForDir(dir, targetsByInstance, true, false)
+	goodDirCount, badDirCount := generateTargetsForDir(context.Background(), dir, targetsByInstance, true, false)
 	for _, tg := range targetsByInstance {
 		for _, t := range tg {
 			targets = append(targets, t)
@@ -495,7 +656,11 @@ func (dir *Dir) Targets() []*Target {
 // The supplied instance will be used for temporary schema operations, and
 // will be stored in the returned Target, but may safely be changed to point
 // to a different instance as needed.
-func (dir *Dir) TargetTemplate(instance *tengo.Instance) Target {
+//
+// If ctx is canceled, the method returns early, with t.Err set. The temporary
+// schema is still cleaned up, unless ctx was canceled while introspecting it,
+// in which case it is left in place for the next run to clean up.
+func (dir *Dir) TargetTemplate(ctx context.Context, instance *tengo.Instance) Target {
 	t := Target{
 		Dir:             dir,
 		Instance:        instance,
@@ -511,7 +676,7 @@ func (dir *Dir) TargetTemplate(instance *tengo.Instance) Target {
 
 	// TODO: want to skip binlogging for all temp schema actions, if super priv available
 	var tx *sql.Tx
-	if tx, err = t.lockTempSchema(30 * time.Second); err != nil {
+	if tx, err = t.lockTempSchema(ctx, 30*time.Second); err != nil {
 		t.Err = fmt.Errorf("Unable to lock temporary schema on %s: %s", instance, err)
 		return t
 	}
@@ -522,11 +687,19 @@ func (dir *Dir) TargetTemplate(instance *tengo.Instance) Target {
 		}
 	}()
 
-	tempSchema, err := instance.Schema(tempSchemaName)
+	var tempSchema *tengo.Schema
+	err = callWithContext(ctx, func() (err error) {
+		tempSchema, err = instance.Schema(tempSchemaName)
+		return err
+	})
 	if err != nil {
 		t.Err = fmt.Errorf("Unable to check for existence of temp schema on %s: %s", instance, err)
 		return t
 	}
+	if err := ctx.Err(); err != nil {
+		t.Err = fmt.Errorf("Unable to prepare temporary schema on %s: %s", instance, err)
+		return t
+	}
 	if tempSchema != nil {
 		// Attempt to drop any tables already present in tempSchema, but fail if
 		// any of them actually have 1 or more rows
@@ -555,8 +728,11 @@ func (dir *Dir) TargetTemplate(instance *tengo.Instance) Target {
 		for _, warning := range sf.Warnings {
 			t.SQLFileWarnings = append(t.SQLFileWarnings, warning)
 		}
-		_, err := db.Exec(sf.Contents)
-		if err != nil {
+		_, err := db.ExecContext(ctx, sf.Contents)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			t.Err = fmt.Errorf("Unable to populate temporary schema on %s: %s", instance, ctxErr)
+			break
+		} else if err != nil {
 			if tengo.IsSyntaxError(err) {
 				sf.Error = fmt.Errorf("%s: SQL syntax error: %s", sf.Path(), err)
 			} else {
@@ -565,8 +741,21 @@ func (dir *Dir) TargetTemplate(instance *tengo.Instance) Target {
 			t.SQLFileErrors[sf.Path()] = sf
 		}
 	}
-	if t.SchemaFromDir, err = tempSchema.CachedCopy(); err != nil {
-		t.Err = fmt.Errorf("Unable to clone temporary schema on %s: %s", instance, err)
+	if t.Err == nil {
+		var schemaFromDir *tengo.Schema
+		err = callWithContext(ctx, func() (err error) {
+			schemaFromDir, err = tempSchema.CachedCopy()
+			return err
+		})
+		if err != nil {
+			t.Err = fmt.Errorf("Unable to clone temporary schema on %s: %s", instance, err)
+			if ctx.Err() != nil {
+				// Introspection may still be in progress in the background, so
+				// tempSchema cannot safely be used for cleanup
+				return t
+			}
+		}
+		t.SchemaFromDir = schemaFromDir
 	}
 
 	if dir.Config.GetBool("reuse-temp-schema") {
@@ -581,15 +770,12 @@ func (dir *Dir) TargetTemplate(instance *tengo.Instance) Target {
 	return t
 }
 
-// OptionFile returns a pointer to a mybase.File for this directory, representing
+// OptionFile returns a pointer to an OptionFile for this directory, representing
 // the dir's .skeema file, if one exists. The file will be read and parsed; any
 // errors in either process will be returned. The section specified by
 // dir.section will automatically be selected for use in the file if it exists.
-func (dir *Dir) OptionFile() (*mybase.File, error) {
-	f := mybase.NewFile(dir.Path, ".skeema")
-	if err := f.Read(); err != nil {
-		return nil, err
-	}
+func (dir *Dir) OptionFile() (*OptionFile, error) {
+	f := NewOptionFile(dir.Path, ".skeema")
 	if err := f.Parse(dir.Config); err != nil {
 		return nil, err
 	}
@@ -597,19 +783,19 @@ func (dir *Dir) OptionFile() (*mybase.File, error) {
 	return f, nil
 }
 
-// cascadingOptionFiles returns a slice of *mybase.File, corresponding to the
+// cascadingOptionFiles returns a slice of *OptionFile, corresponding to the
 // option file in this dir as well as its parent dir hierarchy. Evaluation
 // of parent dirs stops once we hit either a directory containing .git, the
 // user's home directory, or the root of the filesystem. The result is ordered
 // such that the closest-to-root dir's File is returned first and this dir's
 // File last. The files will be read, but not parsed.
-func (dir *Dir) cascadingOptionFiles() (files []*mybase.File, errReturn error) {
+func (dir *Dir) cascadingOptionFiles() (files []*OptionFile, errReturn error) {
 	home := filepath.Clean(os.Getenv("HOME"))
 
 	// we know the first character will be a /, so discard the first split result
 	// which we know will be an empty string
 	components := strings.Split(dir.Path, string(os.PathSeparator))[1:]
-	files = make([]*mybase.File, 0, len(components))
+	files = make([]*OptionFile, 0, len(components))
 
 	// Examine parent dirs, going up one level at a time, stopping early if we
 	// hit either the user's home directory or a directory containing a .git subdir.
@@ -629,7 +815,7 @@ func (dir *Dir) cascadingOptionFiles() (files []*mybase.File, errReturn error) {
 			if fi.Name() == ".git" {
 				n = -1 // stop outer loop early, after done with this dir
 			} else if fi.Name() == ".skeema" {
-				f := mybase.NewFile(curPath, ".skeema")
+				f := NewOptionFile(curPath, ".skeema")
 				if readErr := f.Read(); readErr != nil {
 					errReturn = readErr
 				} else {
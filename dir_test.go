@@ -1,8 +1,12 @@
 package main
 
 import (
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/skeema/mybase"
@@ -29,6 +33,18 @@ func getConfig(values map[string]string) *mybase.Config {
 	return mybase.NewConfig(cli, dummySource(values))
 }
 
+// getGlobalConfig returns a stub config based on a single map of key->value
+// string pairs. Unlike getConfig, only Skeema's global options are valid, and
+// all other global options will have their default values.
+func getGlobalConfig(values map[string]string) *mybase.Config {
+	cmd := mybase.NewCommand("test", "1.0", "this is for testing", nil)
+	AddGlobalOptions(cmd)
+	cli := &mybase.CommandLine{
+		Command: cmd,
+	}
+	return mybase.NewConfig(cli, dummySource(values))
+}
+
 func TestInstances(t *testing.T) {
 	assertInstances := func(optionValues map[string]string, expectError bool, expectedInstances ...string) []*tengo.Instance {
 		cmd := mybase.NewCommand("test", "1.0", "this is for testing", nil)
@@ -95,9 +111,14 @@ func TestInstances(t *testing.T) {
 
 func TestInstanceDefaultParams(t *testing.T) {
 	getDir := func(connectOptions string) *Dir {
+		cmd := mybase.NewCommand("test", "1.0", "this is for testing", nil)
+		AddGlobalOptions(cmd)
+		cli := &mybase.CommandLine{
+			Command: cmd,
+		}
 		return &Dir{
 			Path:    "/tmp/dummydir",
-			Config:  getConfig(map[string]string{"connect-options": connectOptions}),
+			Config:  mybase.NewConfig(cli, dummySource{"connect-options": connectOptions}),
 			section: "production",
 		}
 	}
@@ -141,3 +162,170 @@ func TestInstanceDefaultParams(t *testing.T) {
 		}
 	}
 }
+
+func TestNewDirIncludes(t *testing.T) {
+	root := optionFileTestDir(t, map[string]string{
+		".git/HEAD":                 "", // prevents NewDir from climbing above root
+		"shared/creds.cnf":          "user=incuser\n[production]\nport=3307\n",
+		"shared/conf.d/a.cnf":       "connect-options=wait_timeout=100\n",
+		"shared/conf.d/ignored.txt": "bogus\n",
+		"host/.skeema":              "user=ownuser\n!include ../shared/creds.cnf\n!includedir ../shared/conf.d\n[production]\nhost=db1\n",
+		"cycle/.skeema":             "!include other.cnf\n",
+		"cycle/other.cnf":           "!include .skeema\n",
+	})
+	defer os.RemoveAll(root)
+
+	cmd := mybase.NewCommand("test", "1.0", "this is for testing", nil)
+	AddGlobalOptions(cmd)
+	cmd.AddArg("environment", "production", false)
+	cfg := mybase.NewConfig(&mybase.CommandLine{Command: cmd})
+
+	dir, err := NewDir(filepath.Join(root, "host"), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error from NewDir: %s", err)
+	}
+	assertOption := func(name, expectedValue, expectedSourceFile string) {
+		if actual := dir.Config.Get(name); actual != expectedValue {
+			t.Errorf("Expected %s to have value %q, instead found %q", name, expectedValue, actual)
+		}
+		f, ok := dir.Config.Source(name).(*OptionFile)
+		if !ok {
+			t.Errorf("Expected %s to come from a file, instead source is %T", name, dir.Config.Source(name))
+		} else if source, expectedPath := f.OptionValueSource(name), filepath.Join(root, expectedSourceFile); source == nil {
+			t.Errorf("Expected %s to come from %s, instead found no source", name, expectedPath)
+		} else if source.Path() != expectedPath {
+			t.Errorf("Expected %s to come from %s, instead found %s", name, expectedPath, source.Path())
+		}
+	}
+	assertOption("user", "incuser", "shared/creds.cnf")
+	assertOption("port", "3307", "shared/creds.cnf")
+	assertOption("connect-options", "wait_timeout=100", "shared/conf.d/a.cnf")
+	assertOption("host", "db1", "host/.skeema")
+
+	// Adding a section should preserve directives, without inlining any values
+	// obtained from included files
+	f, err := dir.OptionFile()
+	if err != nil {
+		t.Fatalf("Unexpected error from OptionFile: %s", err)
+	}
+	f.SetOptionValue("staging", "host", "db2")
+	if err := f.Write(true); err != nil {
+		t.Fatalf("Unexpected error from Write: %s", err)
+	}
+	contents, _ := ioutil.ReadFile(f.Path())
+	for _, expected := range []string{"user=ownuser", "!include ../shared/creds.cnf", "!includedir ../shared/conf.d", "host=db1", "host=db2"} {
+		if !strings.Contains(string(contents), expected) {
+			t.Errorf("Expected rewritten file to contain %q, but it did not. Contents:\n%s", expected, contents)
+		}
+	}
+	for _, unexpected := range []string{"incuser", "3307", "wait_timeout"} {
+		if strings.Contains(string(contents), unexpected) {
+			t.Errorf("Expected rewritten file to not contain %q, but it did. Contents:\n%s", unexpected, contents)
+		}
+	}
+
+	_, err = NewDir(filepath.Join(root, "cycle"), cfg)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected include cycle error, instead found %v", err)
+	}
+}
+
+func TestNewDirExtends(t *testing.T) {
+	root := optionFileTestDir(t, map[string]string{
+		".git/HEAD":        "", // prevents NewDir from climbing above root
+		"host/.skeema":     "port=3306\n[production]\nhost=db1\nconnect-options=wait_timeout=300\nignore-table=^_\n[production-eu]\n!extends production\nhost=db-eu\n[production-eu-2]\n!extends production-eu\nignore-table=^tmp\n",
+		"missing/.skeema":  "[production]\n!extends nonexistent\nhost=db1\n",
+		"cycle/.skeema":    "[a]\n!extends b\n[b]\n!extends c\n[c]\n!extends a\n",
+		"toplevel/.skeema": "!extends production\n[production]\nhost=db1\n",
+	})
+	defer os.RemoveAll(root)
+
+	getDir := func(subdir, environment string) (*Dir, error) {
+		cmd := mybase.NewCommand("test", "1.0", "this is for testing", nil)
+		AddGlobalOptions(cmd)
+		cmd.AddArg("environment", "production", false)
+		cfg := mybase.NewConfig(&mybase.CommandLine{Command: cmd, ArgValues: []string{environment}})
+		return NewDir(filepath.Join(root, subdir), cfg)
+	}
+	assertOptions := func(environment string, expected map[string]string) {
+		dir, err := getDir("host", environment)
+		if err != nil {
+			t.Fatalf("Unexpected error from NewDir: %s", err)
+		}
+		for name, expectedValue := range expected {
+			if actual := dir.Config.Get(name); actual != expectedValue {
+				t.Errorf("In environment %s, expected %s to have value %q, instead found %q", environment, name, expectedValue, actual)
+			}
+		}
+	}
+	assertOptions("production", map[string]string{"host": "db1", "connect-options": "wait_timeout=300", "ignore-table": "^_", "port": "3306"})
+	assertOptions("production-eu", map[string]string{"host": "db-eu", "connect-options": "wait_timeout=300", "ignore-table": "^_", "port": "3306"})
+	assertOptions("production-eu-2", map[string]string{"host": "db-eu", "connect-options": "wait_timeout=300", "ignore-table": "^tmp", "port": "3306"})
+
+	// Rewriting the file should preserve inheritance
+	dir, _ := getDir("host", "production")
+	f, err := dir.OptionFile()
+	if err != nil {
+		t.Fatalf("Unexpected error from OptionFile: %s", err)
+	}
+	f.SetSectionExtends("staging", "production-eu")
+	f.SetOptionValue("staging", "host", "db-staging")
+	if err := f.Write(true); err != nil {
+		t.Fatalf("Unexpected error from Write: %s", err)
+	}
+	assertOptions("staging", map[string]string{"host": "db-staging", "connect-options": "wait_timeout=300", "ignore-table": "^_"})
+	assertOptions("production-eu-2", map[string]string{"host": "db-eu", "ignore-table": "^tmp"})
+
+	for subdir, expectedText := range map[string]string{"missing": "nonexistent", "cycle": "cycle", "toplevel": "named section"} {
+		if _, err := getDir(subdir, "a"); err == nil || !strings.Contains(err.Error(), expectedText) {
+			t.Errorf("Expected error containing %q for %s, instead found %v", expectedText, subdir, err)
+		}
+	}
+}
+
+func TestDirPassword(t *testing.T) {
+	pwFile, err := ioutil.TempFile("", "skeematest")
+	if err != nil {
+		t.Fatalf("Unable to create temp file: %s", err)
+	}
+	defer os.Remove(pwFile.Name())
+	pwFile.WriteString("fromfile\n")
+	pwFile.Close()
+
+	assertPassword := func(optionValues map[string]string, host string, port int, expected string) {
+		dir := &Dir{
+			Path:    "/tmp/dummydir",
+			Config:  getGlobalConfig(optionValues),
+			section: "production",
+		}
+		actual, err := dir.Password(host, port)
+		if err != nil {
+			t.Errorf("With option values %v, unexpected error from Password: %s", optionValues, err)
+		} else if actual != expected {
+			t.Errorf("With option values %v, expected password %q, instead found %q", optionValues, expected, actual)
+		}
+	}
+	assertPassword(map[string]string{}, "db1", 3306, "")
+	assertPassword(map[string]string{"password": "literal"}, "db1", 3306, "literal")
+	assertPassword(map[string]string{"password": "`echo pw-{HOST}-{PORT}`"}, "db1", 3306, "pw-db1-3306")
+	assertPassword(map[string]string{"password": "`echo pw-{HOST}-{PORT}`"}, "db2", 3307, "pw-db2-3307")
+	assertPassword(map[string]string{"password-file": pwFile.Name()}, "db1", 3306, "fromfile")
+	assertPassword(map[string]string{"password": "literal", "password-file": pwFile.Name()}, "db1", 3306, "literal")
+
+	// Confirm Instances uses per-host passwords
+	dir := &Dir{
+		Path: "/tmp/dummydir",
+		Config: getGlobalConfig(map[string]string{
+			"host":     "pwtest1,pwtest2:3307",
+			"password": "`echo secret-{HOST}`",
+		}),
+		section: "production",
+	}
+	instances, err := dir.Instances()
+	if err != nil || len(instances) != 2 {
+		t.Fatalf("Unexpected result from Instances: %v, %v", instances, err)
+	}
+	if instances[0].Password != "secret-pwtest1" || instances[1].Password != "secret-pwtest2" {
+		t.Errorf("Unexpected passwords in instances: %q, %q", instances[0].Password, instances[1].Password)
+	}
+}
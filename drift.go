@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/skeema/tengo"
+)
+
+// Drift statuses for a single schema.
+const (
+	DriftInSync      = "in_sync"
+	DriftDrifted     = "drifted"
+	DriftError       = "error"
+	DriftUnreachable = "unreachable"
+)
+
+var driftStatuses = []string{DriftInSync, DriftDrifted, DriftError, DriftUnreachable}
+
+// DriftReport represents the outcome of a single run of `skeema drift`.
+type DriftReport struct {
+	Environment string         `json:"environment"`
+	Schemas     []*SchemaDrift `json:"schemas"`
+	Summary     map[string]int `json:"summary"` // count of schemas by drift status
+}
+
+// SchemaDrift summarizes the differences between one schema on a database
+// instance and its corresponding filesystem representation. Counts of tables
+// are from the perspective of `skeema push`: for example, TablesAdded is the
+// number of tables that exist in the filesystem but not on the instance.
+type SchemaDrift struct {
+	Dir               string `json:"dir"`
+	Instance          string `json:"instance,omitempty"`
+	Schema            string `json:"schema,omitempty"`
+	Status            string `json:"status"`
+	SchemaDiffers     bool   `json:"schema_differs"`
+	TablesAdded       int    `json:"tables_added"`
+	TablesDropped     int    `json:"tables_dropped"`
+	TablesAltered     int    `json:"tables_altered"`
+	TablesUnsupported int    `json:"tables_unsupported"`
+	LastPushAge       *int64 `json:"last_push_age_seconds"` // nil if no history is available
+	Error             string `json:"error,omitempty"`
+}
+
+// NewSchemaDrift returns a SchemaDrift describing diff, which was computed
+// for Target t. Tables matching ignoreTable are not counted, nor are ALTER
+// TABLEs which only affect the next auto-increment value, consistent with the
+// behavior of `skeema diff`.
+func NewSchemaDrift(t *Target, diff *tengo.SchemaDiff, ignoreTable *regexp.Regexp) *SchemaDrift {
+	sd := &SchemaDrift{
+		Dir:           t.Dir.Path,
+		Instance:      t.Instance.String(),
+		Schema:        t.SchemaFromDir.Name,
+		SchemaDiffers: diff.SchemaDDL != "",
+	}
+	mods := tengo.StatementModifiers{
+		NextAutoInc: tengo.NextAutoIncIfIncreased,
+		AllowUnsafe: true,
+	}
+	ignored := func(table *tengo.Table) bool {
+		return ignoreTable != nil && ignoreTable.MatchString(table.Name)
+	}
+	for _, tableDiff := range diff.TableDiffs {
+		switch td := tableDiff.(type) {
+		case tengo.CreateTable:
+			if !ignored(td.Table) {
+				sd.TablesAdded++
+			}
+		case tengo.DropTable:
+			if !ignored(td.Table) {
+				sd.TablesDropped++
+			}
+		case tengo.AlterTable:
+			if stmt, _ := td.Statement(mods); stmt != "" && !ignored(td.Table) {
+				sd.TablesAltered++
+			}
+		}
+	}
+	for _, table := range diff.UnsupportedTables {
+		if !ignored(table) {
+			sd.TablesUnsupported++
+		}
+	}
+	if sd.SchemaDiffers || sd.TablesAdded+sd.TablesDropped+sd.TablesAltered+sd.TablesUnsupported > 0 {
+		sd.Status = DriftDrifted
+	} else {
+		sd.Status = DriftInSync
+	}
+	return sd
+}
+
+// NewSchemaDriftError returns a SchemaDrift for a Target which could not be
+// evaluated. If unreachable is true, the status indicates the Target's
+// instance could not be reached; otherwise, a general error status is used.
+func NewSchemaDriftError(t *Target, unreachable bool) *SchemaDrift {
+	sd := &SchemaDrift{
+		Dir:    t.Dir.Path,
+		Status: DriftError,
+		Error:  t.Err.Error(),
+	}
+	if t.Instance != nil {
+		sd.Instance = t.Instance.String()
+	}
+	if t.SchemaFromDir != nil {
+		sd.Schema = t.SchemaFromDir.Name
+	}
+	if unreachable {
+		sd.Status = DriftUnreachable
+	}
+	return sd
+}
+
+// NewDriftReport returns an empty DriftReport for the named environment.
+func NewDriftReport(environment string) *DriftReport {
+	dr := &DriftReport{
+		Environment: environment,
+		Schemas:     []*SchemaDrift{},
+		Summary:     make(map[string]int),
+	}
+	for _, status := range driftStatuses {
+		dr.Summary[status] = 0
+	}
+	return dr
+}
+
+// Add appends sd to the report, updating the summary accordingly.
+func (dr *DriftReport) Add(sd *SchemaDrift) {
+	dr.Schemas = append(dr.Schemas, sd)
+	dr.Summary[sd.Status]++
+}
+
+// sort orders the report's schemas by dir, instance, and schema name.
+func (dr *DriftReport) sort() {
+	sort.SliceStable(dr.Schemas, func(i, j int) bool {
+		a, b := dr.Schemas[i], dr.Schemas[j]
+		if a.Dir != b.Dir {
+			return a.Dir < b.Dir
+		} else if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return a.Schema < b.Schema
+	})
+}
+
+// WriteJSON sorts the report's schemas, and then writes the report to w as an
+// indented JSON document.
+func (dr *DriftReport) WriteJSON(w io.Writer) error {
+	dr.sort()
+	data, err := json.MarshalIndent(dr, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// WritePrometheus sorts the report's schemas, and then writes the report to w
+// in the Prometheus text exposition format, suitable for use with the node
+// exporter's textfile collector.
+func (dr *DriftReport) WritePrometheus(w io.Writer) error {
+	dr.sort()
+	var b bytes.Buffer
+	writeHeader := func(name, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+
+	writeHeader("skeema_drift_status", "Whether the schema currently has the labeled drift status (1) or not (0)")
+	for _, sd := range dr.Schemas {
+		for _, status := range driftStatuses {
+			var value int
+			if sd.Status == status {
+				value = 1
+			}
+			fmt.Fprintf(&b, "skeema_drift_status{%s,status=\"%s\"} %d\n", sd.labels(dr.Environment), status, value)
+		}
+	}
+
+	writeHeader("skeema_drift_tables", "Number of tables that differ between the filesystem and the database instance, by type of difference")
+	for _, sd := range dr.Schemas {
+		if sd.Status == DriftError || sd.Status == DriftUnreachable {
+			continue
+		}
+		counts := []struct {
+			diffType string
+			value    int
+		}{
+			{"added", sd.TablesAdded},
+			{"dropped", sd.TablesDropped},
+			{"altered", sd.TablesAltered},
+			{"unsupported", sd.TablesUnsupported},
+		}
+		for _, c := range counts {
+			fmt.Fprintf(&b, "skeema_drift_tables{%s,type=\"%s\"} %d\n", sd.labels(dr.Environment), c.diffType, c.value)
+		}
+	}
+
+	writeHeader("skeema_drift_last_push_age_seconds", "Seconds since the last successful push to the schema, if history-schema is in use")
+	for _, sd := range dr.Schemas {
+		if sd.LastPushAge != nil {
+			fmt.Fprintf(&b, "skeema_drift_last_push_age_seconds{%s} %d\n", sd.labels(dr.Environment), *sd.LastPushAge)
+		}
+	}
+
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// labels returns the Prometheus label pairs identifying sd.
+func (sd *SchemaDrift) labels(environment string) string {
+	return fmt.Sprintf("environment=\"%s\",dir=\"%s\",instance=\"%s\",schema=\"%s\"",
+		promEscape(environment), promEscape(sd.Dir), promEscape(sd.Instance), promEscape(sd.Schema))
+}
+
+// promEscape escapes a Prometheus label value.
+func promEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
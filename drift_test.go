@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/skeema/mybase"
+	"github.com/skeema/tengo"
+)
+
+func TestNewSchemaDrift(t *testing.T) {
+	inst, err := tengo.NewInstance("mysql", "root:@tcp(127.0.0.1:3306)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	target := &Target{
+		Dir:           &Dir{Path: "/tmp/product"},
+		Instance:      inst,
+		SchemaFromDir: &tengo.Schema{Name: "product"},
+	}
+	widgets := &tengo.Table{Name: "widgets"}
+	diff := &tengo.SchemaDiff{
+		TableDiffs: []tengo.TableDiff{
+			tengo.CreateTable{Table: &tengo.Table{Name: "gadgets"}},
+			tengo.CreateTable{Table: &tengo.Table{Name: "_ignored"}},
+			tengo.DropTable{Table: &tengo.Table{Name: "doodads"}},
+			tengo.AlterTable{
+				Table:   widgets,
+				Clauses: []tengo.TableAlterClause{tengo.ChangeAutoIncrement{Table: widgets, OldNextAutoIncrement: 10, NewNextAutoIncrement: 5}},
+			},
+		},
+		UnsupportedTables: []*tengo.Table{{Name: "sprockets"}},
+	}
+	sd := NewSchemaDrift(target, diff, regexp.MustCompile("^_"))
+	if sd.Status != DriftDrifted || sd.TablesAdded != 1 || sd.TablesDropped != 1 || sd.TablesAltered != 0 || sd.TablesUnsupported != 1 || sd.SchemaDiffers {
+		t.Errorf("Unexpected result from NewSchemaDrift: %+v", sd)
+	}
+
+	diff = &tengo.SchemaDiff{TableDiffs: diff.TableDiffs[3:]}
+	if sd := NewSchemaDrift(target, diff, nil); sd.Status != DriftInSync {
+		t.Errorf("Expected auto-increment-only difference to be in sync, instead found %+v", sd)
+	}
+}
+
+func TestDriftReportWrite(t *testing.T) {
+	age := int64(3600)
+	dr := NewDriftReport("production")
+	dr.Add(&SchemaDrift{Dir: "/tmp/b", Instance: "db1:3306", Schema: "product", Status: DriftDrifted, TablesAltered: 2, LastPushAge: &age})
+	dr.Add(&SchemaDrift{Dir: "/tmp/a", Instance: "db2:3306", Schema: `we"ird`, Status: DriftInSync})
+	dr.Add(NewSchemaDriftError(&Target{Dir: &Dir{Path: "/tmp/c"}, Err: errors.New("no such host")}, true))
+
+	var buf bytes.Buffer
+	if err := dr.WriteJSON(&buf); err != nil {
+		t.Fatalf("Unexpected error from WriteJSON: %s", err)
+	}
+	var decoded DriftReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unable to decode output: %s\n%s", err, buf.String())
+	}
+	if len(decoded.Schemas) != 3 || decoded.Schemas[0].Dir != "/tmp/a" || decoded.Schemas[2].Status != DriftUnreachable {
+		t.Errorf("Unexpected schemas in decoded output: %+v", decoded.Schemas)
+	}
+	if decoded.Summary[DriftDrifted] != 1 || decoded.Summary[DriftUnreachable] != 1 || decoded.Summary[DriftError] != 0 {
+		t.Errorf("Unexpected summary in decoded output: %+v", decoded.Summary)
+	}
+
+	buf.Reset()
+	if err := dr.WritePrometheus(&buf); err != nil {
+		t.Fatalf("Unexpected error from WritePrometheus: %s", err)
+	}
+	output := buf.String()
+	expectLines := []string{
+		`skeema_drift_status{environment="production",dir="/tmp/b",instance="db1:3306",schema="product",status="drifted"} 1`,
+		`skeema_drift_status{environment="production",dir="/tmp/c",instance="",schema="",status="unreachable"} 1`,
+		`skeema_drift_tables{environment="production",dir="/tmp/b",instance="db1:3306",schema="product",type="altered"} 2`,
+		`skeema_drift_tables{environment="production",dir="/tmp/a",instance="db2:3306",schema="we\"ird",type="added"} 0`,
+		`skeema_drift_last_push_age_seconds{environment="production",dir="/tmp/b",instance="db1:3306",schema="product"} 3600`,
+	}
+	for _, line := range expectLines {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected output to contain line %s, but it did not. Full output:\n%s", line, output)
+		}
+	}
+	if strings.Contains(output, `dir="/tmp/c",instance="",schema="",type=`) {
+		t.Errorf("Expected unreachable schema to be omitted from table counts. Full output:\n%s", output)
+	}
+}
+
+func TestDriftFormatOption(t *testing.T) {
+	root, err := ioutil.TempDir("", "skeematest")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0777); err != nil {
+		t.Fatalf("Unable to create dir: %s", err)
+	}
+	optionFilePath := filepath.Join(root, ".skeema")
+	if err := ioutil.WriteFile(optionFilePath, []byte("drift-format=prometheus\n"), 0666); err != nil {
+		t.Fatalf("Unable to write file: %s", err)
+	}
+	origDir, _ := os.Getwd()
+	origHome := os.Getenv("HOME")
+	defer func() {
+		os.Chdir(origDir)
+		os.Setenv("HOME", origHome)
+	}()
+	os.Chdir(root)
+	os.Setenv("HOME", root)
+
+	// Global options are normally added to CommandSuite by main()
+	if _, ok := CommandSuite.Options()["host"]; !ok {
+		AddGlobalOptions(CommandSuite)
+	}
+
+	// Setting drift-format must not interfere with diff or push
+	for _, commandLine := range []string{"skeema diff", "skeema push --dry-run"} {
+		cfg := mybase.ParseFakeCLI(t, CommandSuite, commandLine)
+		if err := cfg.HandleCommand(); err != nil {
+			t.Errorf("Unexpected error from `%s` in dir with drift-format set: %s", commandLine, err)
+		}
+	}
+
+	cfg := mybase.ParseFakeCLI(t, CommandSuite, "skeema validate-config")
+	addRecursiveCommandOptions(cfg.CLI.Command)
+	cfg.MarkDirty()
+	if problems := validateOptionFile(cfg, mybase.NewFile(optionFilePath), false); len(problems) > 0 {
+		t.Errorf("Unexpected problems from validateOptionFile: %v", problems)
+	}
+	if err := ioutil.WriteFile(optionFilePath, []byte("drift-format=sql\n"), 0666); err != nil {
+		t.Fatalf("Unable to write file: %s", err)
+	}
+	if problems := validateOptionFile(cfg, mybase.NewFile(optionFilePath), false); len(problems) != 1 {
+		t.Errorf("Expected one problem from validateOptionFile, instead found %v", problems)
+	}
+}
@@ -28,8 +28,10 @@ const (
 	CodeBadUsage         = 64
 	CodeBadInput         = 65
 	CodeNoInput          = 66
+	CodeUnavailable      = 69
 	CodeCantCreate       = 73
 	CodeBadConfig        = 78
+	CodeInterrupted      = 130
 )
 
 // NewExitValue is a constructor for ExitValue.
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/VividCortex/mysqlerr"
+	"github.com/go-sql-driver/mysql"
+	"github.com/skeema/tengo"
+)
+
+// historyTableName is the name of the table, within the schema configured by
+// the history-schema option, that stores the history of `skeema push`.
+const historyTableName = "push_history"
+
+const historyTableCreate = `CREATE TABLE IF NOT EXISTS %s (
+  id bigint unsigned NOT NULL AUTO_INCREMENT,
+  push_id varchar(32) NOT NULL,
+  executed_at datetime NOT NULL,
+  os_user varchar(128) NOT NULL,
+  environment varchar(128) NOT NULL,
+  schema_name varchar(64) NOT NULL,
+  table_name varchar(64) NOT NULL,
+  statement mediumtext NOT NULL,
+  wrapper tinyint(1) NOT NULL,
+  git_commit varchar(64) DEFAULT NULL,
+  duration_seconds decimal(12,3) NOT NULL,
+  result varchar(16) NOT NULL,
+  error text,
+  PRIMARY KEY (id),
+  KEY schema_table (schema_name, table_name),
+  KEY push_id (push_id)
+)`
+
+// HistoryEntry represents a single row of the history table.
+type HistoryEntry struct {
+	ID         uint64  `db:"id"`
+	PushID     string  `db:"push_id"`
+	ExecutedAt string  `db:"executed_at"`
+	OSUser     string  `db:"os_user"`
+	Statement  string  `db:"statement"`
+	Table      string  `db:"table_name"`
+	Wrapper    bool    `db:"wrapper"`
+	GitCommit  *string `db:"git_commit"`
+	Duration   float64 `db:"duration_seconds"`
+	Result     string  `db:"result"`
+	Error      *string `db:"error"`
+}
+
+// newPushID returns a random identifier which groups together all history
+// entries from a single run of `skeema push`.
+func newPushID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// gitCommit returns the commit hash of HEAD in the git repo containing
+// dirPath, or an empty string if dirPath is not in a git repo or git is not
+// available.
+func gitCommit(dirPath string) string {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dirPath
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// historyTableIdentifier returns the escaped name of the history table within
+// the supplied history schema.
+func historyTableIdentifier(historySchema string) string {
+	return fmt.Sprintf("%s.%s", tengo.EscapeIdentifier(historySchema), tengo.EscapeIdentifier(historyTableName))
+}
+
+// prepareHistoryTable creates the history schema and history table on
+// instance, if they do not already exist.
+func prepareHistoryTable(instance *tengo.Instance, historySchema string) error {
+	db, err := instance.Connect("", "")
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", tengo.EscapeIdentifier(historySchema))); err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(historyTableCreate, historyTableIdentifier(historySchema)))
+	return err
+}
+
+// insertHistoryRow inserts entry into the history table on instance. The table
+// must have already been created by prepareHistoryTable.
+func insertHistoryRow(instance *tengo.Instance, historySchema string, entry AuditEntry) error {
+	db, err := instance.Connect("", "")
+	if err != nil {
+		return err
+	}
+	var commit, errText interface{}
+	if entry.GitCommit != "" {
+		commit = entry.GitCommit
+	}
+	if entry.Error != "" {
+		errText = entry.Error
+	}
+	query := fmt.Sprintf(`INSERT INTO %s
+		(push_id, executed_at, os_user, environment, schema_name, table_name, statement, wrapper, git_commit, duration_seconds, result, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, historyTableIdentifier(historySchema))
+	_, err = db.Exec(query,
+		entry.PushID, entry.Time.Format("2006-01-02 15:04:05"), entry.OSUser, entry.Environment, entry.Schema,
+		entry.Table, entry.Statement, entry.Wrapper, commit, entry.Duration, entry.Result, errText)
+	return err
+}
+
+// queryHistory returns up to limit entries from the history table on instance
+// for the named schema, newest first. If tableName is non-empty, only entries
+// for that table are returned. A limit of 0 means no limit. If the history
+// table does not exist on instance, no entries and no error are returned.
+func queryHistory(instance *tengo.Instance, historySchema, schemaName, tableName string, limit int) ([]HistoryEntry, error) {
+	db, err := instance.Connect("", "")
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		SELECT id, push_id, executed_at, os_user, statement, table_name, wrapper,
+		       git_commit, duration_seconds, result, error
+		FROM   %s
+		WHERE  schema_name = ?`, historyTableIdentifier(historySchema))
+	args := []interface{}{schemaName}
+	if tableName != "" {
+		query += " AND table_name = ?"
+		args = append(args, tableName)
+	}
+	query += " ORDER BY id DESC"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	var entries []HistoryEntry
+	err = db.Select(&entries, query, args...)
+	if historyTableMissing(err) {
+		return nil, nil
+	}
+	return entries, err
+}
+
+// lastPushAge returns the number of seconds since the most recent successful
+// statement recorded in the history table on instance for the named schema.
+// If no such statement has been recorded, or the history table does not exist,
+// nil is returned.
+func lastPushAge(instance *tengo.Instance, historySchema, schemaName string) (*int64, error) {
+	db, err := instance.Connect("", "")
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		SELECT TIMESTAMPDIFF(SECOND, MAX(executed_at), UTC_TIMESTAMP())
+		FROM   %s
+		WHERE  schema_name = ? AND result = 'success'`, historyTableIdentifier(historySchema))
+	var age *int64
+	err = db.Get(&age, query, schemaName)
+	if historyTableMissing(err) {
+		return nil, nil
+	}
+	return age, err
+}
+
+// historyTableMissing returns true if err indicates that the history schema or
+// history table does not exist.
+func historyTableMissing(err error) bool {
+	merr, ok := err.(*mysql.MySQLError)
+	return ok && (merr.Number == mysqlerr.ER_NO_SUCH_TABLE || merr.Number == mysqlerr.ER_BAD_DB_ERROR)
+}
+
+var whitespaceRun = regexp.MustCompile(`\s+`)
+
+// singleLine collapses all runs of whitespace in s, including newlines, into
+// single spaces.
+func singleLine(s string) string {
+	return whitespaceRun.ReplaceAllString(strings.TrimSpace(s), " ")
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestNewPushID(t *testing.T) {
+	a, b := newPushID(), newPushID()
+	if len(a) != 16 || a == b {
+		t.Errorf("Unexpected push IDs: %q, %q", a, b)
+	}
+}
+
+func TestGitCommit(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "skeematest")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	if commit := gitCommit(tempDir); commit != "" {
+		t.Errorf("Expected no commit for dir outside of a git repo, instead found %q", commit)
+	}
+}
+
+func TestHistoryTableIdentifier(t *testing.T) {
+	if actual := historyTableIdentifier("_skeema_history"); actual != "`_skeema_history`.`push_history`" {
+		t.Errorf("Unexpected history table identifier %q", actual)
+	}
+}
+
+func TestSingleLine(t *testing.T) {
+	input := "ALTER TABLE `widgets`\n\tADD COLUMN `name` varchar(30),  ADD KEY `name` (`name`)\n"
+	expected := "ALTER TABLE `widgets` ADD COLUMN `name` varchar(30), ADD KEY `name` (`name`)"
+	if actual := singleLine(input); actual != expected {
+		t.Errorf("Expected %q, instead found %q", expected, actual)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Interrupter handles SIGINT for commands which execute DDL, so that an
+// interrupt does not kill the process in the middle of a statement. After the
+// first interrupt, no new statements should be started, but statements which
+// are already running are permitted to complete. After a second interrupt,
+// running statements are canceled. Any further interrupt terminates the
+// process immediately, as usual.
+//
+// All methods are safe to call on a nil *Interrupter, which behaves as if no
+// interrupt is ever received.
+type Interrupter struct {
+	stopCtx    context.Context
+	stop       context.CancelFunc
+	cancelCtx  context.Context
+	cancel     context.CancelFunc
+	signals    chan os.Signal
+	count      int
+	closeOnce  sync.Once
+	sync.Mutex // protects count
+}
+
+// NewInterrupter returns an Interrupter which handles SIGINT until its Close
+// method is called.
+func NewInterrupter() *Interrupter {
+	i := &Interrupter{
+		signals: make(chan os.Signal, 1),
+	}
+	i.stopCtx, i.stop = context.WithCancel(context.Background())
+	i.cancelCtx, i.cancel = context.WithCancel(context.Background())
+	signal.Notify(i.signals, os.Interrupt)
+	go func() {
+		for range i.signals {
+			i.interrupt()
+		}
+	}()
+	return i
+}
+
+// interrupt handles a single interrupt.
+func (i *Interrupter) interrupt() {
+	i.Lock()
+	defer i.Unlock()
+	i.count++
+	switch i.count {
+	case 1:
+		log.Warn("Interrupt received: waiting for running statements to complete, and skipping all remaining statements. Interrupt again to cancel running statements.")
+		i.stop()
+	case 2:
+		log.Warn("Second interrupt received: canceling running statements. Interrupt again to exit immediately.")
+		i.cancel()
+		signal.Stop(i.signals)
+	}
+}
+
+// Stopping returns true if at least one interrupt has been received, in which
+// case no new statements should be started.
+func (i *Interrupter) Stopping() bool {
+	return i.StopContext().Err() != nil
+}
+
+// StopContext returns a context which is canceled upon the first interrupt.
+// It is suitable for waits which occur prior to starting a statement.
+func (i *Interrupter) StopContext() context.Context {
+	if i == nil {
+		return context.Background()
+	}
+	return i.stopCtx
+}
+
+// Context returns a context which is canceled upon the second interrupt. It
+// is suitable for executing statements.
+func (i *Interrupter) Context() context.Context {
+	if i == nil {
+		return context.Background()
+	}
+	return i.cancelCtx
+}
+
+// Close stops handling SIGINT, restoring the default behavior of terminating
+// the process. Stopping continues to report whether an interrupt was received
+// prior to Close.
+func (i *Interrupter) Close() {
+	if i == nil {
+		return
+	}
+	i.closeOnce.Do(func() {
+		signal.Stop(i.signals)
+		close(i.signals)
+	})
+}
+
+// callWithContext calls fn, and waits for it to return or for ctx to be canceled,
+// whichever happens first. This permits abandoning operations which do not
+// accept a context themselves, such as schema introspection queries run by
+// tengo. If ctx is canceled first, ctx.Err() is returned while fn continues to
+// run in the background, so the caller must not use anything that fn writes.
+func callWithContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	} else if ctx.Done() == nil {
+		return fn()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
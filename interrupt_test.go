@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInterrupter(t *testing.T) {
+	i := NewInterrupter()
+	defer i.Close()
+	if i.Stopping() || i.Context().Err() != nil {
+		t.Fatal("Expected new Interrupter to not be stopping or canceled")
+	}
+	i.interrupt()
+	if !i.Stopping() || i.StopContext().Err() == nil {
+		t.Error("Expected Interrupter to be stopping after first interrupt")
+	}
+	if i.Context().Err() != nil {
+		t.Error("Expected Interrupter to not cancel running statements after first interrupt")
+	}
+	i.interrupt()
+	if i.Context().Err() == nil {
+		t.Error("Expected Interrupter to cancel running statements after second interrupt")
+	}
+	i.Close()
+	if !i.Stopping() {
+		t.Error("Expected Interrupter to still report stopping after Close")
+	}
+
+	// nil Interrupter never stops
+	var nilInterrupter *Interrupter
+	if nilInterrupter.Stopping() || nilInterrupter.Context().Err() != nil || nilInterrupter.StopContext().Done() != nil {
+		t.Error("Expected nil Interrupter to never stop or cancel")
+	}
+	nilInterrupter.Close()
+}
+
+func TestCallWithContext(t *testing.T) {
+	expected := errors.New("expected")
+	if err := callWithContext(context.Background(), func() error { return expected }); err != expected {
+		t.Errorf("Expected callWithContext to return error from fn, instead found %v", err)
+	}
+
+	// Canceling ctx should abandon a call that is still in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := callWithContext(ctx, func() error { <-release; return nil }); err != context.Canceled {
+		t.Errorf("Expected callWithContext to return context.Canceled, instead found %v", err)
+	}
+
+	// fn should not be called at all if ctx is already canceled
+	var called bool
+	if err := callWithContext(ctx, func() error { called = true; return nil }); err != context.Canceled || called {
+		t.Errorf("Unexpected result from callWithContext with canceled ctx: err=%v, called=%t", err, called)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VividCortex/mysqlerr"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/skeema/mybase"
+)
+
+// lockWaitOptions controls how DDL run directly against a DB handles waiting
+// for metadata locks. The zero value uses the server's lock_wait_timeout, and
+// performs no transaction pre-check or retries.
+type lockWaitOptions struct {
+	timeout    int           // session lock_wait_timeout in seconds, or 0 for server default
+	maxTrxAge  int           // seconds; 0 disables pre-check for long-running transactions
+	retries    int           // number of times to retry after a lock wait timeout
+	retryDelay time.Duration // delay before first retry; doubled before each subsequent retry
+}
+
+// newLockWaitOptions returns lockWaitOptions based on the values of the
+// lock-wait-timeout, max-transaction-age, lock-wait-retries, and
+// lock-wait-retry-delay options in cfg.
+func newLockWaitOptions(cfg *mybase.Config) (lw lockWaitOptions, err error) {
+	values := []struct {
+		name string
+		dest *int
+	}{
+		{"lock-wait-timeout", &lw.timeout},
+		{"max-transaction-age", &lw.maxTrxAge},
+		{"lock-wait-retries", &lw.retries},
+	}
+	for _, v := range values {
+		if *v.dest, err = cfg.GetInt(v.name); err != nil {
+			return lockWaitOptions{}, err
+		} else if *v.dest < 0 {
+			return lockWaitOptions{}, fmt.Errorf("Option %s cannot be negative", v.name)
+		}
+	}
+	delay, err := cfg.GetInt("lock-wait-retry-delay")
+	if err != nil {
+		return lockWaitOptions{}, err
+	} else if delay < 0 {
+		return lockWaitOptions{}, fmt.Errorf("Option lock-wait-retry-delay cannot be negative")
+	}
+	lw.retryDelay = time.Duration(delay) * time.Second
+	return lw, nil
+}
+
+// params returns connection params for DDL connections, setting the session
+// lock_wait_timeout if configured.
+func (lw lockWaitOptions) params() string {
+	if lw.timeout > 0 {
+		return fmt.Sprintf("lock_wait_timeout=%d", lw.timeout)
+	}
+	return ""
+}
+
+// LongTransaction represents a transaction which has been open for longer than
+// permitted by the max-transaction-age option.
+type LongTransaction struct {
+	ThreadID int64  `db:"id"`
+	User     string `db:"user"`
+	Host     string `db:"host"`
+	Age      int64  `db:"age"`
+}
+
+// LongTransactionError is returned when long-running transactions could block
+// DDL from obtaining a metadata lock.
+type LongTransactionError struct {
+	Schema       string
+	MaxAge       int
+	Transactions []LongTransaction
+}
+
+// Error satisfies the builtin error interface.
+func (lte *LongTransactionError) Error() string {
+	descriptions := make([]string, len(lte.Transactions))
+	for n, trx := range lte.Transactions {
+		descriptions[n] = fmt.Sprintf("thread %d (%s@%s, open %ds)", trx.ThreadID, trx.User, trx.Host, trx.Age)
+	}
+	return fmt.Sprintf("Found %d transaction%s in schema %s open longer than max-transaction-age=%ds, which could block DDL from obtaining a metadata lock: %s",
+		len(lte.Transactions), pluralSuffix(len(lte.Transactions)), lte.Schema, lte.MaxAge, strings.Join(descriptions, ", "))
+}
+
+// checkLongTransactions returns a *LongTransactionError if any InnoDB
+// transaction has been open for more than maxAge seconds in a session holding
+// a metadata lock on a table in schemaName. If performance_schema metadata lock
+// instrumentation is unavailable, sessions whose default database is
+// schemaName are checked instead, which cannot detect transactions that access
+// the schema only by qualified table names.
+func checkLongTransactions(ctx context.Context, db *sqlx.DB, schemaName string, maxAge int) error {
+	var transactions []LongTransaction
+	filter := "p.db = ?"
+	if metadataLocksInstrumented(ctx, db) {
+		filter = `EXISTS (
+		           SELECT 1
+		           FROM   performance_schema.metadata_locks ml
+		           JOIN   performance_schema.threads th ON th.thread_id = ml.owner_thread_id
+		           WHERE  th.processlist_id = p.id
+		           AND    ml.object_type = 'TABLE' AND ml.object_schema = ?)`
+	}
+	query := `
+		SELECT   p.id AS id, p.user AS user, p.host AS host,
+		         TIMESTAMPDIFF(SECOND, t.trx_started, NOW()) AS age
+		FROM     information_schema.innodb_trx t
+		JOIN     information_schema.processlist p ON p.id = t.trx_mysql_thread_id
+		WHERE    ` + filter + ` AND p.id != CONNECTION_ID()
+		AND      t.trx_started < NOW() - INTERVAL ? SECOND
+		ORDER BY t.trx_started`
+	if err := db.SelectContext(ctx, &transactions, query, schemaName, maxAge); err != nil {
+		return fmt.Errorf("Unable to check for long-running transactions: %s", err)
+	}
+	if len(transactions) == 0 {
+		return nil
+	}
+	return &LongTransactionError{
+		Schema:       schemaName,
+		MaxAge:       maxAge,
+		Transactions: transactions,
+	}
+}
+
+// metadataLocksInstrumented returns true if performance_schema is enabled and
+// instruments metadata locks, which is the default in MySQL 8.0, but must be
+// enabled manually in MySQL 5.7. Any error, such as a lack of privileges or a
+// server version without performance_schema.metadata_locks, yields false.
+func metadataLocksInstrumented(ctx context.Context, db *sqlx.DB) bool {
+	var enabled string
+	query := `
+		SELECT ENABLED
+		FROM   performance_schema.setup_instruments
+		WHERE  NAME = 'wait/lock/metadata/sql/mdl'`
+	if err := db.QueryRowContext(ctx, query).Scan(&enabled); err != nil {
+		return false
+	}
+	return enabled == "YES"
+}
+
+// lockWaitRetryable returns true if err indicates that DDL could not obtain a
+// metadata lock, either due to a lock wait timeout or long-running
+// transactions, in which case it may succeed if retried later.
+func lockWaitRetryable(err error) bool {
+	switch err := err.(type) {
+	case *LongTransactionError:
+		return true
+	case *mysql.MySQLError:
+		return err.Number == mysqlerr.ER_LOCK_WAIT_TIMEOUT
+	}
+	return false
+}
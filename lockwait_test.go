@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VividCortex/mysqlerr"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestNewLockWaitOptions(t *testing.T) {
+	values := map[string]string{
+		"lock-wait-timeout":     "10",
+		"max-transaction-age":   "60",
+		"lock-wait-retries":     "3",
+		"lock-wait-retry-delay": "5",
+	}
+	lw, err := newLockWaitOptions(getConfig(values))
+	if err != nil {
+		t.Fatalf("Unexpected error from newLockWaitOptions: %s", err)
+	}
+	expected := lockWaitOptions{timeout: 10, maxTrxAge: 60, retries: 3, retryDelay: 5 * time.Second}
+	if lw != expected {
+		t.Errorf("Expected newLockWaitOptions to return %+v, instead found %+v", expected, lw)
+	}
+	if params := lw.params(); params != "lock_wait_timeout=10" {
+		t.Errorf("Unexpected result from params(): %q", params)
+	}
+	if params := (lockWaitOptions{}).params(); params != "" {
+		t.Errorf("Expected params() of zero value to be empty string, instead found %q", params)
+	}
+
+	for _, name := range []string{"lock-wait-timeout", "max-transaction-age", "lock-wait-retries", "lock-wait-retry-delay"} {
+		for _, badValue := range []string{"-1", "abc"} {
+			orig := values[name]
+			values[name] = badValue
+			if _, err := newLockWaitOptions(getConfig(values)); err == nil {
+				t.Errorf("Expected error from newLockWaitOptions with %s=%s, but err was nil", name, badValue)
+			}
+			values[name] = orig
+		}
+	}
+}
+
+func TestLongTransactionError(t *testing.T) {
+	lte := &LongTransactionError{
+		Schema: "product",
+		MaxAge: 60,
+		Transactions: []LongTransaction{
+			{ThreadID: 123, User: "app", Host: "10.0.0.5:51234", Age: 3600},
+			{ThreadID: 456, User: "report", Host: "10.0.0.6:40000", Age: 75},
+		},
+	}
+	expected := "Found 2 transactions in schema product open longer than max-transaction-age=60s, which could block DDL from obtaining a metadata lock: thread 123 (app@10.0.0.5:51234, open 3600s), thread 456 (report@10.0.0.6:40000, open 75s)"
+	if actual := lte.Error(); actual != expected {
+		t.Errorf("Unexpected error message:\n%s", actual)
+	}
+}
+
+func TestLockWaitRetryable(t *testing.T) {
+	cases := map[error]bool{
+		&LongTransactionError{}:                                      true,
+		&mysql.MySQLError{Number: mysqlerr.ER_LOCK_WAIT_TIMEOUT}:     true,
+		&mysql.MySQLError{Number: mysqlerr.ER_DUP_FIELDNAME}:         false,
+		errors.New("Lock wait timeout exceeded; try restarting trx"): false,
+	}
+	for err, expected := range cases {
+		if actual := lockWaitRetryable(err); actual != expected {
+			t.Errorf("Expected lockWaitRetryable(%v) to return %t, instead found %t", err, expected, actual)
+		}
+	}
+}
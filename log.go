@@ -11,9 +11,7 @@ import (
 )
 
 func init() {
-	log.SetFormatter(&customFormatter{
-		isTerminal: terminal.IsTerminal(int(os.Stderr.Fd())),
-	})
+	setLogFormat("text")
 }
 
 type customFormatter struct {
@@ -56,3 +54,52 @@ func (f *customFormatter) Format(entry *log.Entry) ([]byte, error) {
 	fmt.Fprintf(b, "%s %s %s\n", entry.Time.Format("2006-01-02 15:04:05"), levelText, entry.Message)
 	return b.Bytes(), nil
 }
+
+// jsonFormatter emits one JSON object per log entry, containing the level,
+// timestamp, message, and any structured fields attached to the entry.
+type jsonFormatter struct {
+	log.JSONFormatter
+}
+
+func newJSONFormatter() *jsonFormatter {
+	return &jsonFormatter{
+		JSONFormatter: log.JSONFormatter{
+			FieldMap: log.FieldMap{
+				log.FieldKeyTime: "timestamp",
+				log.FieldKeyMsg:  "message",
+			},
+		},
+	}
+}
+
+func (f *jsonFormatter) Format(entry *log.Entry) ([]byte, error) {
+	// Some messages end in a newline for visual spacing in text format, which is
+	// not meaningful in JSON
+	entry.Message = strings.TrimRight(entry.Message, "\n")
+	return f.JSONFormatter.Format(entry)
+}
+
+// setLogFormat changes the format used for all subsequent log entries. The
+// supplied format must be "text" or "json".
+func setLogFormat(format string) error {
+	switch format {
+	case "text":
+		log.SetFormatter(&customFormatter{
+			isTerminal: terminal.IsTerminal(int(os.Stderr.Fd())),
+		})
+	case "json":
+		log.SetFormatter(newJSONFormatter())
+	default:
+		return fmt.Errorf("Unsupported log format %q", format)
+	}
+	return nil
+}
+
+// logSpacer writes a blank line to STDERR, for visual separation between
+// groups of log lines. Nothing is written when using the JSON log format, since
+// a blank line would not be a valid JSON object.
+func logSpacer() {
+	if _, isJSON := log.StandardLogger().Formatter.(*jsonFormatter); !isJSON {
+		os.Stderr.WriteString("\n")
+	}
+}
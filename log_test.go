@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestJSONFormatter(t *testing.T) {
+	entry := log.WithFields(log.Fields{"instance": "db1:3306", "schema": "product", "table": "widgets"})
+	entry.Time = time.Date(2017, 6, 1, 12, 30, 0, 0, time.UTC)
+	entry.Level = log.WarnLevel
+	entry.Message = "Skipping table widgets\n"
+
+	formatted, err := newJSONFormatter().Format(entry)
+	if err != nil {
+		t.Fatalf("Unexpected error from Format: %s", err)
+	}
+	var decoded map[string]string
+	if err := json.Unmarshal(formatted, &decoded); err != nil {
+		t.Fatalf("Unable to decode output %q: %s", formatted, err)
+	}
+	expected := map[string]string{
+		"level":     "warning",
+		"timestamp": "2017-06-01T12:30:00Z",
+		"message":   "Skipping table widgets",
+		"instance":  "db1:3306",
+		"schema":    "product",
+		"table":     "widgets",
+	}
+	if len(decoded) != len(expected) {
+		t.Errorf("Expected %d keys, instead found %d: %v", len(expected), len(decoded), decoded)
+	}
+	for k, v := range expected {
+		if decoded[k] != v {
+			t.Errorf("Expected key %s to have value %q, instead found %q", k, v, decoded[k])
+		}
+	}
+}
+
+func TestSetLogFormat(t *testing.T) {
+	defer setLogFormat("text")
+	if err := setLogFormat("json"); err != nil {
+		t.Errorf("Unexpected error from setLogFormat: %s", err)
+	}
+	if err := setLogFormat("xml"); err == nil {
+		t.Error("Expected error from setLogFormat with invalid format, but no error returned")
+	}
+}
+
+func TestLogSpacer(t *testing.T) {
+	defer setLogFormat("text")
+	origStderr := os.Stderr
+	defer func() { os.Stderr = origStderr }()
+
+	for format, expected := range map[string]string{"text": "\n", "json": ""} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("Unable to create pipe: %s", err)
+		}
+		os.Stderr = w
+		setLogFormat(format)
+		logSpacer()
+		w.Close()
+		os.Stderr = origStderr
+		output, _ := ioutil.ReadAll(r)
+		r.Close()
+		if string(output) != expected {
+			t.Errorf("Expected logSpacer with log-format=%s to write %q, instead found %q", format, expected, output)
+		}
+	}
+}
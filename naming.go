@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/skeema/mybase"
+	"github.com/skeema/tengo"
+)
+
+// reForeignKeyName is a regexp for extracting foreign key constraint names
+// from a CREATE TABLE statement. tengo.Table does not yet track foreign keys,
+// so they must be parsed out of the statement directly.
+var reForeignKeyName = regexp.MustCompile("(?i)CONSTRAINT `((?:[^`]|``)+)` FOREIGN KEY")
+
+// NamingPolicy represents a set of naming conventions for tables, columns,
+// indexes, and foreign keys. Each field is a regular expression that names of
+// that type must match; a nil field means that type of name is unrestricted.
+type NamingPolicy struct {
+	Table       *regexp.Regexp
+	Column      *regexp.Regexp
+	Index       *regexp.Regexp
+	UniqueIndex *regexp.Regexp
+	ForeignKey  *regexp.Regexp
+}
+
+// NewNamingPolicy returns a NamingPolicy based on the naming-* options in the
+// supplied configuration. An error is returned if any of these options has a
+// value that is not a valid regular expression.
+func NewNamingPolicy(cfg *mybase.Config) (*NamingPolicy, error) {
+	np := &NamingPolicy{}
+	var err error
+	if np.Table, err = cfg.GetRegexp("naming-table"); err != nil {
+		return nil, err
+	}
+	if np.Column, err = cfg.GetRegexp("naming-column"); err != nil {
+		return nil, err
+	}
+	if np.Index, err = cfg.GetRegexp("naming-index"); err != nil {
+		return nil, err
+	}
+	if np.UniqueIndex, err = cfg.GetRegexp("naming-unique-index"); err != nil {
+		return nil, err
+	}
+	if np.ForeignKey, err = cfg.GetRegexp("naming-foreign-key"); err != nil {
+		return nil, err
+	}
+	return np, nil
+}
+
+// Violations returns a slice of errors, one for each name in the supplied
+// table that does not conform to the policy. The returned slice will be empty
+// if the table is fully compliant.
+func (np *NamingPolicy) Violations(table *tengo.Table) []error {
+	return np.changedViolations(nil, table)
+}
+
+// changedViolations returns a slice of errors, one for each name in table that
+// does not conform to the policy and is not already present in from, which
+// should be the version of the table prior to an ALTER. If from is nil, all
+// names in table are checked. An index is checked if its name is new, or if
+// its uniqueness differs from the same-named index in from, since that changes
+// which option applies to it.
+func (np *NamingPolicy) changedViolations(from, table *tengo.Table) []error {
+	var violations []error
+	var fromColumns map[string]*tengo.Column
+	var fromIndexes map[string]*tengo.Index
+	fromForeignKeys := make(map[string]bool)
+	if from != nil {
+		fromColumns = from.ColumnsByName()
+		fromIndexes = from.SecondaryIndexesByName()
+		if np.ForeignKey != nil {
+			for _, name := range foreignKeyNames(from.CreateStatement()) {
+				fromForeignKeys[name] = true
+			}
+		}
+	}
+
+	if from == nil && np.Table != nil && !np.Table.MatchString(table.Name) {
+		violations = append(violations, fmt.Errorf("Table name %s does not match naming-table='%s'", table.Name, np.Table))
+	}
+	if np.Column != nil {
+		for _, col := range table.Columns {
+			if fromColumns[col.Name] == nil && !np.Column.MatchString(col.Name) {
+				violations = append(violations, fmt.Errorf("Column name %s.%s does not match naming-column='%s'", table.Name, col.Name, np.Column))
+			}
+		}
+	}
+	for _, idx := range table.SecondaryIndexes {
+		if fromIdx := fromIndexes[idx.Name]; fromIdx != nil && fromIdx.Unique == idx.Unique {
+			continue
+		}
+		if idx.Unique {
+			if np.UniqueIndex != nil && !np.UniqueIndex.MatchString(idx.Name) {
+				violations = append(violations, fmt.Errorf("Unique index name %s on table %s does not match naming-unique-index='%s'", idx.Name, table.Name, np.UniqueIndex))
+			}
+		} else if np.Index != nil && !np.Index.MatchString(idx.Name) {
+			violations = append(violations, fmt.Errorf("Index name %s on table %s does not match naming-index='%s'", idx.Name, table.Name, np.Index))
+		}
+	}
+	if np.ForeignKey != nil {
+		for _, name := range foreignKeyNames(table.CreateStatement()) {
+			if !fromForeignKeys[name] && !np.ForeignKey.MatchString(name) {
+				violations = append(violations, fmt.Errorf("Foreign key name %s on table %s does not match naming-foreign-key='%s'", name, table.Name, np.ForeignKey))
+			}
+		}
+	}
+	return violations
+}
+
+// DiffViolations returns naming policy violations for all tables that would be
+// created or altered by the supplied diff. The checked version of each table is
+// always the one from diff.ToSchema. All names in created tables are checked,
+// but for altered tables, only names which the ALTER adds or changes are
+// checked, so that pre-existing violations do not block unrelated changes.
+// Tables matching ignoreTable are skipped, as are tables that are unchanged,
+// dropped, or unsupported for diff purposes.
+func (np *NamingPolicy) DiffViolations(diff *tengo.SchemaDiff, ignoreTable *regexp.Regexp) []error {
+	var violations []error
+	for _, tableDiff := range diff.TableDiffs {
+		var name string
+		var from *tengo.Table
+		switch td := tableDiff.(type) {
+		case tengo.CreateTable:
+			name = td.Table.Name
+		case tengo.AlterTable:
+			name, from = td.Table.Name, td.Table
+		default:
+			continue
+		}
+		if ignoreTable != nil && ignoreTable.MatchString(name) {
+			continue
+		}
+		table, err := diff.ToSchema.Table(name)
+		if err != nil || table == nil {
+			continue
+		}
+		violations = append(violations, np.changedViolations(from, table)...)
+	}
+	return violations
+}
+
+// foreignKeyNames returns the names of all foreign key constraints present in
+// the supplied CREATE TABLE statement.
+func foreignKeyNames(createStatement string) []string {
+	var names []string
+	for _, match := range reForeignKeyName.FindAllStringSubmatch(createStatement, -1) {
+		names = append(names, strings.Replace(match[1], "``", "`", -1))
+	}
+	return names
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/skeema/mybase"
+	"github.com/skeema/tengo"
+)
+
+func TestNamingPolicyViolations(t *testing.T) {
+	table := &tengo.Table{
+		Name: "users",
+		Columns: []*tengo.Column{
+			{Name: "id"},
+			{Name: "email"},
+			{Name: "CreatedAt"},
+		},
+		SecondaryIndexes: []*tengo.Index{
+			{Name: "idx_created", Unique: false},
+			{Name: "uk_email", Unique: true},
+			{Name: "email_2", Unique: true},
+			{Name: "created_2", Unique: false},
+		},
+	}
+	getNamingConfig := func(values map[string]string) *mybase.Config {
+		cmd := mybase.NewCommand("test", "1.0", "this is for testing", nil)
+		AddGlobalOptions(cmd)
+		cli := &mybase.CommandLine{
+			Command: cmd,
+		}
+		return mybase.NewConfig(cli, dummySource(values)) // see dir_test.go
+	}
+	assertViolationCount := func(values map[string]string, expected int) {
+		policy, err := NewNamingPolicy(getNamingConfig(values))
+		if err != nil {
+			t.Fatalf("Unexpected error from NewNamingPolicy with %v: %s", values, err)
+		}
+		if violations := policy.Violations(table); len(violations) != expected {
+			t.Errorf("With %v, expected %d violations, instead found %d: %v", values, expected, len(violations), violations)
+		}
+	}
+	assertViolationCount(map[string]string{}, 0)
+	assertViolationCount(map[string]string{"naming-table": "^[a-z_]+$"}, 0)
+	assertViolationCount(map[string]string{"naming-table": "^tbl_"}, 1)
+	assertViolationCount(map[string]string{"naming-column": "^[a-z_]+$"}, 1)
+	assertViolationCount(map[string]string{"naming-index": "^idx_"}, 1)
+	assertViolationCount(map[string]string{"naming-index": "^idx_", "naming-unique-index": "^uk_"}, 2)
+	assertViolationCount(map[string]string{"naming-unique-index": "^uk_"}, 1)
+
+	// Only names added or changed relative to the original table are checked
+	from := &tengo.Table{
+		Name:    "users",
+		Columns: []*tengo.Column{{Name: "id"}, {Name: "CreatedAt"}},
+		SecondaryIndexes: []*tengo.Index{
+			{Name: "idx_created", Unique: false},
+			{Name: "email_2", Unique: false},
+			{Name: "created_2", Unique: false},
+		},
+	}
+	policy, err := NewNamingPolicy(getNamingConfig(map[string]string{
+		"naming-table":        "^tbl_",
+		"naming-column":       "^[a-z]+$",
+		"naming-index":        "^idx_",
+		"naming-unique-index": "^uk_",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error from NewNamingPolicy: %s", err)
+	}
+	violations := policy.changedViolations(from, table)
+	expected := []string{
+		"Unique index name email_2 on table users does not match naming-unique-index='^uk_'",
+	}
+	if len(violations) != len(expected) {
+		t.Errorf("Expected %d violations, instead found %d: %v", len(expected), len(violations), violations)
+	} else {
+		for n := range expected {
+			if violations[n].Error() != expected[n] {
+				t.Errorf("Expected violation %q, instead found %q", expected[n], violations[n])
+			}
+		}
+	}
+
+	if _, err := NewNamingPolicy(getNamingConfig(map[string]string{"naming-table": "[invalid"})); err == nil {
+		t.Error("Expected NewNamingPolicy to return error for invalid regexp, but it did not")
+	}
+}
+
+func TestForeignKeyNames(t *testing.T) {
+	createStatement := "CREATE TABLE `orders` (\n" +
+		"  `id` int(10) unsigned NOT NULL,\n" +
+		"  `user_id` int(10) unsigned NOT NULL,\n" +
+		"  `item_id` int(10) unsigned NOT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  CONSTRAINT `fk_orders_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`),\n" +
+		"  CONSTRAINT `odd``name` FOREIGN KEY (`item_id`) REFERENCES `items` (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=latin1"
+	expected := []string{"fk_orders_user", "odd`name"}
+	if actual := foreignKeyNames(createStatement); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected foreignKeyNames to return %v, instead found %v", expected, actual)
+	}
+	if actual := foreignKeyNames("CREATE TABLE `foo` (`id` int) ENGINE=InnoDB"); len(actual) > 0 {
+		t.Errorf("Expected foreignKeyNames to return no names, instead found %v", actual)
+	}
+}
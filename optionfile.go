@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/skeema/mybase"
+)
+
+// OptionFile represents an option file, such as a .skeema file or ~/.my.cnf.
+// It wraps a mybase.File, adding support for the !include and !includedir
+// directives, which behave like the equivalent directives in MySQL's own
+// option files, as well as the !extends directive for section inheritance.
+type OptionFile struct {
+	*mybase.File
+	contents   string                             // raw contents as of the most recent parse or write
+	directives []optionFileDirective              // directive lines in contents, in order
+	sections   map[string]bool                    // sections present in contents
+	lines      map[string]map[string]int          // section name -> option name -> last line setting it in contents
+	options    []optionFileLine                   // option lines in contents, in order
+	extends    map[string]string                  // section name -> name of section it extends
+	origins    map[string]map[string]*mybase.File // section name -> option name -> included file supplying its value
+	pending    map[string]map[string]string       // section name -> option name -> value set since parse, for new sections only
+	pendingSeq []string                           // new section names in pending, in order of creation
+	modified   map[string]bool                    // sections present in contents that have been modified since parse
+	included   []*OptionFile                      // files included via directives, including nested ones
+	selected   []string                           // sections selected via UseSection, in priority order
+}
+
+// optionFileDirective represents a line of an option file beginning with "!".
+type optionFileDirective struct {
+	lineNumber int
+	section    string
+	name       string
+	value      string
+}
+
+// optionFileLine represents a line of an option file which sets an option.
+type optionFileLine struct {
+	lineNumber int
+	name       string
+	loose      bool
+}
+
+// NewOptionFile returns a value representing an option file. The arg(s) will
+// be joined to create a single path, as with mybase.NewFile.
+func NewOptionFile(paths ...string) *OptionFile {
+	return &OptionFile{
+		File:     mybase.NewFile(paths...),
+		selected: []string{""},
+	}
+}
+
+// Parse parses the file, including any files it includes via directives. A
+// Config object must be supplied so that the list of valid Options is known.
+//
+// The directive "!include path" causes the named file to be parsed, and its
+// values merged into the corresponding sections of this file. The directive
+// "!includedir path" does the same for every file in the named directory that
+// has a .cnf extension, in lexicographic order. Relative paths are interpreted
+// relative to the directory of the file containing the directive. Values from
+// included files override values appearing earlier in the including file, and
+// are overridden by values appearing later in it.
+//
+// The directive "!extends parent", appearing in a named section, causes that
+// section to inherit values from the section named parent. See UseSection for
+// how this affects option lookups. An error is returned if a section extends a
+// section which does not exist, or if sections extend each other cyclically.
+func (of *OptionFile) Parse(cfg *mybase.Config) error {
+	if err := of.parse(cfg, nil); err != nil {
+		return err
+	}
+	for section := range of.extends {
+		if _, err := of.SectionLineage(section); err != nil {
+			return fmt.Errorf("Error in %s: %s", of.Path(), err)
+		}
+	}
+	return nil
+}
+
+func (of *OptionFile) parse(cfg *mybase.Config, includeStack []string) error {
+	contents, err := ioutil.ReadFile(of.Path())
+	if err != nil {
+		return err
+	}
+	of.scan(string(contents))
+
+	// mybase.File does not understand directives, and treats them as unknown
+	// options. So if any are present, unknown options are checked separately.
+	if len(of.directives) > 0 {
+		ignoreUnknown := of.IgnoreUnknownOptions
+		of.File.IgnoreUnknownOptions = true
+		err := of.File.Parse(cfg)
+		of.File.IgnoreUnknownOptions = ignoreUnknown
+		if err != nil {
+			return err
+		}
+		for _, line := range of.options {
+			if !line.loose && !ignoreUnknown && cfg.FindOption(line.name) == nil {
+				return mybase.OptionNotDefinedError{Name: line.name, Source: fmt.Sprintf("%s line %d", of.Path(), line.lineNumber)}
+			}
+		}
+	} else if err := of.File.Parse(cfg); err != nil {
+		return err
+	}
+
+	includeStack = append(includeStack, of.Path())
+	for _, d := range of.directives {
+		if d.name == "extends" {
+			if d.section == "" {
+				return fmt.Errorf("Parse error in %s line %d: directive !extends may only be used inside a named section", of.Path(), d.lineNumber)
+			} else if d.value == "" {
+				return fmt.Errorf("Parse error in %s line %d: directive !extends requires a section name", of.Path(), d.lineNumber)
+			} else if parent, already := of.extends[d.section]; already {
+				return fmt.Errorf("Parse error in %s line %d: section [%s] already extends [%s]", of.Path(), d.lineNumber, d.section, parent)
+			}
+			of.extends[d.section] = d.value
+			continue
+		} else if d.name != "include" && d.name != "includedir" {
+			return fmt.Errorf("Parse error in %s line %d: unknown directive !%s", of.Path(), d.lineNumber, d.name)
+		}
+		paths, err := d.paths(of.Dir)
+		if err != nil {
+			return fmt.Errorf("Error processing !%s in %s line %d: %s", d.name, of.Path(), d.lineNumber, err)
+		}
+		for _, includePath := range paths {
+			if err := of.include(cfg, includePath, d.lineNumber, includeStack); err != nil {
+				return fmt.Errorf("Error processing !%s in %s line %d: %s", d.name, of.Path(), d.lineNumber, err)
+			}
+		}
+	}
+	return nil
+}
+
+// scan examines the raw contents of the file, recording information that
+// mybase.File does not expose: the location of directives and option lines.
+// Malformed lines are ignored here, since mybase.File.Parse reports them.
+func (of *OptionFile) scan(contents string) {
+	of.contents = contents
+	of.directives = nil
+	of.sections = map[string]bool{"": true}
+	of.lines = map[string]map[string]int{"": {}}
+	of.options = nil
+	of.extends = make(map[string]string)
+	of.origins = make(map[string]map[string]*mybase.File)
+	of.pending = make(map[string]map[string]string)
+	of.pendingSeq = nil
+	of.modified = make(map[string]bool)
+	of.included = nil
+
+	var section string
+	var lineNumber int
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimLeftFunc(scanner.Text(), unicode.IsSpace)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		switch line[0] {
+		case '[':
+			if end := strings.Index(line, "]"); end > -1 {
+				section = line[1:end]
+				of.sections[section] = true
+				if of.lines[section] == nil {
+					of.lines[section] = make(map[string]int)
+				}
+			}
+		case '!':
+			d := optionFileDirective{lineNumber: lineNumber, section: section}
+			line = strings.TrimRightFunc(line[1:], unicode.IsSpace)
+			if pos := strings.IndexFunc(line, unicode.IsSpace); pos > -1 {
+				d.name = strings.ToLower(line[0:pos])
+				d.value = strings.TrimLeftFunc(line[pos:], unicode.IsSpace)
+			} else {
+				d.name = strings.ToLower(line)
+			}
+			of.directives = append(of.directives, d)
+		default:
+			if pos := strings.IndexAny(line, "=#"); pos > -1 {
+				line = line[0:pos]
+			}
+			if name, _, _, loose := mybase.NormalizeOptionToken(line); name != "" {
+				of.lines[section][name] = lineNumber
+				of.options = append(of.options, optionFileLine{lineNumber: lineNumber, name: name, loose: loose})
+			}
+		}
+	}
+}
+
+// paths returns the paths of the files included by an !include or !includedir
+// directive. Relative paths are interpreted relative to dir.
+func (d optionFileDirective) paths(dir string) ([]string, error) {
+	if d.value == "" {
+		return nil, fmt.Errorf("directive !%s requires a path", d.name)
+	}
+	dirPath := d.value
+	if !filepath.IsAbs(dirPath) {
+		dirPath = filepath.Join(dir, dirPath)
+	}
+	if d.name == "include" {
+		return []string{dirPath}, nil
+	}
+	fileInfos, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, fi := range fileInfos {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".cnf") {
+			paths = append(paths, filepath.Join(dirPath, fi.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// include parses the option file at includePath, and merges its values into
+// the corresponding sections of of. lineNumber is the line of the directive,
+// which determines precedence relative to of's own values. includeStack should
+// contain the paths of of and all files that (directly or indirectly) included
+// of, in order to detect cycles.
+func (of *OptionFile) include(cfg *mybase.Config, includePath string, lineNumber int, includeStack []string) error {
+	included := NewOptionFile(includePath)
+	for _, stackPath := range includeStack {
+		if stackPath == included.Path() {
+			return fmt.Errorf("include cycle detected: %s", strings.Join(append(includeStack, included.Path()), " -> "))
+		}
+	}
+	included.IgnoreUnknownOptions = of.IgnoreUnknownOptions
+	if err := included.parse(cfg, includeStack); err != nil {
+		return err
+	}
+	if len(included.extends) > 0 {
+		return fmt.Errorf("directive !extends is not supported in included file %s", included.Path())
+	}
+	of.included = append(of.included, included)
+	of.included = append(of.included, included.included...)
+
+	for section, names := range included.optionNames() {
+		for name := range names {
+			value, ok := included.sectionValue(section, name)
+			if !ok || of.lines[section][name] > lineNumber {
+				continue
+			}
+			of.File.SetOptionValue(section, name, value)
+			if of.origins[section] == nil {
+				of.origins[section] = make(map[string]*mybase.File)
+			}
+			if origin := included.origins[section][name]; origin != nil {
+				of.origins[section][name] = origin // value came from a nested include
+			} else {
+				of.origins[section][name] = included.File
+			}
+		}
+	}
+	return nil
+}
+
+// optionNames returns the names of options that may have values in each
+// section of the file, including values obtained from included files.
+func (of *OptionFile) optionNames() map[string]map[string]bool {
+	result := make(map[string]map[string]bool)
+	add := func(section, name string) {
+		if result[section] == nil {
+			result[section] = make(map[string]bool)
+		}
+		result[section][name] = true
+	}
+	for section, names := range of.lines {
+		for name := range names {
+			add(section, name)
+		}
+	}
+	for section, names := range of.origins {
+		for name := range names {
+			add(section, name)
+		}
+	}
+	return result
+}
+
+// sectionValue returns the value of the named option in the named section
+// only, without falling back to the default section.
+func (of *OptionFile) sectionValue(section, name string) (string, bool) {
+	for _, s := range of.File.SectionsWithOption(name) {
+		if s == section {
+			defer of.File.UseSection(of.selected...)
+			_ = of.File.UseSection(section)
+			return of.File.OptionValue(name)
+		}
+	}
+	return "", false
+}
+
+// UseSection changes which section(s) of the file are used when calling
+// OptionValue, as with mybase.File.UseSection. If a section extends another
+// section via the !extends directive, its parent (and any further ancestors)
+// are checked immediately after it, at lower priority than the section itself.
+func (of *OptionFile) UseSection(names ...string) error {
+	of.selected = make([]string, 0, len(names)+1)
+	already := make(map[string]bool, len(names)+1)
+	var lineageErr error
+	for _, name := range names {
+		lineage, err := of.SectionLineage(name)
+		if err != nil && lineageErr == nil {
+			lineageErr = err
+		}
+		for _, ancestor := range lineage {
+			if !already[ancestor] {
+				already[ancestor] = true
+				of.selected = append(of.selected, ancestor)
+			}
+		}
+	}
+	if !already[""] {
+		of.selected = append(of.selected, "")
+	}
+	if err := of.File.UseSection(of.selected...); err != nil {
+		return err
+	} else if lineageErr != nil {
+		return fmt.Errorf("File %s: %s", of.Path(), lineageErr)
+	}
+	return nil
+}
+
+// SelectedSections returns the sections selected by the most recent call to
+// UseSection, in priority order, including the default section and any
+// sections extended by the selected sections.
+func (of *OptionFile) SelectedSections() []string {
+	return of.selected
+}
+
+// SectionLineage returns a slice beginning with the supplied section name,
+// followed by the name of the section it extends (if any), followed by that
+// section's parent, and so on. An error is returned if any section in the
+// chain extends a section which does not exist, or if a cycle is detected; in
+// either case, the returned slice still contains the valid portion of the
+// chain.
+func (of *OptionFile) SectionLineage(name string) ([]string, error) {
+	lineage := []string{name}
+	seen := map[string]bool{name: true}
+	for section, parent := name, of.extends[name]; parent != ""; section, parent = parent, of.extends[parent] {
+		if seen[parent] {
+			return lineage, fmt.Errorf("section inheritance cycle detected: [%s] -> [%s]", strings.Join(lineage, "] -> ["), parent)
+		} else if !of.HasSection(parent) {
+			return lineage, fmt.Errorf("section [%s] extends nonexistent section [%s]", section, parent)
+		}
+		lineage = append(lineage, parent)
+		seen[parent] = true
+	}
+	return lineage, nil
+}
+
+// SectionExtends returns the name of the section that the named section
+// extends, or an empty string if it does not extend another section.
+func (of *OptionFile) SectionExtends(name string) string {
+	return of.extends[name]
+}
+
+// HasSection returns true if the file has a section with the supplied name.
+func (of *OptionFile) HasSection(name string) bool {
+	return of.sections[name] || of.pending[name] != nil || of.File.HasSection(name)
+}
+
+// OptionValueSource returns the file which supplied the value of the named
+// option in the selected section(s): either the file itself, or a file it
+// included. Returns nil if the option has no value in the selected sections.
+func (of *OptionFile) OptionValueSource(optionName string) *mybase.File {
+	for _, section := range of.selected {
+		if _, ok := of.sectionValue(section, optionName); ok {
+			if origin := of.origins[section][optionName]; origin != nil {
+				return origin
+			}
+			return of.File
+		}
+	}
+	return nil
+}
+
+// IncludedFiles returns all files included by the option file, directly or
+// indirectly, in the order they were parsed.
+func (of *OptionFile) IncludedFiles() []*mybase.File {
+	files := make([]*mybase.File, len(of.included))
+	for n, included := range of.included {
+		files[n] = included.File
+	}
+	return files
+}
+
+// SetOptionValue sets an option value in the named section, as with
+// mybase.File.SetOptionValue.
+func (of *OptionFile) SetOptionValue(sectionName, optionName, value string) {
+	of.File.SetOptionValue(sectionName, optionName, value)
+	of.trackChange(sectionName, optionName, &value)
+}
+
+// UnsetOptionValue removes an option value in the named section, as with
+// mybase.File.UnsetOptionValue.
+func (of *OptionFile) UnsetOptionValue(sectionName, optionName string) {
+	of.File.UnsetOptionValue(sectionName, optionName)
+	of.trackChange(sectionName, optionName, nil)
+}
+
+// SetSectionExtends configures the named section to extend the section named
+// parent, creating the named section if it does not already exist. Supplying
+// an empty string for parent removes any inheritance. This is not persisted to
+// the file until Write is called. It is the caller's responsibility to ensure
+// parent exists and does not introduce a cycle.
+func (of *OptionFile) SetSectionExtends(name, parent string) {
+	if parent == "" {
+		delete(of.extends, name)
+	} else {
+		of.extends[name] = parent
+	}
+	of.trackChange(name, "", nil)
+}
+
+// trackChange records a modification to the file, so that Write can determine
+// whether the file can be written without losing its directives. A nil value
+// indicates an option being unset.
+func (of *OptionFile) trackChange(section, name string, value *string) {
+	if of.sections[section] {
+		of.modified[section] = true
+		return
+	}
+	if of.pending[section] == nil {
+		of.pending[section] = make(map[string]string)
+		of.pendingSeq = append(of.pendingSeq, section)
+	}
+	if name == "" {
+		return
+	} else if value == nil {
+		delete(of.pending[section], name)
+	} else {
+		of.pending[section][name] = *value
+	}
+}
+
+// Write writes out the file's contents to disk, as with mybase.File.Write.
+// mybase.File.Write does not retain directives, so if the file contains any,
+// or any section has been configured to extend another, Write only permits
+// adding new sections, which are appended to the file's existing contents. An
+// error is returned if any section already present in the file has been
+// modified.
+func (of *OptionFile) Write(overwrite bool) error {
+	if len(of.directives) == 0 && len(of.extends) == 0 {
+		return of.File.Write(overwrite)
+	}
+	if len(of.modified) > 0 {
+		return fmt.Errorf("%s contains !include, !includedir, or !extends directives, so it cannot be rewritten automatically. Please edit it manually", of.Path())
+	}
+
+	contents := of.contents
+	if contents != "" && !strings.HasSuffix(contents, "\n") {
+		contents += "\n"
+	}
+	for _, section := range of.pendingSeq {
+		contents += fmt.Sprintf("\n[%s]\n", section)
+		if parent := of.extends[section]; parent != "" {
+			contents += fmt.Sprintf("!extends %s\n", parent)
+		}
+		names := make([]string, 0, len(of.pending[section]))
+		for name := range of.pending[section] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			contents += fmt.Sprintf("%s=%s\n", name, of.pending[section][name])
+		}
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE
+	if overwrite {
+		flag |= os.O_TRUNC
+	} else {
+		flag |= os.O_EXCL
+	}
+	if err := writeFileFlag(of.Path(), contents, flag); err != nil {
+		return err
+	}
+	for _, section := range of.pendingSeq {
+		of.sections[section] = true
+	}
+	of.contents = contents
+	of.pending = make(map[string]map[string]string)
+	of.pendingSeq = nil
+	return nil
+}
+
+// writeFileFlag writes contents to the file at path, opened using the supplied
+// flags.
+func writeFileFlag(path, contents string, flag int) error {
+	f, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(contents)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
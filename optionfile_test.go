@@ -0,0 +1,250 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skeema/mybase"
+)
+
+// optionFileTestDir creates a temp dir containing the supplied files, mapping
+// relative path to contents. The caller should remove the dir when done.
+func optionFileTestDir(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "skeematest")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatalf("Unable to create dir for %s: %s", path, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+			t.Fatalf("Unable to write %s: %s", path, err)
+		}
+	}
+	return root
+}
+
+func optionFileTestConfig() *mybase.Config {
+	cmd := mybase.NewCommand("test", "1.0", "this is for testing", nil)
+	AddGlobalOptions(cmd)
+	return mybase.NewConfig(&mybase.CommandLine{Command: cmd})
+}
+
+func TestOptionFileInclude(t *testing.T) {
+	root := optionFileTestDir(t, map[string]string{
+		".skeema":            "user=before\nport=3306\n!include a.cnf\nport=3307\n[production]\nhost=db1\n",
+		"a.cnf":              "user=fromA\nport=4000\n!include nested/b.cnf\n[production]\nhost=dbA\nschema=fromA\n",
+		"nested/b.cnf":       "password=fromB\n",
+		"unknown.cnf":        "bogus=1\n",
+		"cycle/.skeema":      "!includedir conf.d\n",
+		"cycle/conf.d/x":     "!include ../.skeema\n",
+		"cycle/conf.d/y.cnf": "!include ../.skeema\n",
+	})
+	defer os.RemoveAll(root)
+	cfg := optionFileTestConfig()
+
+	f := NewOptionFile(root, ".skeema")
+	if err := f.Parse(cfg); err != nil {
+		t.Fatalf("Unexpected error from Parse: %s", err)
+	}
+	_ = f.UseSection("production")
+	assertValue := func(name, expectedValue, expectedSource string) {
+		if value, _ := f.OptionValue(name); value != expectedValue {
+			t.Errorf("Expected %s to have value %q, instead found %q", name, expectedValue, value)
+		}
+		if source := f.OptionValueSource(name); source == nil {
+			t.Errorf("Expected %s to have a source, but it did not", name)
+		} else if expectedPath := filepath.Join(root, expectedSource); source.Path() != expectedPath {
+			t.Errorf("Expected %s to come from %s, instead found %s", name, expectedPath, source.Path())
+		}
+	}
+	assertValue("user", "fromA", "a.cnf")
+	assertValue("port", "3307", ".skeema")
+	assertValue("password", "fromB", "nested/b.cnf")
+	assertValue("host", "db1", ".skeema")
+	assertValue("schema", "fromA", "a.cnf")
+	if source := f.OptionValueSource("socket"); source != nil {
+		t.Errorf("Expected no source for unset option, instead found %s", source.Path())
+	}
+	if included := f.IncludedFiles(); len(included) != 2 || included[0].Name != "a.cnf" || included[1].Name != "b.cnf" {
+		t.Errorf("Unexpected result from IncludedFiles: %v", included)
+	}
+
+	// Unknown options in included files are errors, unless ignored by the
+	// including file
+	contents := "!include unknown.cnf\n"
+	if err := ioutil.WriteFile(filepath.Join(root, ".skeema"), []byte(contents), 0666); err != nil {
+		t.Fatalf("Unable to write file: %s", err)
+	}
+	f = NewOptionFile(root, ".skeema")
+	if err := f.Parse(cfg); err == nil || !strings.Contains(err.Error(), "bogus") {
+		t.Errorf("Expected unknown option error, instead found %v", err)
+	}
+	f = NewOptionFile(root, ".skeema")
+	f.IgnoreUnknownOptions = true
+	if err := f.Parse(cfg); err != nil {
+		t.Errorf("Unexpected error from Parse with IgnoreUnknownOptions: %s", err)
+	}
+
+	f = NewOptionFile(root, "cycle", ".skeema")
+	if err := f.Parse(cfg); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected include cycle error, instead found %v", err)
+	}
+}
+
+func TestOptionFileWrite(t *testing.T) {
+	original := "# comment\nuser=ownuser\n!include a.cnf\n[production]\nhost=db1\n"
+	root := optionFileTestDir(t, map[string]string{
+		".skeema": original,
+		"a.cnf":   "port=3307\n",
+		"plain":   "user=ownuser\n",
+	})
+	defer os.RemoveAll(root)
+	cfg := optionFileTestConfig()
+
+	// Adding new sections to a file with directives appends to its contents
+	f := NewOptionFile(root, ".skeema")
+	if err := f.Parse(cfg); err != nil {
+		t.Fatalf("Unexpected error from Parse: %s", err)
+	}
+	f.SetOptionValue("staging", "port", "3308")
+	f.SetOptionValue("staging", "host", "db2")
+	f.SetOptionValue("dev", "host", "localhost")
+	f.UnsetOptionValue("dev", "host")
+	if err := f.Write(true); err != nil {
+		t.Fatalf("Unexpected error from Write: %s", err)
+	}
+	expected := original + "\n[staging]\nhost=db2\nport=3308\n\n[dev]\n"
+	if contents, _ := ioutil.ReadFile(f.Path()); string(contents) != expected {
+		t.Errorf("Unexpected file contents after Write:\n%s", contents)
+	}
+	f.SetOptionValue("ci", "host", "db3")
+	if err := f.Write(true); err != nil {
+		t.Fatalf("Unexpected error from Write: %s", err)
+	}
+	expected += "\n[ci]\nhost=db3\n"
+	if contents, _ := ioutil.ReadFile(f.Path()); string(contents) != expected {
+		t.Errorf("Unexpected file contents after second Write:\n%s", contents)
+	}
+
+	// Modifying existing sections of a file with directives is an error
+	for _, section := range []string{"", "production", "staging"} {
+		f = NewOptionFile(root, ".skeema")
+		if err := f.Parse(cfg); err != nil {
+			t.Fatalf("Unexpected error from Parse: %s", err)
+		}
+		f.SetOptionValue(section, "port", "3309")
+		if err := f.Write(true); err == nil {
+			t.Errorf("Expected error from Write after modifying section %q, but none returned", section)
+		}
+	}
+	if contents, _ := ioutil.ReadFile(f.Path()); string(contents) != expected {
+		t.Errorf("File contents unexpectedly changed after failed Write:\n%s", contents)
+	}
+
+	// Files without directives may be rewritten freely
+	f = NewOptionFile(root, "plain")
+	if err := f.Parse(cfg); err != nil {
+		t.Fatalf("Unexpected error from Parse: %s", err)
+	}
+	f.SetOptionValue("", "user", "someoneelse")
+	if err := f.Write(true); err != nil {
+		t.Fatalf("Unexpected error from Write: %s", err)
+	}
+	if contents, _ := ioutil.ReadFile(f.Path()); string(contents) != "user=someoneelse\n" {
+		t.Errorf("Unexpected file contents after Write:\n%s", contents)
+	}
+}
+
+func TestOptionFileExtends(t *testing.T) {
+	root := optionFileTestDir(t, map[string]string{
+		".skeema":     "port=3306\n[production]\nhost=db1\nschema=product\n[production-eu]\n!extends production\nhost=db-eu\n[production-eu-2]\n!extends production-eu\nschema=product2\n",
+		"unknown":     "[a]\nbogus=1\n[b]\n!extends a\n",
+		"loose":       "[a]\nloose-bogus=1\n[b]\n!extends a\n",
+		"directive":   "[a]\n!bogus a\n",
+		"twice":       "[a]\n[b]\n[c]\n!extends a\n!extends b\n",
+		"toplevel":    "!extends a\n[a]\n",
+		"missing":     "[a]\n!extends b\n",
+		"cycle":       "[a]\n!extends b\n[b]\n!extends c\n[c]\n!extends a\n",
+		"included":    "!include extends.cnf\n",
+		"extends.cnf": "[a]\n[b]\n!extends a\n",
+	})
+	defer os.RemoveAll(root)
+	cfg := optionFileTestConfig()
+
+	f := NewOptionFile(root, ".skeema")
+	if err := f.Parse(cfg); err != nil {
+		t.Fatalf("Unexpected error from Parse: %s", err)
+	}
+	if lineage, err := f.SectionLineage("production-eu-2"); err != nil || strings.Join(lineage, ",") != "production-eu-2,production-eu,production" {
+		t.Errorf("Unexpected result from SectionLineage: %v, %v", lineage, err)
+	}
+	if parent := f.SectionExtends("production-eu"); parent != "production" {
+		t.Errorf("Unexpected result from SectionExtends: %q", parent)
+	}
+	if err := f.UseSection("production-eu-2"); err != nil {
+		t.Fatalf("Unexpected error from UseSection: %s", err)
+	}
+	for name, expected := range map[string]string{"host": "db-eu", "schema": "product2", "port": "3306"} {
+		if value, _ := f.OptionValue(name); value != expected {
+			t.Errorf("Expected %s to have value %q, instead found %q", name, expected, value)
+		}
+	}
+
+	// Files with unknown options are still rejected, even though mybase.File
+	// parses them permissively when directives are present
+	f = NewOptionFile(root, "unknown")
+	if err := f.Parse(cfg); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected unknown option error on line 2, instead found %v", err)
+	}
+	f = NewOptionFile(root, "loose")
+	if err := f.Parse(cfg); err != nil {
+		t.Errorf("Unexpected error from Parse: %s", err)
+	}
+
+	for name, expectedText := range map[string]string{
+		"directive": "unknown directive",
+		"twice":     "already extends",
+		"toplevel":  "named section",
+		"missing":   "nonexistent",
+		"cycle":     "cycle",
+		"included":  "not supported",
+	} {
+		f = NewOptionFile(root, name)
+		if err := f.Parse(cfg); err == nil || !strings.Contains(err.Error(), expectedText) {
+			t.Errorf("Expected error containing %q for %s, instead found %v", expectedText, name, err)
+		}
+	}
+
+	// Adding a section which extends another appends it to the file
+	f = NewOptionFile(root, ".skeema")
+	if err := f.Parse(cfg); err != nil {
+		t.Fatalf("Unexpected error from Parse: %s", err)
+	}
+	f.SetSectionExtends("staging", "production-eu")
+	f.SetOptionValue("staging", "host", "db-staging")
+	if err := f.Write(true); err != nil {
+		t.Fatalf("Unexpected error from Write: %s", err)
+	}
+	f = NewOptionFile(root, ".skeema")
+	if err := f.Parse(cfg); err != nil {
+		t.Fatalf("Unexpected error from Parse after Write: %s", err)
+	}
+	_ = f.UseSection("staging")
+	for name, expected := range map[string]string{"host": "db-staging", "schema": "product", "port": "3306"} {
+		if value, _ := f.OptionValue(name); value != expected {
+			t.Errorf("After Write, expected %s to have value %q, instead found %q", name, expected, value)
+		}
+	}
+
+	// Changing the inheritance of an existing section cannot be written
+	f.SetSectionExtends("production-eu", "")
+	if err := f.Write(true); err == nil {
+		t.Error("Expected error from Write after modifying existing section, but none returned")
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/skeema/tengo"
+)
+
+// Supported values of the osc-tool option.
+const (
+	OSCToolPTOSC = "pt-osc"
+	OSCToolGhost = "gh-ost"
+)
+
+// oscDefaultBinary maps each supported osc-tool value to the name of its
+// executable, used if osc-tool-path is not set.
+var oscDefaultBinary = map[string]string{
+	OSCToolPTOSC: "pt-online-schema-change",
+	OSCToolGhost: "gh-ost",
+}
+
+// oscCredentialsEnvVar is the environment variable which holds the path to a
+// temporary option file containing credentials. The tool's command-line refers
+// to the file via this variable, passing it to --defaults-file for pt-osc or
+// --conf for gh-ost, so that neither the password nor the file's path is
+// hard-coded in the command.
+const oscCredentialsEnvVar = "SKEEMA_OSC_CREDENTIALS"
+
+// oscDefaultOptions maps each supported osc-tool value to safety-related
+// options which are supplied unless osc-tool-options already includes the same
+// option. Values containing a %s are formatted with the path of the gh-ost
+// postpone flag file.
+var oscDefaultOptions = map[string][]oscOption{
+	OSCToolPTOSC: {
+		{"max-load", "Threads_running=25"},
+		{"critical-load", "Threads_running=50"},
+	},
+	OSCToolGhost: {
+		{"max-lag-millis", "1500"},
+		{"critical-load", "Threads_running=50"},
+		{"postpone-cut-over-flag-file", "%s"},
+	},
+}
+
+// oscOption is a single command-line option for an online schema change tool.
+type oscOption struct {
+	name  string
+	value string
+}
+
+// oscOptionRegexp matches option names in a command-line, with either one or
+// two leading dashes, since gh-ost accepts both.
+var oscOptionRegexp = regexp.MustCompile(`(?:^|\s)--?([a-z][a-z0-9-]*)`)
+
+// oscOptionNames returns the set of option names appearing in the supplied
+// value of osc-tool-options.
+func oscOptionNames(extra string) map[string]bool {
+	names := make(map[string]bool)
+	for _, match := range oscOptionRegexp.FindAllStringSubmatch(extra, -1) {
+		names[match[1]] = true
+	}
+	return names
+}
+
+// ghostPostponeFlagFile returns the path of the default gh-ost postpone flag
+// file for the supplied schema and table.
+func ghostPostponeFlagFile(schemaName, tableName string) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("skeema-gh-ost-%s.%s.postpone", schemaName, tableName))
+}
+
+// setOSCTool configures ddl, which must be an ALTER TABLE, to be executed by
+// the named online schema change tool. The tool's command-line is built from
+// ddl's instance, schema, table, and statement, as well as dir's
+// configuration. Credentials are never placed on the command-line. Default
+// safety options are included, unless osc-tool-options overrides them.
+func (ddl *DDLStatement) setOSCTool(tool string, dir *Dir) {
+	binary := dir.Config.Get("osc-tool-path")
+	if binary == "" {
+		binary = oscDefaultBinary[tool]
+	}
+	prefix := fmt.Sprintf("ALTER TABLE %s ", tengo.EscapeIdentifier(ddl.tableName))
+	clauses := strings.Replace(ddl.stmt, prefix, "", 1)
+	maxLag, err := dir.Config.GetInt("max-replica-lag")
+	if err != nil {
+		ddl.setErr(err)
+		return
+	}
+
+	extra := dir.Config.Get("osc-tool-options")
+	overridden := oscOptionNames(extra)
+
+	inst := ddl.instance
+	args := []string{binary}
+	switch tool {
+	case OSCToolPTOSC:
+		args = append(args, "--execute", "--alter", clauses)
+		if ddl.lockWait.timeout > 0 {
+			args = append(args, "--set-vars", fmt.Sprintf("lock_wait_timeout=%d", ddl.lockWait.timeout))
+		}
+		if maxLag > 0 && !overridden["max-lag"] {
+			args = append(args, "--max-lag", strconv.Itoa(maxLag))
+		}
+		for _, opt := range oscDefaultOptions[tool] {
+			if !overridden[opt.name] {
+				args = append(args, "--"+opt.name, opt.value)
+			}
+		}
+		var dsn string
+		if inst.SocketPath != "" {
+			dsn = fmt.Sprintf("S=%s", inst.SocketPath)
+		} else {
+			dsn = fmt.Sprintf("h=%s,P=%d", inst.Host, inst.Port)
+		}
+		args = append(args, fmt.Sprintf("%s,u=%s,D=%s,t=%s", dsn, inst.User, ddl.schemaName, ddl.tableName))
+	case OSCToolGhost:
+		if inst.SocketPath != "" {
+			ddl.setErr(fmt.Errorf("osc-tool=%s does not support connecting via socket; use a host other than localhost or set port", tool))
+			return
+		}
+		args = append(args,
+			"--host="+inst.Host,
+			"--port="+strconv.Itoa(inst.Port),
+			"--user="+inst.User,
+			"--database="+ddl.schemaName,
+			"--table="+ddl.tableName,
+			"--alter="+clauses,
+			"--execute",
+		)
+		if ddl.lockWait.timeout > 0 {
+			args = append(args, fmt.Sprintf("--cut-over-lock-timeout-seconds=%d", ddl.lockWait.timeout))
+		}
+		if maxLag > 0 && !overridden["max-lag-millis"] {
+			args = append(args, fmt.Sprintf("--max-lag-millis=%d", maxLag*1000))
+			overridden["max-lag-millis"] = true // supersedes default below
+		}
+		for _, opt := range oscDefaultOptions[tool] {
+			if !overridden[opt.name] {
+				value := opt.value
+				if strings.Contains(value, "%s") {
+					value = fmt.Sprintf(value, ghostPostponeFlagFile(ddl.schemaName, ddl.tableName))
+				}
+				args = append(args, fmt.Sprintf("--%s=%s", opt.name, value))
+			}
+		}
+	default:
+		ddl.setErr(fmt.Errorf("Unsupported osc-tool %q", tool))
+		return
+	}
+
+	escaped := make([]string, len(args))
+	for n, arg := range args {
+		escaped[n] = escapeVarValue(arg)
+	}
+	command := strings.Join(escaped, " ")
+	if inst.Password != "" && tool == OSCToolPTOSC {
+		command += fmt.Sprintf(` --defaults-file="$%s"`, oscCredentialsEnvVar)
+	} else if inst.Password != "" && tool == OSCToolGhost {
+		command += fmt.Sprintf(` --conf="$%s"`, oscCredentialsEnvVar)
+	}
+	if extra != "" {
+		command += " " + extra
+	}
+	ddl.shellOut = NewShellOut(command, command)
+	ddl.oscTool = tool
+}
+
+// runOSCTool runs ddl's online schema change tool using s, which should be
+// obtained from ddl.captureShellOut so that the tool's output is retained. The
+// tool is sent SIGINT if ctx is canceled. If the tool fails, an *OSCError
+// summarizing the failure is returned.
+func (ddl *DDLStatement) runOSCTool(ctx context.Context, s *ShellOut) error {
+	if ddl.instance.Password != "" {
+		confPath, err := writeOSCCredentials(ddl.instance.User, ddl.instance.Password)
+		if err != nil {
+			return fmt.Errorf("Unable to write temporary credentials file for %s: %s", ddl.oscTool, err)
+		}
+		defer os.Remove(confPath)
+		env := make([]string, len(s.Env), len(s.Env)+1)
+		copy(env, s.Env)
+		s.Env = append(env, oscCredentialsEnvVar+"="+confPath)
+	}
+	if err := s.RunContext(ctx); err != nil {
+		return NewOSCError(ddl.oscTool, err, ddl.Output())
+	}
+	return nil
+}
+
+// writeOSCCredentials writes a temporary option file containing the supplied
+// credentials in a [client] section, returning its absolute path. Both pt-osc
+// and gh-ost can read this format. The file is only readable by its owner.
+func writeOSCCredentials(user, password string) (string, error) {
+	f, err := ioutil.TempFile("", "skeema-osc-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := f.Chmod(0600); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if _, err := fmt.Fprintf(f, "[client]\nuser=%s\npassword=%s\n", user, password); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// OSCError represents a failure of an online schema change tool.
+type OSCError struct {
+	Tool     string
+	ExitCode int    // -1 if the tool did not exit normally
+	Message  string // most relevant line of the tool's output, if any
+}
+
+// NewOSCError returns an *OSCError for tool, based on err returned from
+// running the tool, and the tool's combined output.
+func NewOSCError(tool string, err error, output string) *OSCError {
+	oe := &OSCError{
+		Tool:     tool,
+		ExitCode: -1,
+		Message:  oscErrorMessage(tool, output),
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Exited() {
+			oe.ExitCode = status.ExitStatus()
+		}
+	}
+	if oe.Message == "" {
+		oe.Message = err.Error()
+	}
+	return oe
+}
+
+// Error satisfies the builtin error interface.
+func (oe *OSCError) Error() string {
+	if oe.ExitCode < 0 {
+		return fmt.Sprintf("%s failed: %s", oe.Tool, oe.Message)
+	}
+	return fmt.Sprintf("%s failed with exit code %d: %s", oe.Tool, oe.ExitCode, oe.Message)
+}
+
+// oscErrorMessage returns the line of output from tool which best describes
+// why it failed. For gh-ost, this is the last FATAL or ERROR log line. For
+// pt-online-schema-change, this is the last line beginning with "Error" or
+// containing "failed". If no such line is found, the last non-blank line of
+// output is returned.
+func oscErrorMessage(tool, output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for n := len(lines) - 1; n >= 0; n-- {
+		line := strings.TrimSpace(lines[n])
+		switch tool {
+		case OSCToolGhost:
+			for _, level := range []string{"FATAL ", "ERROR "} {
+				if pos := strings.Index(line, level); pos >= 0 {
+					return strings.TrimSpace(line[pos+len(level):])
+				}
+			}
+		case OSCToolPTOSC:
+			if strings.HasPrefix(line, "Error") || strings.Contains(line, "failed") {
+				return line
+			}
+		}
+	}
+	for n := len(lines) - 1; n >= 0; n-- {
+		if line := strings.TrimSpace(lines[n]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skeema/tengo"
+)
+
+func TestSetOSCTool(t *testing.T) {
+	inst, err := tengo.NewInstance("mysql", "app:s3cr3t@tcp(10.0.0.1:3307)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	values := map[string]string{
+		"osc-tool-path":    "",
+		"osc-tool-options": "",
+		"max-replica-lag":  "0",
+	}
+	newDDL := func() *DDLStatement {
+		return &DDLStatement{
+			stmt:       "ALTER TABLE `users` ADD COLUMN `age` int",
+			instance:   inst,
+			schemaName: "product",
+			tableName:  "users",
+		}
+	}
+
+	ddl := newDDL()
+	ddl.setOSCTool(OSCToolPTOSC, &Dir{Path: "/tmp/product", Config: getConfig(values)})
+	expected := "pt-online-schema-change --execute --alter 'ADD COLUMN `age` int' --max-load Threads_running=25 --critical-load Threads_running=50 h=10.0.0.1,P=3307,u=app,D=product,t=users --defaults-file=\"$SKEEMA_OSC_CREDENTIALS\""
+	if ddl.Err != nil || ddl.shellOut == nil || ddl.shellOut.Command != expected {
+		t.Errorf("Unexpected pt-osc command: err=%v, shellOut=%+v", ddl.Err, ddl.shellOut)
+	} else if len(ddl.shellOut.Env) != 0 || strings.Contains(ddl.shellOut.String(), "s3cr3t") {
+		t.Errorf("Unexpected pt-osc environment or command: %+v", ddl.shellOut)
+	}
+
+	// Defaults are omitted when osc-tool-options supplies the same option
+	values["osc-tool-options"] = "--critical-load=Threads_running=200"
+	ddl = newDDL()
+	ddl.setOSCTool(OSCToolPTOSC, &Dir{Path: "/tmp/product", Config: getConfig(values)})
+	expected = "pt-online-schema-change --execute --alter 'ADD COLUMN `age` int' --max-load Threads_running=25 h=10.0.0.1,P=3307,u=app,D=product,t=users --defaults-file=\"$SKEEMA_OSC_CREDENTIALS\" --critical-load=Threads_running=200"
+	if ddl.Err != nil || ddl.shellOut == nil || ddl.shellOut.Command != expected {
+		t.Errorf("Unexpected pt-osc command: err=%v, shellOut=%+v", ddl.Err, ddl.shellOut)
+	}
+
+	values["osc-tool-path"] = "/usr/local/bin/gh-ost"
+	values["osc-tool-options"] = "--chunk-size=500"
+	values["max-replica-lag"] = "5"
+	ddl = newDDL()
+	ddl.lockWait.timeout = 3
+	ddl.setOSCTool(OSCToolGhost, &Dir{Path: "/tmp/product", Config: getConfig(values)})
+	expected = "/usr/local/bin/gh-ost --host=10.0.0.1 --port=3307 --user=app --database=product --table=users '--alter=ADD COLUMN `age` int' --execute --cut-over-lock-timeout-seconds=3 --max-lag-millis=5000 --critical-load=Threads_running=50 --postpone-cut-over-flag-file=" + ghostPostponeFlagFile("product", "users") + " --conf=\"$SKEEMA_OSC_CREDENTIALS\" --chunk-size=500"
+	if ddl.Err != nil || ddl.shellOut == nil || ddl.shellOut.Command != expected {
+		t.Errorf("Unexpected gh-ost command: err=%v, shellOut=%+v", ddl.Err, ddl.shellOut)
+	} else if len(ddl.shellOut.Env) != 0 || strings.Contains(ddl.shellOut.String(), "s3cr3t") {
+		t.Errorf("Unexpected gh-ost environment or command: %+v", ddl.shellOut)
+	}
+
+	// max-lag-millis default applies without max-replica-lag, and an empty
+	// postpone-cut-over-flag-file in osc-tool-options disables the flag file
+	values["osc-tool-options"] = "-postpone-cut-over-flag-file="
+	values["max-replica-lag"] = "0"
+	ddl = newDDL()
+	ddl.setOSCTool(OSCToolGhost, &Dir{Path: "/tmp/product", Config: getConfig(values)})
+	expected = "/usr/local/bin/gh-ost --host=10.0.0.1 --port=3307 --user=app --database=product --table=users '--alter=ADD COLUMN `age` int' --execute --max-lag-millis=1500 --critical-load=Threads_running=50 --conf=\"$SKEEMA_OSC_CREDENTIALS\" -postpone-cut-over-flag-file="
+	if ddl.Err != nil || ddl.shellOut == nil || ddl.shellOut.Command != expected {
+		t.Errorf("Unexpected gh-ost command: err=%v, shellOut=%+v", ddl.Err, ddl.shellOut)
+	}
+
+	// gh-ost does not support sockets
+	socketInst, err := tengo.NewInstance("mysql", "app:s3cr3t@unix(/var/lib/mysql/mysql.sock)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	ddl = newDDL()
+	ddl.instance = socketInst
+	if ddl.setOSCTool(OSCToolGhost, &Dir{Path: "/tmp/product", Config: getConfig(values)}); ddl.Err == nil {
+		t.Error("Expected error using gh-ost with socket, but err was nil")
+	}
+}
+
+func TestRunOSCTool(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "skeema-osc")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Fake gh-ost which outputs its config file, and then fails
+	script := filepath.Join(tempDir, "fake-gh-ost")
+	contents := "#!/bin/sh\ncat \"$SKEEMA_OSC_CREDENTIALS\"\necho '2019-03-14 15:09:26 FATAL Unexpected database port reported: 3306' >&2\nexit 1\n"
+	if err := ioutil.WriteFile(script, []byte(contents), 0755); err != nil {
+		t.Fatalf("Unable to write file: %s", err)
+	}
+	inst, err := tengo.NewInstance("mysql", "app:s3cr3t@tcp(10.0.0.1:3307)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	ddl := &DDLStatement{
+		stmt:       "ALTER TABLE `users` ADD COLUMN `age` int",
+		instance:   inst,
+		schemaName: "product",
+		tableName:  "users",
+		outputMode: WrapperOutputPrefix, // output is not captured in direct mode
+	}
+	values := map[string]string{
+		"osc-tool-path":    script,
+		"osc-tool-options": "",
+		"max-replica-lag":  "0",
+	}
+	ddl.setOSCTool(OSCToolGhost, &Dir{Path: "/tmp/product", Config: getConfig(values)})
+	var stdout bytes.Buffer
+	ddl.shellOut.Stdout = &stdout
+
+	err = ddl.Execute(context.Background())
+	oe, ok := err.(*OSCError)
+	if !ok {
+		t.Fatalf("Expected Execute to return *OSCError, instead found %T %v", err, err)
+	}
+	if oe.ExitCode != 1 || oe.Message != "Unexpected database port reported: 3306" {
+		t.Errorf("Unexpected OSCError: %+v", oe)
+	}
+	if stdout.String() != "[10.0.0.1:3307 product] [client]\n[10.0.0.1:3307 product] user=app\n[10.0.0.1:3307 product] password=s3cr3t\n" {
+		t.Errorf("Unexpected output from fake gh-ost: %q", stdout.String())
+	}
+	if expected := "gh-ost failed with exit code 1: Unexpected database port reported: 3306"; oe.Error() != expected {
+		t.Errorf("Unexpected error message: %q", oe.Error())
+	}
+}
+
+func TestOSCErrorMessage(t *testing.T) {
+	cases := []struct {
+		tool     string
+		output   string
+		expected string
+	}{
+		{OSCToolGhost, "2019-03-14 15:09:26 INFO starting\n2019-03-14 15:09:27 ERROR table not found\nmore output\n", "table not found"},
+		{OSCToolPTOSC, "No slaves found.\nError altering new table `product`.`_users_new`: DBD::mysql::db do failed: Duplicate column name 'age'\n`product`.`users` was not altered.\n", "Error altering new table `product`.`_users_new`: DBD::mysql::db do failed: Duplicate column name 'age'"},
+		{OSCToolPTOSC, "first\nlast line\n\n", "last line"},
+		{OSCToolGhost, "", ""},
+	}
+	for _, c := range cases {
+		if actual := oscErrorMessage(c.tool, c.output); actual != c.expected {
+			t.Errorf("Expected oscErrorMessage(%s, ...) to return %q, instead found %q", c.tool, c.expected, actual)
+		}
+	}
+}
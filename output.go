@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Supported values of the wrapper-output option.
+const (
+	WrapperOutputDirect = "direct"
+	WrapperOutputPrefix = "prefix"
+	WrapperOutputBuffer = "buffer"
+)
+
+// maxCapturedOutput is the maximum number of bytes of each external command's
+// output retained for JSON output and audit-log. If a command outputs more than
+// this, only the end of its output is retained.
+const maxCapturedOutput = 64 * 1024
+
+// captureShellOut returns a copy of ddl's ShellOut, with its STDOUT and STDERR
+// destinations modified according to ddl's wrapper-output mode. In direct mode,
+// the command's STDOUT and STDERR are left unchanged, so that a command writing
+// to a terminal still sees a TTY; its output is therefore not captured. In other
+// modes, the command's combined output is also captured for retrieval by
+// ddl.Output. The returned function must be called once the command completes, to flush
+// any remaining output.
+func (ddl *DDLStatement) captureShellOut() (*ShellOut, func()) {
+	s := *ddl.shellOut
+	ddl.output = nil
+	if ddl.outputMode != WrapperOutputPrefix && ddl.outputMode != WrapperOutputBuffer {
+		return &s, func() {}
+	}
+	stdout := s.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	stderr := s.Stderr
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	ddl.output = &syncBuffer{max: maxCapturedOutput}
+
+	if ddl.outputMode == WrapperOutputPrefix {
+		prefix := fmt.Sprintf("[%s %s] ", ddl.instance, ddl.schemaName)
+		stdoutPrefixer := &prefixWriter{w: stdout, prefix: prefix}
+		stderrPrefixer := &prefixWriter{w: stderr, prefix: prefix}
+		s.Stdout = io.MultiWriter(stdoutPrefixer, ddl.output)
+		s.Stderr = io.MultiWriter(stderrPrefixer, ddl.output)
+		return &s, func() {
+			stdoutPrefixer.Flush()
+			stderrPrefixer.Flush()
+		}
+	}
+
+	// Buffer the full output, rather than just the retained portion, so that it
+	// can be written in a single block once the command completes
+	full := &syncBuffer{}
+	s.Stdout = io.MultiWriter(full, ddl.output)
+	s.Stderr = s.Stdout
+	return &s, func() {
+		if output := full.String(); output != "" {
+			if !strings.HasSuffix(output, "\n") {
+				output += "\n"
+			}
+			fmt.Fprintf(stdout, "-- output from %s %s table %s:\n%s", ddl.instance, ddl.schemaName, ddl.tableName, output)
+		}
+	}
+}
+
+// Output returns the output captured from ddl's external command, if ddl was
+// executed by shelling out with a wrapper-output mode other than direct.
+// Otherwise, an empty string is returned.
+func (ddl *DDLStatement) Output() string {
+	if ddl == nil || ddl.output == nil {
+		return ""
+	}
+	return ddl.output.String()
+}
+
+// syncBuffer is a buffer which is safe for concurrent writes, as occurs when an
+// external command's STDOUT and STDERR are both copied to it. If max is
+// positive, only the last max bytes written are retained.
+type syncBuffer struct {
+	b         bytes.Buffer
+	max       int
+	truncated bool
+	sync.Mutex
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	n, err := sb.b.Write(p)
+	if sb.max > 0 && sb.b.Len() > sb.max {
+		sb.b.Next(sb.b.Len() - sb.max)
+		sb.truncated = true
+	}
+	return n, err
+}
+
+// String returns the buffer's contents. If earlier output was discarded due to
+// max, this is indicated on the first line.
+func (sb *syncBuffer) String() string {
+	sb.Lock()
+	defer sb.Unlock()
+	if sb.truncated {
+		return "[earlier output truncated]\n" + sb.b.String()
+	}
+	return sb.b.String()
+}
+
+// prefixWriter writes each line to an underlying writer, prepending a prefix.
+// Each complete line is written to the underlying writer in a single call, to
+// avoid interleaving with output written concurrently by other goroutines.
+// Partial lines are held until completed, or until Flush is called.
+type prefixWriter struct {
+	w       io.Writer
+	prefix  string
+	partial []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.partial = append(pw.partial, p...)
+	for {
+		pos := bytes.IndexByte(pw.partial, '\n')
+		if pos < 0 {
+			break
+		}
+		line := make([]byte, 0, len(pw.prefix)+pos+1)
+		line = append(append(line, pw.prefix...), pw.partial[:pos+1]...)
+		pw.partial = pw.partial[pos+1:]
+		if _, err := pw.w.Write(line); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes any held partial line, followed by a newline.
+func (pw *prefixWriter) Flush() {
+	if len(pw.partial) > 0 {
+		pw.Write([]byte{'\n'})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/skeema/tengo"
+)
+
+func TestDDLStatementWrapperOutput(t *testing.T) {
+	inst, err := tengo.NewInstance("mysql", "root:@tcp(127.0.0.1:3306)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	command := "echo one; echo two >&2; printf three"
+	expectedStdout := map[string]string{
+		WrapperOutputDirect: "one\nthree",
+		WrapperOutputPrefix: "[127.0.0.1:3306 product] one\n[127.0.0.1:3306 product] three\n",
+		WrapperOutputBuffer: "-- output from 127.0.0.1:3306 product table users:\none\ntwo\nthree\n",
+	}
+	expectedStderr := map[string]string{
+		WrapperOutputDirect: "two\n",
+		WrapperOutputPrefix: "[127.0.0.1:3306 product] two\n",
+		WrapperOutputBuffer: "",
+	}
+	for mode := range expectedStdout {
+		var stdout, stderr bytes.Buffer
+		ddl := &DDLStatement{
+			stmt:       "ALTER TABLE `users` ADD COLUMN `age` int",
+			shellOut:   &ShellOut{Command: command, Stdout: &stdout, Stderr: &stderr},
+			outputMode: mode,
+			instance:   inst,
+			schemaName: "product",
+			tableName:  "users",
+		}
+		if ddl.Output() != "" {
+			t.Errorf("Expected Output() to be empty before Execute, instead found %q", ddl.Output())
+		}
+		if err := ddl.Execute(context.Background()); err != nil {
+			t.Fatalf("Unexpected error from Execute with wrapper-output=%s: %s", mode, err)
+		}
+		if stdout.String() != expectedStdout[mode] {
+			t.Errorf("Unexpected STDOUT with wrapper-output=%s: %q", mode, stdout.String())
+		}
+		if stderr.String() != expectedStderr[mode] {
+			t.Errorf("Unexpected STDERR with wrapper-output=%s: %q", mode, stderr.String())
+		}
+		// Output is not captured in direct mode, since the command's STDOUT and
+		// STDERR are passed through unchanged. It is only guaranteed to be captured
+		// in order in buffer mode, since STDOUT and STDERR share a single pipe.
+		output := ddl.Output()
+		if mode == WrapperOutputDirect {
+			if output != "" {
+				t.Errorf("Unexpected Output() with wrapper-output=%s: %q", mode, output)
+			}
+			if s, _ := ddl.captureShellOut(); s.Stdout != ddl.shellOut.Stdout || s.Stderr != ddl.shellOut.Stderr {
+				t.Errorf("Expected wrapper-output=%s to leave ShellOut's destinations unchanged", mode)
+			}
+		} else if mode == WrapperOutputBuffer && output != "one\ntwo\nthree" {
+			t.Errorf("Unexpected Output() with wrapper-output=%s: %q", mode, output)
+		} else if mode == WrapperOutputPrefix && len(output) != len("one\ntwo\nthree") || !strings.Contains(output, "two\n") || !strings.Contains(output, "one\n") {
+			t.Errorf("Unexpected Output() with wrapper-output=%s: %q", mode, output)
+		}
+	}
+}
+
+func TestSyncBufferMax(t *testing.T) {
+	sb := &syncBuffer{max: 10}
+	sb.Write([]byte("abcdef"))
+	if sb.String() != "abcdef" {
+		t.Errorf("Unexpected buffer contents: %q", sb.String())
+	}
+	sb.Write([]byte("ghijkl\n"))
+	if expected := "[earlier output truncated]\ndefghijkl\n"; sb.String() != expected {
+		t.Errorf("Unexpected buffer contents: %q", sb.String())
+	}
+
+	sb = &syncBuffer{}
+	sb.Write([]byte(strings.Repeat("x", 2*maxCapturedOutput)))
+	if sb.String() != strings.Repeat("x", 2*maxCapturedOutput) {
+		t.Error("Expected buffer without max to retain all output")
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var b bytes.Buffer
+	pw := &prefixWriter{w: &b, prefix: "> "}
+	pw.Write([]byte("hello\nwor"))
+	pw.Write([]byte("ld\n\nfoo"))
+	if expected := "> hello\n> world\n> \n"; b.String() != expected {
+		t.Errorf("Unexpected output before Flush: %q", b.String())
+	}
+	pw.Flush()
+	pw.Flush()
+	if expected := "> hello\n> world\n> \n> foo\n"; b.String() != expected {
+		t.Errorf("Unexpected output after Flush: %q", b.String())
+	}
+}
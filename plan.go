@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skeema/tengo"
+)
+
+// planVersion is the current version of the plan file format.
+const planVersion = 1
+
+// Plan represents the DDL generated by `skeema diff` for later execution by
+// `skeema apply`. It is safe for use by multiple goroutines.
+type Plan struct {
+	Version     int           `json:"version"`
+	Environment string        `json:"environment"`
+	CreatedAt   time.Time     `json:"created_at"`
+	Targets     []*PlanTarget `json:"targets"`
+	*sync.Mutex `json:"-"`
+}
+
+// PlanTarget represents the DDL to run for a single instance and schema. The
+// fingerprint identifies the state of the schema on the instance at the time
+// the plan was created; it is an empty string if the schema did not exist.
+type PlanTarget struct {
+	Dir         string             `json:"dir"`
+	Instance    string             `json:"instance"`
+	Schema      string             `json:"schema"`
+	Fingerprint string             `json:"fingerprint"`
+	SchemaDDL   string             `json:"schema_ddl,omitempty"`
+	Statements  []*TableDiffResult `json:"statements"`
+}
+
+// NewPlan returns an empty plan for the named environment.
+func NewPlan(environment string) *Plan {
+	return &Plan{
+		Version:     planVersion,
+		Environment: environment,
+		CreatedAt:   time.Now().UTC(),
+		Targets:     []*PlanTarget{},
+		Mutex:       new(sync.Mutex),
+	}
+}
+
+// AddTarget adds the DDL in result, which was generated for t, to the plan.
+// If result does not contain any DDL, the plan is not modified.
+func (plan *Plan) AddTarget(t *Target, result *TargetResult) error {
+	if result.SchemaDDL == "" && len(result.TableDiffs) == 0 {
+		return nil
+	}
+	fingerprint, err := SchemaFingerprint(t.SchemaFromInstance)
+	if err != nil {
+		return err
+	}
+	pt := &PlanTarget{
+		Dir:         t.Dir.Path,
+		Instance:    t.Instance.String(),
+		Schema:      t.SchemaFromDir.Name,
+		Fingerprint: fingerprint,
+		SchemaDDL:   result.SchemaDDL,
+		Statements:  result.TableDiffs,
+	}
+	plan.Lock()
+	plan.Targets = append(plan.Targets, pt)
+	plan.Unlock()
+	return nil
+}
+
+// Write sorts the plan's targets by dir, instance, and schema, and then writes
+// the plan to the file at path as an indented JSON document.
+func (plan *Plan) Write(path string) error {
+	plan.Lock()
+	defer plan.Unlock()
+	sort.SliceStable(plan.Targets, func(i, j int) bool {
+		a, b := plan.Targets[i], plan.Targets[j]
+		if a.Dir != b.Dir {
+			return a.Dir < b.Dir
+		} else if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return a.Schema < b.Schema
+	})
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadPlan reads and returns the plan stored in the file at path.
+func ReadPlan(path string) (*Plan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Mutex: new(sync.Mutex)}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("Unable to parse plan file %s: %s", path, err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("Plan file %s has unsupported version %d", path, plan.Version)
+	}
+	return plan, nil
+}
+
+// SchemaFingerprint returns a hash of the schema's default character set and
+// collation, and the CREATE TABLE statements of all of its tables. Next
+// auto-increment values are excluded, since these change as rows are inserted.
+// If schema is nil, an empty string is returned.
+func SchemaFingerprint(schema *tengo.Schema) (string, error) {
+	if schema == nil {
+		return "", nil
+	}
+	tables, err := schema.Tables()
+	if err != nil {
+		return "", err
+	}
+	sorted := make([]*tengo.Table, len(tables))
+	copy(sorted, tables)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", schema.CharSet, schema.Collation)
+	for _, table := range sorted {
+		createStatement, _ := tengo.ParseCreateAutoInc(table.CreateStatement())
+		fmt.Fprintf(h, "%s;\n", createStatement)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
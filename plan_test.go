@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skeema/tengo"
+)
+
+func TestPlanWriteRead(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "skeema-plan")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "plan.json")
+
+	plan := NewPlan("staging")
+	plan.Targets = []*PlanTarget{
+		{Dir: "/tmp/b", Instance: "127.0.0.1:3306", Schema: "product", Fingerprint: "abc"},
+		{
+			Dir:       "/tmp/a",
+			Instance:  "127.0.0.1:3306",
+			Schema:    "analytics",
+			SchemaDDL: "CREATE DATABASE `analytics`",
+			Statements: []*TableDiffResult{
+				{Type: "CREATE", Table: "events", Statement: "CREATE TABLE `events` (`id` int)"},
+			},
+		},
+	}
+	if err := plan.Write(path); err != nil {
+		t.Fatalf("Unexpected error from Write: %s", err)
+	}
+
+	read, err := ReadPlan(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from ReadPlan: %s", err)
+	}
+	if read.Environment != "staging" || read.Version != planVersion || !read.CreatedAt.Equal(plan.CreatedAt) {
+		t.Errorf("Unexpected plan fields after roundtrip: %+v", read)
+	}
+	if len(read.Targets) != 2 || read.Targets[0].Schema != "analytics" || read.Targets[1].Schema != "product" {
+		t.Fatalf("Unexpected targets after roundtrip: %+v", read.Targets)
+	}
+	if pt := read.Targets[0]; pt.Fingerprint != "" || pt.SchemaDDL != "CREATE DATABASE `analytics`" || len(pt.Statements) != 1 || pt.Statements[0].Table != "events" {
+		t.Errorf("Unexpected target after roundtrip: %+v", pt)
+	}
+
+	// Unsupported versions and unparseable files should be rejected
+	if err := ioutil.WriteFile(path, []byte(`{"version": 99}`), 0644); err != nil {
+		t.Fatalf("Unable to write file: %s", err)
+	}
+	if _, err := ReadPlan(path); err == nil || !strings.Contains(err.Error(), "unsupported version") {
+		t.Errorf("Expected unsupported version error, instead err=%v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatalf("Unable to write file: %s", err)
+	}
+	if _, err := ReadPlan(path); err == nil {
+		t.Error("Expected error from ReadPlan on unparseable file, but err was nil")
+	}
+	if _, err := ReadPlan(filepath.Join(tempDir, "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected not-exist error from ReadPlan on missing file, instead err=%v", err)
+	}
+}
+
+func TestSchemaFingerprintNil(t *testing.T) {
+	if fingerprint, err := SchemaFingerprint(nil); fingerprint != "" || err != nil {
+		t.Errorf("Expected SchemaFingerprint(nil) to return empty string and nil error; instead found %q, %v", fingerprint, err)
+	}
+}
+
+func TestNewPlannedDDLStatement(t *testing.T) {
+	inst, err := tengo.NewInstance("mysql", "root:@tcp(127.0.0.1:3306)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	target := &Target{
+		Instance:      inst,
+		SchemaFromDir: &tengo.Schema{Name: "product"},
+	}
+	planned := &TableDiffResult{
+		Type:      "ALTER",
+		Table:     "users",
+		Statement: "ALTER TABLE `users` ADD COLUMN `age` int",
+		Wrapper:   true,
+		Command:   "/bin/echo ALTER users 'ADD COLUMN `age` int'",
+	}
+	values := map[string]string{
+		"user":                  "root",
+		"password":              "",
+		"schema":                "product",
+		"host":                  "127.0.0.1",
+		"port":                  "3306",
+		"ddl-wrapper":           "",
+		"alter-wrapper":         "",
+		"connect-options":       "",
+		"osc-tool":              "",
+		"osc-tool-path":         "",
+		"osc-tool-options":      "",
+		"wrapper-output":        "direct",
+		"isolate-wrappers":      "",
+		"max-replica-lag":       "0",
+		"lock-wait-timeout":     "0",
+		"statement-timeout":     "0",
+		"max-transaction-age":   "0",
+		"lock-wait-retries":     "0",
+		"lock-wait-retry-delay": "5",
+	}
+
+	// Plan requires a wrapper, but none is configured
+	target.Dir = &Dir{Path: "/tmp/product", Config: getConfig(values)}
+	if ddl := NewPlannedDDLStatement(planned, target); ddl.Err == nil || ddl.IsShellOut() {
+		t.Errorf("Expected error from NewPlannedDDLStatement without any wrapper configured; instead err=%v", ddl.Err)
+	}
+
+	// Wrapper is re-interpolated using the current configuration
+	values["alter-wrapper"] = "/bin/echo {TYPE} {TABLE} {CLAUSES}"
+	target.Dir = &Dir{Path: "/tmp/product", Config: getConfig(values)}
+	ddl := NewPlannedDDLStatement(planned, target)
+	if ddl.Err != nil || !ddl.IsShellOut() {
+		t.Fatalf("Unexpected result from NewPlannedDDLStatement: err=%v, shellout=%t", ddl.Err, ddl.IsShellOut())
+	}
+	if expected := "\\! /bin/echo ALTER users 'ADD COLUMN `age` int'"; ddl.String() != expected {
+		t.Errorf("Expected String() to return %q, instead found %q", expected, ddl.String())
+	}
+
+	// Wrapper command differing from the plan is an error
+	values["alter-wrapper"] = "/bin/echo {TYPE} {SCHEMA}.{TABLE} {CLAUSES}"
+	target.Dir = &Dir{Path: "/tmp/product", Config: getConfig(values)}
+	if ddl := NewPlannedDDLStatement(planned, target); ddl.Err == nil {
+		t.Error("Expected error from NewPlannedDDLStatement with changed wrapper, but err was nil")
+	}
+
+	// Plan not requiring a wrapper runs the statement directly
+	planned.Wrapper = false
+	if ddl := NewPlannedDDLStatement(planned, target); ddl.Err != nil || ddl.IsShellOut() || ddl.String() != planned.Statement+";" {
+		t.Errorf("Unexpected result from NewPlannedDDLStatement: err=%v, String()=%q", ddl.Err, ddl.String())
+	}
+}
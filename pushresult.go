@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/skeema/tengo"
+)
+
+// PushResult represents the outcome of a single run of `skeema diff` or
+// `skeema push`, for purposes of machine-readable output.
+type PushResult struct {
+	Command     string          `json:"command"`
+	Environment string          `json:"environment"`
+	DryRun      bool            `json:"dry_run"`
+	Targets     []*TargetResult `json:"targets"`
+	Summary     PushSummary     `json:"summary"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// PushSummary contains the counters tracked by sharedPushState.
+type PushSummary struct {
+	Differences int `json:"differences"`
+	Errors      int `json:"errors"`
+	Unsupported int `json:"unsupported"`
+}
+
+// TargetResult represents the outcome of diffing or pushing a single Target.
+type TargetResult struct {
+	Instance          string             `json:"instance,omitempty"`
+	Schema            string             `json:"schema,omitempty"`
+	Dir               string             `json:"dir"`
+	Error             string             `json:"error,omitempty"`
+	SchemaDDL         string             `json:"schema_ddl,omitempty"`
+	TableDiffs        []*TableDiffResult `json:"table_diffs"`
+	UnsupportedTables []string           `json:"unsupported_tables"`
+}
+
+// TableDiffResult represents a single DDL statement within a TargetResult.
+type TableDiffResult struct {
+	Type      string         `json:"type"`
+	Table     string         `json:"table"`
+	Statement string         `json:"statement"`
+	Clauses   []ClauseResult `json:"clauses,omitempty"`
+	TableSize int64          `json:"table_size"`
+	Wrapper   bool           `json:"wrapper"`
+	Command   string         `json:"command,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Output    string         `json:"output,omitempty"`
+}
+
+// ClauseResult represents a single clause of an ALTER TABLE statement.
+type ClauseResult struct {
+	Clause string `json:"clause"`
+	Unsafe bool   `json:"unsafe"`
+}
+
+// NewTargetResult returns a TargetResult describing t. If t has an error, it
+// is included in the result.
+func NewTargetResult(t *Target) *TargetResult {
+	result := &TargetResult{
+		Dir:               t.Dir.Path,
+		TableDiffs:        []*TableDiffResult{},
+		UnsupportedTables: []string{},
+	}
+	if t.Instance != nil {
+		result.Instance = t.Instance.String()
+	}
+	if t.SchemaFromDir != nil {
+		result.Schema = t.SchemaFromDir.Name
+	}
+	if t.Err != nil {
+		result.Error = t.Err.Error()
+	}
+	return result
+}
+
+// AddTableDiff appends a TableDiffResult describing tableDiff and its
+// corresponding DDLStatement to the TargetResult, and returns it so that the
+// caller may subsequently record an execution error.
+func (result *TargetResult) AddTableDiff(tableDiff tengo.TableDiff, ddl *DDLStatement) *TableDiffResult {
+	tdr := &TableDiffResult{
+		Statement: ddl.stmt,
+		TableSize: ddl.tableSize,
+		Wrapper:   ddl.IsShellOut(),
+	}
+	switch td := tableDiff.(type) {
+	case tengo.CreateTable:
+		tdr.Type, tdr.Table = "CREATE", td.Table.Name
+	case tengo.DropTable:
+		tdr.Type, tdr.Table = "DROP", td.Table.Name
+	case tengo.AlterTable:
+		tdr.Type, tdr.Table = "ALTER", td.Table.Name
+		for _, clause := range td.Clauses {
+			tdr.Clauses = append(tdr.Clauses, ClauseResult{
+				Clause: clause.Clause(),
+				Unsafe: clause.Unsafe(),
+			})
+		}
+	}
+	if ddl.IsShellOut() {
+		tdr.Command = ddl.shellOut.String()
+	}
+	if ddl.Err != nil {
+		tdr.Error = ddl.Err.Error()
+	}
+	result.TableDiffs = append(result.TableDiffs, tdr)
+	return tdr
+}
+
+// WriteJSON sorts the result's targets by dir, instance, and schema, and then
+// writes the result to w as an indented JSON document.
+func (pr *PushResult) WriteJSON(w io.Writer) error {
+	sort.SliceStable(pr.Targets, func(i, j int) bool {
+		a, b := pr.Targets[i], pr.Targets[j]
+		if a.Dir != b.Dir {
+			return a.Dir < b.Dir
+		} else if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return a.Schema < b.Schema
+	})
+	data, err := json.MarshalIndent(pr, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
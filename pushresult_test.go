@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/skeema/tengo"
+)
+
+func TestPushResultWriteJSON(t *testing.T) {
+	dirA := &Dir{Path: "/tmp/a"}
+	dirB := &Dir{Path: "/tmp/b"}
+	targetB := NewTargetResult(&Target{Dir: dirB, SchemaFromDir: &tengo.Schema{Name: "product"}})
+	targetErr := NewTargetResult(&Target{Dir: dirA, Err: errors.New("bad dir")})
+
+	createTable := tengo.CreateTable{Table: &tengo.Table{Name: "widgets"}}
+	targetB.AddTableDiff(createTable, &DDLStatement{stmt: "CREATE TABLE `widgets` (id int)"})
+	dropTable := tengo.DropTable{Table: &tengo.Table{Name: "gadgets"}}
+	targetB.AddTableDiff(dropTable, &DDLStatement{
+		stmt:      "DROP TABLE `gadgets`",
+		tableSize: 1024,
+		shellOut:  NewShellOut("/bin/echo hello", ""),
+		Err:       errors.New("unsafe"),
+	})
+	targetB.UnsupportedTables = append(targetB.UnsupportedTables, "doodads")
+
+	pr := &PushResult{
+		Command:     "diff",
+		Environment: "production",
+		DryRun:      true,
+		Targets:     []*TargetResult{targetB, targetErr},
+		Summary:     PushSummary{Differences: 2, Errors: 1, Unsupported: 1},
+	}
+	var buf bytes.Buffer
+	if err := pr.WriteJSON(&buf); err != nil {
+		t.Fatalf("Unexpected error from WriteJSON: %s", err)
+	}
+
+	var decoded PushResult
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unable to decode output: %s\n%s", err, buf.String())
+	}
+	if len(decoded.Targets) != 2 || decoded.Targets[0].Dir != "/tmp/a" || decoded.Targets[1].Dir != "/tmp/b" {
+		t.Fatalf("Targets not sorted as expected: %+v", decoded.Targets)
+	}
+	if decoded.Targets[0].Error != "bad dir" || len(decoded.Targets[0].TableDiffs) != 0 {
+		t.Errorf("Unexpected contents for errored target: %+v", decoded.Targets[0])
+	}
+	tableDiffs := decoded.Targets[1].TableDiffs
+	if len(tableDiffs) != 2 {
+		t.Fatalf("Expected 2 table diffs, instead found %d", len(tableDiffs))
+	}
+	if td := tableDiffs[0]; td.Type != "CREATE" || td.Table != "widgets" || td.Wrapper || td.Error != "" {
+		t.Errorf("Unexpected contents for first table diff: %+v", td)
+	}
+	if td := tableDiffs[1]; td.Type != "DROP" || td.Table != "gadgets" || !td.Wrapper || td.Command != "/bin/echo hello" || td.TableSize != 1024 || td.Error != "unsafe" {
+		t.Errorf("Unexpected contents for second table diff: %+v", td)
+	}
+	if decoded.Summary != pr.Summary || decoded.Targets[1].UnsupportedTables[0] != "doodads" {
+		t.Errorf("Unexpected summary or unsupported tables: %+v", decoded)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/skeema/tengo"
+)
+
+// LagThrottler delays DDL execution on a primary database instance until the
+// replication lag of all of its replicas is within a configured threshold.
+// All methods may be called on a nil *LagThrottler, which never throttles.
+type LagThrottler struct {
+	MaxLag   int64 // seconds
+	Replicas []*tengo.Instance
+	interval time.Duration // time between lag checks while throttled
+	logEvery time.Duration // how often to log at info level while throttled
+	lag      func(ctx context.Context, replica *tengo.Instance) (int64, error)
+	logger   *log.Entry
+}
+
+// NewLagThrottler returns a LagThrottler for t's instance, based on t's
+// configuration. If the max-replica-lag option is not set, nil is returned.
+// Replicas are obtained from the replicas option if set; otherwise from the
+// output of replica-wrapper if set; otherwise they are discovered by querying
+// t's instance. Queries used for discovery are canceled if ctx is canceled.
+func NewLagThrottler(ctx context.Context, t *Target) (*LagThrottler, error) {
+	maxLag, err := t.Dir.Config.GetInt("max-replica-lag")
+	if err != nil {
+		return nil, err
+	} else if maxLag <= 0 {
+		return nil, nil
+	}
+
+	heartbeatTable := t.Dir.Config.Get("heartbeat-table")
+	if heartbeatTable != "" {
+		if heartbeatTable, err = qualifiedTableName("heartbeat-table", heartbeatTable); err != nil {
+			return nil, err
+		}
+	}
+
+	var hosts []string
+	var source string
+	if t.Dir.Config.Changed("replicas") {
+		hosts = t.Dir.Config.GetSlice("replicas", ',', true)
+		source = "replicas option"
+	} else if t.Dir.Config.Changed("replica-wrapper") {
+		extras := map[string]string{
+			"HOST": t.Instance.Host,
+			"PORT": strconv.Itoa(t.Instance.Port),
+		}
+		s, err := NewInterpolatedShellOut(t.Dir.Config.Get("replica-wrapper"), t.Dir, extras)
+		if err != nil {
+			return nil, err
+		}
+		if hosts, err = s.RunCaptureSplit(); err != nil {
+			return nil, fmt.Errorf("Unable to obtain replicas from replica-wrapper: %s", err)
+		}
+		source = "replica-wrapper"
+	} else {
+		if hosts, err = discoverReplicas(ctx, t.Instance); err != nil {
+			return nil, fmt.Errorf("Unable to discover replicas: %s", err)
+		}
+		source = "discovery"
+	}
+	replicas, err := t.Dir.instancesForHosts(hosts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	lt := &LagThrottler{
+		MaxLag:   int64(maxLag),
+		Replicas: replicas,
+		interval: time.Second,
+		logEvery: 30 * time.Second,
+		lag: func(ctx context.Context, replica *tengo.Instance) (int64, error) {
+			return replicaLag(ctx, replica, heartbeatTable)
+		},
+		logger: t.Logger(),
+	}
+	if len(replicas) == 0 {
+		lt.logger.Warnf("No replicas of %s found via %s; max-replica-lag will have no effect", t.Instance, source)
+	} else {
+		names := make([]string, len(replicas))
+		for n, replica := range replicas {
+			names[n] = replica.String()
+		}
+		lt.logger.Infof("Monitoring replication lag of %s via %s: %s", t.Instance, source, strings.Join(names, ", "))
+	}
+	return lt, nil
+}
+
+// Wait blocks until the replication lag of every replica is at most
+// lt.MaxLag seconds. Replicas whose lag cannot be determined, for example
+// because replication is stopped, are considered to be over the threshold.
+// Throttling decisions are logged. Wait returns early if ctx is canceled,
+// including while lag is being checked.
+func (lt *LagThrottler) Wait(ctx context.Context) {
+	if lt == nil || len(lt.Replicas) == 0 {
+		return
+	}
+	var start, lastLog time.Time
+	for {
+		lagging := lt.laggingReplicas(ctx)
+		if ctx.Err() != nil {
+			lt.logger.Info("Throttling: interrupted while checking replication lag")
+			return
+		} else if len(lagging) == 0 {
+			if start.IsZero() {
+				lt.logger.Debugf("Replication lag is within max-replica-lag=%ds; not throttling", lt.MaxLag)
+			} else {
+				lt.logger.Infof("Replication lag is within max-replica-lag=%ds; resuming after throttling for %s", lt.MaxLag, time.Since(start).Round(time.Second))
+			}
+			return
+		}
+		now := time.Now()
+		if start.IsZero() {
+			start = now
+			lastLog = now
+			lt.logger.Infof("Throttling: waiting for replication lag to be within max-replica-lag=%ds (%s)", lt.MaxLag, strings.Join(lagging, "; "))
+		} else if now.Sub(lastLog) >= lt.logEvery {
+			lastLog = now
+			lt.logger.Infof("Throttling: still waiting after %s (%s)", now.Sub(start).Round(time.Second), strings.Join(lagging, "; "))
+		} else {
+			lt.logger.Debugf("Throttling: still waiting (%s)", strings.Join(lagging, "; "))
+		}
+		select {
+		case <-time.After(lt.interval):
+		case <-ctx.Done():
+			lt.logger.Infof("Throttling: interrupted after %s", time.Since(start).Round(time.Second))
+			return
+		}
+	}
+}
+
+// laggingReplicas returns a description of each replica which is lagging by
+// more than lt.MaxLag seconds, or whose lag cannot be determined.
+func (lt *LagThrottler) laggingReplicas(ctx context.Context) (lagging []string) {
+	for _, replica := range lt.Replicas {
+		lag, err := lt.lag(ctx, replica)
+		if err != nil {
+			lagging = append(lagging, fmt.Sprintf("%s lag unknown: %s", replica, err))
+		} else if lag > lt.MaxLag {
+			lagging = append(lagging, fmt.Sprintf("%s lag %ds", replica, lag))
+		}
+	}
+	return lagging
+}
+
+// discoverReplicas returns the addresses of replicas connected to primary. The
+// output of SHOW SLAVE HOSTS is used, if any replicas there have a reported
+// host; otherwise, the hosts of binlog dump threads in the processlist are
+// used, with the same port as primary. Each address is in format host:port.
+func discoverReplicas(ctx context.Context, primary *tengo.Instance) ([]string, error) {
+	db, err := primary.Connect("", "")
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	seen := make(map[string]bool)
+	addHost := func(host string, port int) {
+		address := fmt.Sprintf("%s:%d", host, port)
+		if !seen[address] {
+			hosts = append(hosts, address)
+			seen[address] = true
+		}
+	}
+
+	rows, err := db.QueryxContext(ctx, "SHOW SLAVE HOSTS")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		row := make(map[string]interface{})
+		if err := rows.MapScan(row); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		host := stringValue(row["Host"])
+		port, _ := strconv.Atoi(stringValue(row["Port"]))
+		if host != "" && port > 0 {
+			addHost(host, port)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(hosts) > 0 {
+		return hosts, nil
+	}
+
+	var processHosts []string
+	query := "SELECT host FROM information_schema.processlist WHERE command IN ('Binlog Dump', 'Binlog Dump GTID')"
+	if err := db.SelectContext(ctx, &processHosts, query); err != nil {
+		return nil, err
+	}
+	for _, processHost := range processHosts {
+		// Processlist hosts include the replica's ephemeral client port, if any
+		host, _, err := tengo.SplitHostOptionalPort(processHost)
+		if err == nil && host != "" {
+			addHost(host, primary.Port)
+		}
+	}
+	return hosts, nil
+}
+
+// replicaLag returns the replication lag of replica in seconds. If
+// heartbeatTable is non-empty, it should be an escaped table name, and lag is
+// computed from the most recent ts value written by pt-heartbeat --utc.
+// Otherwise, lag is obtained from Seconds_Behind_Master in SHOW SLAVE STATUS.
+// An error is returned if lag cannot be determined.
+func replicaLag(ctx context.Context, replica *tengo.Instance, heartbeatTable string) (int64, error) {
+	db, err := replica.Connect("", "")
+	if err != nil {
+		return 0, err
+	}
+	if heartbeatTable != "" {
+		var lag *int64
+		query := fmt.Sprintf("SELECT TIMESTAMPDIFF(SECOND, MAX(ts), UTC_TIMESTAMP()) FROM %s", heartbeatTable)
+		if err := db.GetContext(ctx, &lag, query); err != nil {
+			return 0, err
+		} else if lag == nil {
+			return 0, fmt.Errorf("heartbeat table is empty")
+		}
+		return *lag, nil
+	}
+
+	rows, err := db.QueryxContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("replication is not configured")
+	}
+	row := make(map[string]interface{})
+	if err := rows.MapScan(row); err != nil {
+		return 0, err
+	}
+	value := stringValue(row["Seconds_Behind_Master"])
+	if value == "" {
+		return 0, fmt.Errorf("replication is stopped")
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// stringValue converts a value obtained from sqlx MapScan into a string. NULL
+// values are returned as an empty string.
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
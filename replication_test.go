@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/skeema/tengo"
+)
+
+func TestLagThrottlerWait(t *testing.T) {
+	replica1, err := tengo.NewInstance("mysql", "root:@tcp(10.0.0.1:3306)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	replica2, err := tengo.NewInstance("mysql", "root:@tcp(10.0.0.2:3306)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+
+	// replica1 starts out lagging and catches up; replica2 has replication
+	// stopped for its first check
+	lags := map[*tengo.Instance][]int64{
+		replica1: {30, 20, 10, 5},
+		replica2: {-1, 0},
+	}
+	calls := make(map[*tengo.Instance]int)
+	lt := &LagThrottler{
+		MaxLag:   10,
+		Replicas: []*tengo.Instance{replica1, replica2},
+		interval: time.Millisecond,
+		logEvery: time.Hour,
+		logger:   log.NewEntry(log.StandardLogger()),
+		lag: func(ctx context.Context, replica *tengo.Instance) (int64, error) {
+			values := lags[replica]
+			n := calls[replica]
+			if n >= len(values) {
+				n = len(values) - 1
+			}
+			calls[replica]++
+			if values[n] < 0 {
+				return 0, errors.New("replication is stopped")
+			}
+			return values[n], nil
+		},
+	}
+
+	lagging := lt.laggingReplicas(context.Background())
+	if len(lagging) != 2 || lagging[0] != "10.0.0.1:3306 lag 30s" || !strings.Contains(lagging[1], "replication is stopped") {
+		t.Errorf("Unexpected result from laggingReplicas: %v", lagging)
+	}
+
+	lt.Wait(context.Background())
+	if calls[replica1] != 3 {
+		t.Errorf("Expected Wait to return once replica1 lag was within threshold after 3 checks; instead checked %d times", calls[replica1])
+	}
+
+	// Wait should return once ctx is canceled, even if lag is still too high
+	lags[replica1] = []int64{30}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	lt.Wait(ctx)
+
+	// Wait should not block for nil throttler or one without replicas
+	var nilThrottler *LagThrottler
+	nilThrottler.Wait(context.Background())
+	lt.Replicas = nil
+	lt.Wait(context.Background())
+}
+
+func TestNewLagThrottlerDisabled(t *testing.T) {
+	target := &Target{
+		Dir: &Dir{Path: "/tmp/product", Config: getConfig(map[string]string{"max-replica-lag": "0"})},
+	}
+	if lt, err := NewLagThrottler(context.Background(), target); lt != nil || err != nil {
+		t.Errorf("Expected nil throttler and nil error with max-replica-lag=0; instead found %+v, %v", lt, err)
+	}
+	target.Dir.Config = getConfig(map[string]string{"max-replica-lag": "abc"})
+	if _, err := NewLagThrottler(context.Background(), target); err == nil {
+		t.Error("Expected error with invalid max-replica-lag, but err was nil")
+	}
+}
+
+func TestStringValue(t *testing.T) {
+	cases := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, ""},
+		{[]byte("db2"), "db2"},
+		{int64(3306), "3306"},
+		{"abc", "abc"},
+	}
+	for _, c := range cases {
+		if actual := stringValue(c.input); actual != c.expected {
+			t.Errorf("Expected stringValue(%#v) to return %q, instead found %q", c.input, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/skeema/mybase"
+)
+
+// Severity levels for ReportFindings.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Report accumulates the results of a command for output to a CI-friendly
+// report file, in addition to the command's normal logging. It is safe for use
+// by multiple goroutines.
+type Report struct {
+	Name  string // name of the command that generated the report
+	cases []*ReportCase
+	*sync.Mutex
+}
+
+// ReportCase represents a single file or table that was evaluated by a
+// command. A case with no error findings is considered to have passed.
+type ReportCase struct {
+	Suite    string // grouping for the case, typically a directory, or an instance and schema
+	Name     string // name of the case, typically a file name or table name
+	Path     string // path of the file that the case relates to
+	Findings []ReportFinding
+}
+
+// ReportFinding represents a single problem or notable action in a
+// ReportCase.
+type ReportFinding struct {
+	Severity string // SeverityError or SeverityWarning
+	Source   string // short identifier for the type of finding, e.g. "skeema.syntax"
+	Message  string
+}
+
+// NewReport returns an empty report for the named command.
+func NewReport(name string) *Report {
+	return &Report{
+		Name:  name,
+		Mutex: new(sync.Mutex),
+	}
+}
+
+// AddCase returns a new ReportCase, which has been added to the report.
+func (r *Report) AddCase(suite, name, path string) *ReportCase {
+	rc := &ReportCase{
+		Suite: suite,
+		Name:  name,
+		Path:  path,
+	}
+	r.Lock()
+	r.cases = append(r.cases, rc)
+	r.Unlock()
+	return rc
+}
+
+// AddFinding appends a finding to the case.
+func (rc *ReportCase) AddFinding(severity, source, format string, a ...interface{}) {
+	rc.Findings = append(rc.Findings, ReportFinding{
+		Severity: severity,
+		Source:   source,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Write outputs the report to path, in the supplied format, which must be
+// either "junit" or "checkstyle".
+func (r *Report) Write(format, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "junit":
+		err = r.WriteJUnit(f)
+	case "checkstyle":
+		err = r.WriteCheckstyle(f)
+	default:
+		err = fmt.Errorf("Unsupported report format %q", format)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Cases    []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit outputs the report in JUnit XML format. Each ReportCase becomes a
+// testcase, grouped into testsuites by ReportCase.Suite. Cases with error
+// findings are reported as failures; warning findings are included in the
+// testcase's system-out.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	r.Lock()
+	defer r.Unlock()
+	root := &junitTestSuites{Name: "skeema " + r.Name}
+	suiteIndex := make(map[string]*junitTestSuite)
+	for _, rc := range r.cases {
+		suite, ok := suiteIndex[rc.Suite]
+		if !ok {
+			suite = &junitTestSuite{Name: rc.Suite}
+			suiteIndex[rc.Suite] = suite
+			root.Suites = append(root.Suites, suite)
+		}
+		tc := &junitTestCase{
+			Name:      rc.Name,
+			ClassName: rc.Suite,
+			File:      rc.Path,
+		}
+		var errors, warnings []string
+		for _, f := range rc.Findings {
+			line := fmt.Sprintf("%s: %s", f.Source, f.Message)
+			if f.Severity != SeverityError {
+				warnings = append(warnings, line)
+				continue
+			}
+			errors = append(errors, line)
+			if tc.Failure == nil {
+				tc.Failure = &junitFailure{Message: f.Message, Type: f.Source}
+			}
+		}
+		if tc.Failure != nil {
+			tc.Failure.Text = strings.Join(errors, "\n")
+			suite.Failures++
+			root.Failures++
+		}
+		tc.SystemOut = strings.Join(warnings, "\n")
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+		root.Tests++
+	}
+	return writeXML(w, root)
+}
+
+type checkstyleRoot struct {
+	XMLName xml.Name          `xml:"checkstyle"`
+	Version string            `xml:"version,attr"`
+	Files   []*checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+// WriteCheckstyle outputs the report in Checkstyle XML format. Each distinct
+// ReportCase.Path becomes a file entry, containing one error entry per
+// finding. Cases without a path use their suite and name instead.
+func (r *Report) WriteCheckstyle(w io.Writer) error {
+	r.Lock()
+	defer r.Unlock()
+	root := &checkstyleRoot{Version: "4.3"}
+	fileIndex := make(map[string]*checkstyleFile)
+	for _, rc := range r.cases {
+		name := rc.Path
+		if name == "" {
+			name = fmt.Sprintf("%s/%s", rc.Suite, rc.Name)
+		}
+		file, ok := fileIndex[name]
+		if !ok {
+			file = &checkstyleFile{Name: name}
+			fileIndex[name] = file
+			root.Files = append(root.Files, file)
+		}
+		for _, f := range rc.Findings {
+			file.Errors = append(file.Errors, checkstyleError{
+				Line:     1,
+				Severity: f.Severity,
+				Message:  f.Message,
+				Source:   f.Source,
+			})
+		}
+	}
+	return writeXML(w, root)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return err
+}
+
+// reportOptions returns the values of the report-format and report-file
+// options. An empty format indicates no report should be written. An error is
+// returned if the options are set inconsistently.
+func reportOptions(cfg *mybase.Config) (format, path string, err error) {
+	format, err = cfg.GetEnum("report-format", "junit", "checkstyle")
+	if err != nil {
+		return "", "", NewExitValue(CodeBadConfig, "%s", err)
+	}
+	path = cfg.Get("report-file")
+	if format != "" && path == "" {
+		return "", "", NewExitValue(CodeBadConfig, "Option report-format requires report-file to also be set")
+	} else if format == "" && path != "" {
+		return "", "", NewExitValue(CodeBadConfig, "Option report-file requires report-format to also be set")
+	}
+	return format, path, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func getTestReport() *Report {
+	report := NewReport("lint")
+	report.AddCase("/tmp/a", "foo.sql", "/tmp/a/foo.sql")
+	rc := report.AddCase("/tmp/a", "bar.sql", "/tmp/a/bar.sql")
+	rc.AddFinding(SeverityError, "skeema.syntax", "%s", errors.New("bad syntax"))
+	rc.AddFinding(SeverityWarning, "skeema.format", "File was reformatted")
+	report.AddCase("/tmp/b", "b", "").AddFinding(SeverityError, "skeema.target", "no host")
+	return report
+}
+
+func TestReportWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := getTestReport().WriteJUnit(&buf); err != nil {
+		t.Fatalf("Unexpected error from WriteJUnit: %s", err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("Expected output to begin with XML header, instead found %s", buf.String())
+	}
+	var decoded junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unable to decode output: %s\n%s", err, buf.String())
+	}
+	if decoded.Name != "skeema lint" || decoded.Tests != 3 || decoded.Failures != 2 || len(decoded.Suites) != 2 {
+		t.Fatalf("Unexpected top-level contents: %+v", decoded)
+	}
+	suite := decoded.Suites[0]
+	if suite.Name != "/tmp/a" || suite.Tests != 2 || suite.Failures != 1 || len(suite.Cases) != 2 {
+		t.Fatalf("Unexpected contents for first suite: %+v", suite)
+	}
+	if tc := suite.Cases[0]; tc.Name != "foo.sql" || tc.Failure != nil || tc.SystemOut != "" {
+		t.Errorf("Unexpected contents for passing test case: %+v", tc)
+	}
+	tc := suite.Cases[1]
+	if tc.Failure == nil || tc.Failure.Message != "bad syntax" || tc.Failure.Type != "skeema.syntax" {
+		t.Errorf("Unexpected failure for failing test case: %+v", tc.Failure)
+	}
+	if tc.SystemOut != "skeema.format: File was reformatted" {
+		t.Errorf("Unexpected system-out for failing test case: %q", tc.SystemOut)
+	}
+}
+
+func TestReportWriteCheckstyle(t *testing.T) {
+	var buf bytes.Buffer
+	if err := getTestReport().WriteCheckstyle(&buf); err != nil {
+		t.Fatalf("Unexpected error from WriteCheckstyle: %s", err)
+	}
+	var decoded checkstyleRoot
+	if err := xml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unable to decode output: %s\n%s", err, buf.String())
+	}
+	if len(decoded.Files) != 3 {
+		t.Fatalf("Expected 3 files, instead found %d", len(decoded.Files))
+	}
+	expectedNames := []string{"/tmp/a/foo.sql", "/tmp/a/bar.sql", "/tmp/b/b"}
+	expectedErrors := []int{0, 2, 1}
+	for n, file := range decoded.Files {
+		if file.Name != expectedNames[n] || len(file.Errors) != expectedErrors[n] {
+			t.Errorf("Unexpected contents for file[%d]: %+v", n, file)
+		}
+	}
+	if e := decoded.Files[1].Errors[1]; e.Severity != SeverityWarning || e.Source != "skeema.format" || e.Line != 1 {
+		t.Errorf("Unexpected contents for error: %+v", e)
+	}
+}
+
+func TestReportOptions(t *testing.T) {
+	assertReportOptions := func(values map[string]string, expectedFormat string, expectErr bool) {
+		format, _, err := reportOptions(getConfig(values))
+		if format != expectedFormat || (err != nil) != expectErr {
+			t.Errorf("Unexpected result from reportOptions(%v): format=%q err=%v", values, format, err)
+		}
+	}
+	assertReportOptions(map[string]string{"report-format": "", "report-file": ""}, "", false)
+	assertReportOptions(map[string]string{"report-format": "JUnit", "report-file": "out.xml"}, "junit", false)
+	assertReportOptions(map[string]string{"report-format": "checkstyle", "report-file": ""}, "", true)
+	assertReportOptions(map[string]string{"report-format": "", "report-file": "out.xml"}, "", true)
+	assertReportOptions(map[string]string{"report-format": "tap", "report-file": "out.xml"}, "", true)
+}
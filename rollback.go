@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/skeema/tengo"
+)
+
+// RollbackScript returns SQL which reverses the effects of the forward diff
+// for t, by diffing the schemas in the opposite direction. Only tables whose
+// names are in included are considered, since DDL for other tables will not be
+// executed by push. Steps which cannot fully reverse the forward DDL, such as
+// restoring a dropped table or column, are preceded by an IRREVERSIBLE comment.
+// Steps which would remove data written after push, such as dropping a newly
+// created table, are preceded by a DESTRUCTIVE comment. If there is nothing to
+// roll back, an empty string is returned.
+func RollbackScript(t *Target, forward *tengo.SchemaDiff, included map[string]bool, generated time.Time) (string, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "-- Rollback script generated by skeema push\n")
+	fmt.Fprintf(&b, "-- Instance:  %s\n", t.Instance)
+	fmt.Fprintf(&b, "-- Schema:    %s\n", t.SchemaFromDir.Name)
+	fmt.Fprintf(&b, "-- Directory: %s\n", t.Dir.Path)
+	fmt.Fprintf(&b, "-- Generated: %s\n", generated.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "--\n")
+	fmt.Fprintf(&b, "-- These statements reverse the DDL executed by push. Statements marked\n")
+	fmt.Fprintf(&b, "-- IRREVERSIBLE only restore table definitions; any data removed by push\n")
+	fmt.Fprintf(&b, "-- cannot be restored by this script.\n\n")
+
+	// If push is creating the schema, dropping it is a complete rollback
+	if t.SchemaFromInstance == nil {
+		if forward.SchemaDDL == "" {
+			return "", nil
+		}
+		fmt.Fprintf(&b, "%s;\n", t.SchemaFromDir.DropStatement())
+		return b.String(), nil
+	}
+
+	reverse, err := tengo.NewSchemaDiff(t.SchemaFromDir, t.SchemaFromInstance)
+	if err != nil {
+		return "", err
+	}
+	stmts, err := rollbackStatements(forward, reverse, included)
+	if err != nil || stmts == "" {
+		return "", err
+	}
+	fmt.Fprintf(&b, "USE %s;\n", tengo.EscapeIdentifier(t.SchemaFromDir.Name))
+	b.WriteString(stmts)
+	return b.String(), nil
+}
+
+// rollbackStatements returns the statements of reverse, annotated based on the
+// forward diff that reverse undoes, as described in RollbackScript. Only tables
+// whose names are in included are considered. If there are no statements, an
+// empty string is returned.
+func rollbackStatements(forward, reverse *tengo.SchemaDiff, included map[string]bool) (string, error) {
+	var b bytes.Buffer
+	var stmtCount int
+	if forward.SchemaDDL != "" && reverse.SchemaDDL != "" {
+		fmt.Fprintf(&b, "%s;\n", reverse.SchemaDDL)
+		stmtCount++
+	}
+
+	irreversible := irreversibleReasons(forward)
+	mods := tengo.StatementModifiers{
+		NextAutoInc: tengo.NextAutoIncIgnore,
+		AllowUnsafe: true,
+	}
+	for _, tableDiff := range reverse.TableDiffs {
+		var tableName string
+		switch td := tableDiff.(type) {
+		case tengo.CreateTable:
+			tableName = td.Table.Name
+		case tengo.DropTable:
+			tableName = td.Table.Name
+		case tengo.AlterTable:
+			tableName = td.Table.Name
+		}
+		if !included[tableName] {
+			continue
+		}
+		stmt, err := tableDiff.Statement(mods)
+		if err != nil {
+			return "", err
+		} else if stmt == "" {
+			continue
+		}
+		if reason, ok := irreversible[tableName]; ok {
+			fmt.Fprintf(&b, "\n-- IRREVERSIBLE: %s. The statement below only restores the table definition.\n", reason)
+		} else if tableDiffUnsafe(tableDiff) {
+			fmt.Fprintf(&b, "\n-- DESTRUCTIVE: the statement below removes any data written to new tables or columns of %s after push.\n", tengo.EscapeIdentifier(tableName))
+		} else {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s;\n", stmt)
+		stmtCount++
+	}
+	if stmtCount == 0 {
+		return "", nil
+	}
+	return b.String(), nil
+}
+
+// irreversibleReasons indexes the unsafe operations of the forward diff by table
+// name, returning a description of each, for annotating the corresponding
+// reverse statements.
+func irreversibleReasons(forward *tengo.SchemaDiff) map[string]string {
+	irreversible := make(map[string]string)
+	for _, tableDiff := range forward.TableDiffs {
+		switch td := tableDiff.(type) {
+		case tengo.DropTable:
+			irreversible[td.Table.Name] = fmt.Sprintf("push drops table %s and all of its data", tengo.EscapeIdentifier(td.Table.Name))
+		case tengo.AlterTable:
+			var unsafeClauses []string
+			for _, clause := range td.Clauses {
+				if clause.Unsafe() {
+					unsafeClauses = append(unsafeClauses, clause.Clause())
+				}
+			}
+			if len(unsafeClauses) > 0 {
+				irreversible[td.Table.Name] = fmt.Sprintf("push runs %s on table %s, which may remove data", strings.Join(unsafeClauses, ", "), tengo.EscapeIdentifier(td.Table.Name))
+			}
+		}
+	}
+	return irreversible
+}
+
+// rollbackPath returns the path to use for the rollback script for t, within
+// the supplied base directory. Scripts from the same run of push share a
+// subdirectory named for the supplied time.
+func rollbackPath(baseDir string, t *Target, generated time.Time) string {
+	instanceName := strings.Replace(t.Instance.String(), ":", "_", -1)
+	instanceName = strings.Replace(instanceName, "/", "_", -1)
+	return filepath.Join(baseDir, generated.UTC().Format("20060102-150405"), instanceName, t.SchemaFromDir.Name+".sql")
+}
+
+// writeRollbackScript writes contents to path, creating any missing parent
+// directories.
+func writeRollbackScript(path, contents string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(contents), 0644)
+}
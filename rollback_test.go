@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skeema/tengo"
+)
+
+func TestRollbackScriptNewSchema(t *testing.T) {
+	// NewInstance does not connect, so no database server is needed at this
+	// address; the instance is only used for the script header and path
+	inst, err := tengo.NewInstance("mysql", "root:@tcp(127.0.0.1:3306)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	target := &Target{
+		Dir:           &Dir{Path: "/tmp/product"},
+		Instance:      inst,
+		SchemaFromDir: &tengo.Schema{Name: "product"},
+	}
+	generated := time.Date(2018, 3, 14, 15, 9, 26, 0, time.UTC)
+	forward := &tengo.SchemaDiff{SchemaDDL: "CREATE DATABASE `product`"}
+	script, err := RollbackScript(target, forward, map[string]bool{}, generated)
+	if err != nil {
+		t.Fatalf("Unexpected error from RollbackScript: %s", err)
+	}
+	if !strings.HasSuffix(script, "\nDROP DATABASE `product`;\n") || !strings.Contains(script, "-- Generated: 2018-03-14T15:09:26Z\n") {
+		t.Errorf("Unexpected rollback script:\n%s", script)
+	}
+
+	if path := rollbackPath("/var/rollback", target, generated); path != "/var/rollback/20180314-150926/127.0.0.1_3306/product.sql" {
+		t.Errorf("Unexpected result from rollbackPath: %s", path)
+	}
+}
+
+// TestRollbackStatements uses in-memory diffs, since rollbackStatements does
+// not need a database. The reverse of a forward DROP TABLE is covered by
+// TestIrreversibleReasons instead, because tengo.CreateTable requires SHOW
+// CREATE TABLE output obtained from a live instance.
+func TestRollbackStatements(t *testing.T) {
+	gadgets := &tengo.Table{Name: "gadgets"}
+	widgets := &tengo.Table{Name: "widgets"}
+	users := &tengo.Table{Name: "users"}
+	age := &tengo.Column{Name: "age", TypeInDB: "int(10) unsigned", Default: tengo.ColumnDefaultValue("0")}
+	nickname := &tengo.Column{Name: "nickname", TypeInDB: "varchar(30)", Nullable: true, Default: tengo.ColumnDefaultNull}
+	forward := &tengo.SchemaDiff{
+		SchemaDDL: "ALTER DATABASE `product` CHARACTER SET utf8mb4",
+		TableDiffs: []tengo.TableDiff{
+			tengo.CreateTable{Table: gadgets},
+			tengo.AlterTable{Table: widgets, Clauses: []tengo.TableAlterClause{tengo.DropColumn{Table: widgets, Column: age}}},
+			tengo.AlterTable{Table: users, Clauses: []tengo.TableAlterClause{tengo.AddColumn{Table: users, Column: nickname}}},
+		},
+	}
+	reverse := &tengo.SchemaDiff{
+		SchemaDDL: "ALTER DATABASE `product` CHARACTER SET latin1",
+		TableDiffs: []tengo.TableDiff{
+			tengo.DropTable{Table: gadgets},
+			tengo.AlterTable{Table: widgets, Clauses: []tengo.TableAlterClause{tengo.AddColumn{Table: widgets, Column: age}}},
+			tengo.AlterTable{Table: users, Clauses: []tengo.TableAlterClause{tengo.DropColumn{Table: users, Column: nickname}}},
+		},
+	}
+	included := map[string]bool{"gadgets": true, "widgets": true, "users": true}
+	expected := "ALTER DATABASE `product` CHARACTER SET latin1;\n" +
+		"\n-- DESTRUCTIVE: the statement below removes any data written to new tables or columns of `gadgets` after push.\n" +
+		"DROP TABLE `gadgets`;\n" +
+		"\n-- IRREVERSIBLE: push runs DROP COLUMN `age` on table `widgets`, which may remove data. The statement below only restores the table definition.\n" +
+		"ALTER TABLE `widgets` ADD COLUMN `age` int(10) unsigned NOT NULL DEFAULT '0';\n" +
+		"\n-- DESTRUCTIVE: the statement below removes any data written to new tables or columns of `users` after push.\n" +
+		"ALTER TABLE `users` DROP COLUMN `nickname`;\n"
+	if stmts, err := rollbackStatements(forward, reverse, included); err != nil {
+		t.Errorf("Unexpected error from rollbackStatements: %s", err)
+	} else if stmts != expected {
+		t.Errorf("Unexpected result from rollbackStatements:\n%s", stmts)
+	}
+
+	// Tables not in included are skipped
+	included = map[string]bool{"users": true}
+	expected = "ALTER DATABASE `product` CHARACTER SET latin1;\n" +
+		"\n-- DESTRUCTIVE: the statement below removes any data written to new tables or columns of `users` after push.\n" +
+		"ALTER TABLE `users` DROP COLUMN `nickname`;\n"
+	if stmts, err := rollbackStatements(forward, reverse, included); err != nil || stmts != expected {
+		t.Errorf("Unexpected result from rollbackStatements: %v\n%s", err, stmts)
+	}
+
+	// Safe statements have no marker, and schema DDL is only reversed if push
+	// changes the schema
+	idx := &tengo.Index{Name: "idx_age", Columns: []*tengo.Column{age}, SubParts: []uint16{0}}
+	forward.SchemaDDL = ""
+	forward.TableDiffs = []tengo.TableDiff{tengo.AlterTable{Table: widgets, Clauses: []tengo.TableAlterClause{tengo.AddIndex{Table: widgets, Index: idx}}}}
+	reverse.TableDiffs = []tengo.TableDiff{tengo.AlterTable{Table: widgets, Clauses: []tengo.TableAlterClause{tengo.DropIndex{Table: widgets, Index: idx}}}}
+	included = map[string]bool{"widgets": true}
+	if stmts, err := rollbackStatements(forward, reverse, included); err != nil || stmts != "\nALTER TABLE `widgets` DROP INDEX `idx_age`;\n" {
+		t.Errorf("Unexpected result from rollbackStatements: %v\n%s", err, stmts)
+	}
+
+	// Nothing to roll back results in an empty string
+	for _, included := range []map[string]bool{{}, {"gadgets": true}} {
+		if stmts, err := rollbackStatements(forward, reverse, included); err != nil || stmts != "" {
+			t.Errorf("Expected empty result from rollbackStatements with included=%v, instead found %v %q", included, err, stmts)
+		}
+	}
+}
+
+func TestIrreversibleReasons(t *testing.T) {
+	widgets := &tengo.Table{Name: "widgets"}
+	age := &tengo.Column{Name: "age", TypeInDB: "int(10) unsigned"}
+	forward := &tengo.SchemaDiff{
+		TableDiffs: []tengo.TableDiff{
+			tengo.CreateTable{Table: &tengo.Table{Name: "gadgets"}},
+			tengo.DropTable{Table: &tengo.Table{Name: "doodads"}},
+			tengo.AlterTable{Table: widgets, Clauses: []tengo.TableAlterClause{
+				tengo.AddColumn{Table: widgets, Column: &tengo.Column{Name: "nickname", TypeInDB: "varchar(30)", Nullable: true, Default: tengo.ColumnDefaultNull}},
+				tengo.DropColumn{Table: widgets, Column: age},
+			}},
+		},
+	}
+	expected := map[string]string{
+		"doodads": "push drops table `doodads` and all of its data",
+		"widgets": "push runs DROP COLUMN `age` on table `widgets`, which may remove data",
+	}
+	actual := irreversibleReasons(forward)
+	if len(actual) != len(expected) {
+		t.Errorf("Unexpected result from irreversibleReasons: %v", actual)
+	}
+	for name, reason := range expected {
+		if actual[name] != reason {
+			t.Errorf("Expected reason for %s to be %q, instead found %q", name, reason, actual[name])
+		}
+	}
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"regexp"
 	"strings"
+	"syscall"
 )
 
 // varPlaceholder is a regexp for detecting placeholders in format "{VARNAME}"
@@ -20,7 +23,11 @@ var noQuotesNeeded = regexp.MustCompile(`^[\w/@%=:.,+-]*$`)
 // ShellOut represents a command-line for an external command, executed via sh -c
 type ShellOut struct {
 	Command          string
-	PrintableCommand string // Same as Command, but used in String() if non-empty; useful for hiding passwords in output
+	PrintableCommand string    // Same as Command, but used in String() if non-empty; useful for hiding passwords in output
+	Stdout           io.Writer // Destination for STDOUT in Run(); os.Stdout is used if nil
+	Stderr           io.Writer // Destination for STDERR in Run(); os.Stderr is used if nil
+	Env              []string  // Additional environment variables for Run(), in format "KEY=value"
+	Isolate          bool      // If true, RunContext runs the command in its own process group; see RunContext
 }
 
 func (s *ShellOut) String() string {
@@ -31,17 +38,77 @@ func (s *ShellOut) String() string {
 }
 
 // Run shells out to the external command and blocks until it completes. It
-// returns an error if one occurred. STDIN, STDOUT, and STDERR will be
-// redirected to those of the parent process.
+// returns an error if one occurred. STDIN will be redirected to that of the
+// parent process. STDOUT and STDERR will be redirected to s.Stdout and s.Stderr
+// if set, or to those of the parent process otherwise.
 func (s *ShellOut) Run() error {
+	return s.RunContext(context.Background())
+}
+
+// RunContext behaves like Run, except that the command may be interrupted via
+// ctx. Once ctx is canceled, the command is sent SIGINT, permitting it to clean
+// up before exiting. If ctx's deadline is exceeded, SIGTERM is sent instead.
+//
+// If s.Isolate is true and ctx can be canceled, the command runs in its own
+// process group, so that it does not directly receive SIGINT from the terminal,
+// and signals are sent to its entire process group. In this case STDIN is not
+// redirected, since a process outside of the terminal's foreground process
+// group cannot read from the terminal. Otherwise, the command shares the
+// process group and STDIN of the parent process, so interactive commands work
+// normally, but signals upon ctx cancelation only reach the shell process.
+func (s *ShellOut) RunContext(ctx context.Context) error {
 	if s.Command == "" {
 		return errors.New("Attempted to shell out to an empty command string")
+	} else if err := ctx.Err(); err != nil {
+		return err
 	}
 	cmd := exec.Command("/bin/sh", "-c", s.Command)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	if len(s.Env) > 0 {
+		cmd.Env = append(os.Environ(), s.Env...)
+	}
+	cmd.Stdout = s.Stdout
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	cmd.Stderr = s.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	if ctx.Done() == nil {
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+
+	if s.Isolate {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	} else {
+		cmd.Stdin = os.Stdin
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		select {
+		case <-ctx.Done():
+			sig := syscall.SIGINT
+			if ctx.Err() == context.DeadlineExceeded {
+				sig = syscall.SIGTERM
+			}
+			if s.Isolate {
+				syscall.Kill(-cmd.Process.Pid, sig)
+			} else {
+				cmd.Process.Signal(sig)
+			}
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	<-forwarded
+	return err
 }
 
 // RunCapture shells out to the external command and blocks until it completes.
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"os/exec"
 	"reflect"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestRunCaptureSplit(t *testing.T) {
@@ -108,3 +114,62 @@ func TestEscapeVarValue(t *testing.T) {
 		}
 	}
 }
+
+func TestRunContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var stdout bytes.Buffer
+	// With Isolate, SIGINT reaches the shell's child process too, so the shell's
+	// trap runs once sleep is killed. Without Isolate, only the shell receives
+	// SIGINT, so sleep is backgrounded to permit the trap to run promptly.
+	commands := map[bool]string{
+		true:  "trap 'echo caught; exit 3' INT; sleep 10",
+		false: "trap 'echo caught; exit 3' INT; sleep 10 >/dev/null 2>&1 & wait",
+	}
+	for isolate, command := range commands {
+		ctx, cancel := context.WithCancel(context.Background())
+		stdout.Reset()
+		s := &ShellOut{
+			Command: command,
+			Stdout:  &stdout,
+			Isolate: isolate,
+		}
+		time.AfterFunc(200*time.Millisecond, cancel)
+		start := time.Now()
+		err := s.RunContext(ctx)
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+			t.Errorf("With Isolate=%t, expected command to exit with code 3 upon SIGINT, instead err=%v", isolate, err)
+		}
+		if stdout.String() != "caught\n" {
+			t.Errorf("With Isolate=%t, unexpected output: %q", isolate, stdout.String())
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("With Isolate=%t, expected SIGINT to stop command promptly, but it ran for %s", isolate, elapsed)
+		}
+		cancel()
+	}
+
+	// Only isolated commands run in their own process group
+	for _, isolate := range []bool{true, false} {
+		stdout.Reset()
+		s := &ShellOut{
+			Command: "ps -o pgid= -p $$",
+			Stdout:  &stdout,
+			Isolate: isolate,
+		}
+		if err := s.RunContext(ctx); err != nil {
+			t.Fatalf("Unexpected error from RunContext: %s", err)
+		}
+		ownGroup := strings.TrimSpace(stdout.String()) == strconv.Itoa(syscall.Getpgrp())
+		if ownGroup == isolate {
+			t.Errorf("With Isolate=%t, unexpected process group %s (parent's is %d)", isolate, strings.TrimSpace(stdout.String()), syscall.Getpgrp())
+		}
+	}
+
+	// Commands should not be started if ctx is already canceled
+	cancel()
+	stdout.Reset()
+	s := &ShellOut{Command: "echo hello", Stdout: &stdout}
+	if err := s.RunContext(ctx); err != context.Canceled || stdout.Len() > 0 {
+		t.Errorf("Expected canceled context to prevent running command; instead err=%v, output=%q", err, stdout.String())
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/skeema/tengo"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshConnectTimeout limits how long establishing a connection to a bastion
+// host may take.
+const sshConnectTimeout = 5 * time.Second
+
+// sshDefaultKeyFiles lists the private key files, relative to the home
+// directory, which are tried if ssh-key is not set.
+var sshDefaultKeyFiles = []string{".ssh/id_rsa", ".ssh/id_ecdsa", ".ssh/id_ed25519"}
+
+// sshKnownHostsFiles lists the known_hosts files used to verify bastion host
+// keys. Relative paths are relative to the home directory.
+var sshKnownHostsFiles = []string{".ssh/known_hosts", "/etc/ssh/ssh_known_hosts"}
+
+// registeredSSHNets tracks which custom networks have already been registered
+// with the MySQL driver, keyed by network name.
+var registeredSSHNets = struct {
+	sync.Mutex
+	byName map[string]*sshTunnel
+}{byName: make(map[string]*sshTunnel)}
+
+// SSHOptions represents the values of the ssh-* options, which configure
+// connecting to database instances through an SSH bastion host.
+type SSHOptions struct {
+	Host string // bastion hostname, optionally with :port suffix
+	User string // username on the bastion host; blank to use current OS user
+	Key  string // path to private key file; blank to use default key files
+}
+
+// Enabled returns true if database connections should be tunneled over SSH.
+func (opts SSHOptions) Enabled() bool {
+	return opts.Host != ""
+}
+
+// DriverNet returns the name of a custom network, registered with the MySQL
+// driver, which dials database instances through the SSH bastion host. This
+// name may be used in place of "tcp" in a DSN. All database connections using
+// the same options share a single SSH connection to the bastion host.
+func (opts SSHOptions) DriverNet() (string, error) {
+	if _, _, err := tengo.SplitHostOptionalPort(opts.Host); err != nil {
+		return "", fmt.Errorf("Invalid value for ssh-host: %s", err)
+	}
+	name := fmt.Sprintf("ssh_%x", sha1.Sum([]byte(strings.Join([]string{opts.Host, opts.User, opts.Key}, "\x00"))))
+	registeredSSHNets.Lock()
+	defer registeredSSHNets.Unlock()
+	if registeredSSHNets.byName[name] == nil {
+		tunnel := &sshTunnel{opts: opts}
+		mysql.RegisterDial(name, tunnel.Dial)
+		registeredSSHNets.byName[name] = tunnel
+	}
+	return name, nil
+}
+
+// Addr returns the bastion host's address in host:port format, using the
+// default SSH port if ssh-host did not include one.
+func (opts SSHOptions) Addr() string {
+	host, port, _ := tengo.SplitHostOptionalPort(opts.Host) // error already checked in DriverNet
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// ClientConfig returns the configuration for connecting to the bastion host.
+// Authentication uses ssh-key, or the default key files if it is not set, as
+// well as any supplied agentSigners. The bastion host's key must be present in
+// a known_hosts file.
+func (opts SSHOptions) ClientConfig(agentSigners []ssh.Signer) (*ssh.ClientConfig, error) {
+	config := &ssh.ClientConfig{
+		User:    opts.User,
+		Timeout: sshConnectTimeout,
+	}
+	if config.User == "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to determine user for ssh-host; set ssh-user instead: %s", err)
+		}
+		config.User = u.Username
+	}
+
+	home := filepath.Clean(os.Getenv("HOME"))
+	var signers []ssh.Signer
+	if opts.Key != "" {
+		signer, err := readSSHKey(opts.Key)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to use ssh-key %s: %s", opts.Key, err)
+		}
+		signers = append(signers, signer)
+	} else {
+		// Skip default key files which are missing or cannot be used, such as
+		// those protected by a passphrase
+		for _, path := range sshDefaultKeyFiles {
+			if signer, err := readSSHKey(filepath.Join(home, path)); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+	}
+	signers = append(signers, agentSigners...)
+	if len(signers) == 0 {
+		return nil, errors.New("No usable private keys for ssh-host; set ssh-key to a key without a passphrase, or use an SSH agent")
+	}
+	config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signers...)}
+
+	var knownHostsFiles []string
+	for _, path := range sshKnownHostsFiles {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(home, path)
+		}
+		if _, err := os.Stat(path); err == nil {
+			knownHostsFiles = append(knownHostsFiles, path)
+		}
+	}
+	if len(knownHostsFiles) == 0 {
+		return nil, fmt.Errorf("Unable to verify host key of ssh-host %s: no known_hosts file found", opts.Host)
+	}
+	callback, err := knownhosts.New(knownHostsFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read known_hosts: %s", err)
+	}
+	config.HostKeyCallback = callback
+	return config, nil
+}
+
+// readSSHKey returns a signer for the unencrypted private key file at path.
+func readSSHKey(path string) (ssh.Signer, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(pem)
+}
+
+// sshTunnel dials database instances through a single SSH connection to a
+// bastion host. The SSH connection is established upon first use, and is
+// re-established upon next use if it is lost.
+type sshTunnel struct {
+	opts   SSHOptions
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// Dial satisfies the mysql.DialFunc signature. It returns a connection to addr
+// (in host:port format), forwarded through the bastion host. Note that the
+// returned connection does not support deadlines, so the driver's readTimeout
+// and writeTimeout params cannot be used.
+func (t *sshTunnel) Dial(addr string) (net.Conn, error) {
+	client, err := t.connect()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to ssh-host %s: %s", t.opts.Host, err)
+	}
+	conn, err := client.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to %s via ssh-host %s: %s", addr, t.opts.Host, err)
+	}
+	return conn, nil
+}
+
+// connect returns the tunnel's SSH client, connecting to the bastion host if
+// no connection is currently open.
+func (t *sshTunnel) connect() (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	// Keys held by an SSH agent sign through the agent connection, which must
+	// remain open until authentication completes
+	var agentSigners []ssh.Signer
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if agentConn, err := net.Dial("unix", socket); err == nil {
+			defer agentConn.Close()
+			agentSigners, _ = agent.NewClient(agentConn).Signers()
+		}
+	}
+	config, err := t.opts.ClientConfig(agentSigners)
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", t.opts.Addr(), config)
+	if err != nil {
+		return nil, err
+	}
+	t.client = client
+
+	// Forget the client once its connection is lost, so that the next Dial
+	// reconnects
+	go func() {
+		client.Wait()
+		t.mu.Lock()
+		if t.client == client {
+			t.client = nil
+		}
+		t.mu.Unlock()
+	}()
+	return client, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestSSHOptionsAddr(t *testing.T) {
+	cases := map[string]string{
+		"bastion.example.com:2222": "bastion.example.com:2222",
+		"bastion":                  "bastion:22",
+	}
+	for host, expected := range cases {
+		if actual := (SSHOptions{Host: host}).Addr(); actual != expected {
+			t.Errorf("Expected ssh-host=%s to have address %s, instead found %s", host, expected, actual)
+		}
+	}
+}
+
+func TestSSHOptionsDriverNet(t *testing.T) {
+	name, err := SSHOptions{Host: "bastion:2222"}.DriverNet()
+	if err != nil || !strings.HasPrefix(name, "ssh_") {
+		t.Errorf("Unexpected result from DriverNet: %q, %v", name, err)
+	}
+	if name2, err := (SSHOptions{Host: "bastion:2222"}).DriverNet(); err != nil || name2 != name {
+		t.Errorf("Expected identical options to share network %s, instead found %q, %v", name, name2, err)
+	}
+	if _, err := (SSHOptions{Host: "bastion:port"}).DriverNet(); err == nil {
+		t.Error("Expected error from DriverNet for invalid port, but none returned")
+	}
+}
+
+func TestSSHTunnelDial(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "skeematest")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	origHome, origAuthSock := os.Getenv("HOME"), os.Getenv("SSH_AUTH_SOCK")
+	defer func() {
+		os.Setenv("HOME", origHome)
+		os.Setenv("SSH_AUTH_SOCK", origAuthSock)
+	}()
+	os.Setenv("HOME", tempDir)
+	os.Unsetenv("SSH_AUTH_SOCK")
+	if err := os.Mkdir(filepath.Join(tempDir, ".ssh"), 0700); err != nil {
+		t.Fatalf("Unable to create dir: %s", err)
+	}
+
+	newKey := func() (*ecdsa.PrivateKey, ssh.Signer) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Unable to generate key: %s", err)
+		}
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			t.Fatalf("Unable to create signer: %s", err)
+		}
+		return key, signer
+	}
+	_, hostSigner := newKey()
+	clientKey, clientSigner := newKey()
+	der, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatalf("Unable to marshal key: %s", err)
+	}
+	keyPath := filepath.Join(tempDir, "id_test")
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Unable to write key: %s", err)
+	}
+
+	// Fake bastion host which accepts only the client key, and echoes back all
+	// data sent through forwarded connections
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() != "deploy" || !bytes.Equal(key.Marshal(), clientSigner.PublicKey().Marshal()) {
+				return nil, errors.New("unauthorized")
+			}
+			return nil, nil
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	defer listener.Close()
+	var sshConns int32
+	go func() {
+		for {
+			nConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(nConn, serverConfig)
+				if err != nil {
+					return
+				}
+				atomic.AddInt32(&sshConns, 1)
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					ch, chReqs, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go ssh.DiscardRequests(chReqs)
+					go func() {
+						io.Copy(ch, ch)
+						ch.Close()
+					}()
+				}
+			}()
+		}
+	}()
+
+	addr := listener.Addr().String()
+	knownHosts := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostSigner.PublicKey()) + "\n"
+	if err := ioutil.WriteFile(filepath.Join(tempDir, ".ssh", "known_hosts"), []byte(knownHosts), 0600); err != nil {
+		t.Fatalf("Unable to write known_hosts: %s", err)
+	}
+
+	// Multiple connections share a single connection to the bastion host
+	tunnel := &sshTunnel{opts: SSHOptions{Host: addr, User: "deploy", Key: keyPath}}
+	for n := 0; n < 2; n++ {
+		conn, err := tunnel.Dial("db1:3306")
+		if err != nil {
+			t.Fatalf("Unexpected error from Dial: %s", err)
+		}
+		if _, err := conn.Write([]byte("hello")); err != nil {
+			t.Fatalf("Unexpected error from Write: %s", err)
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+			t.Errorf("Expected to read back \"hello\", instead found %q, err=%v", buf, err)
+		}
+		conn.Close()
+	}
+	if count := atomic.LoadInt32(&sshConns); count != 1 {
+		t.Errorf("Expected 1 connection to bastion host, instead found %d", count)
+	}
+
+	// Authentication fails for wrong user
+	tunnel = &sshTunnel{opts: SSHOptions{Host: addr, User: "nobody", Key: keyPath}}
+	if _, err := tunnel.Dial("db1:3306"); err == nil {
+		t.Error("Expected error from Dial with wrong user, but err was nil")
+	}
+
+	// Host key verification fails if known_hosts has a different key
+	_, otherSigner := newKey()
+	knownHosts = knownhosts.Line([]string{knownhosts.Normalize(addr)}, otherSigner.PublicKey()) + "\n"
+	if err := ioutil.WriteFile(filepath.Join(tempDir, ".ssh", "known_hosts"), []byte(knownHosts), 0600); err != nil {
+		t.Fatalf("Unable to write known_hosts: %s", err)
+	}
+	tunnel = &sshTunnel{opts: SSHOptions{Host: addr, User: "deploy", Key: keyPath}}
+	if _, err := tunnel.Dial("db1:3306"); err == nil {
+		t.Error("Expected error from Dial with mismatched host key, but err was nil")
+	}
+
+	// No usable keys without ssh-key, default key files, or agent
+	tunnel = &sshTunnel{opts: SSHOptions{Host: addr, User: "deploy"}}
+	if _, err := tunnel.Dial("db1:3306"); err == nil || !strings.Contains(err.Error(), "No usable private keys") {
+		t.Errorf("Expected error about missing keys, instead found %v", err)
+	}
+}
+
+func TestInstancesSSH(t *testing.T) {
+	dir := &Dir{
+		Path:    "/tmp/dummydir",
+		Config:  getGlobalConfig(map[string]string{"host": "localhost,db2:3307", "ssh-host": "bastion"}),
+		section: "production",
+	}
+	instances, err := dir.Instances()
+	if err != nil || len(instances) != 2 {
+		t.Fatalf("Unexpected result from Instances: %v, %v", instances, err)
+	}
+	for n, expected := range []string{"localhost:3306", "db2:3307"} {
+		if instances[n].String() != expected || !strings.Contains(instances[n].BaseDSN, "@ssh_") {
+			t.Errorf("Expected instance %s with ssh network, instead found %s (DSN %s)", expected, instances[n], instances[n].BaseDSN)
+		}
+	}
+}
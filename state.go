@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stateVersion is the current version of the push state file format.
+const stateVersion = 1
+
+// Target statuses tracked in a push state file.
+const (
+	TargetPending  = "pending"
+	TargetFailed   = "failed"
+	TargetComplete = "complete"
+)
+
+// PushState tracks the progress of `skeema push` in a local file, so that a
+// push which partially failed can subsequently be resumed. The file is
+// rewritten after every change. It is safe for use by multiple goroutines, and
+// all methods may be called on a nil *PushState, in which case they do nothing.
+type PushState struct {
+	Version     int            `json:"version"`
+	Environment string         `json:"environment"`
+	StartedAt   time.Time      `json:"started_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	Targets     []*TargetState `json:"targets"`
+	path        string
+	err         error // first error encountered writing the file
+	*sync.Mutex `json:"-"`
+}
+
+// TargetState tracks the progress of push for a single instance and schema.
+// Statements lists the DDL that was successfully executed. Warnings lists
+// problems which did not prevent the target from completing, such as tables
+// that could not be altered due to unsupported features.
+type TargetState struct {
+	Dir        string            `json:"dir"`
+	Instance   string            `json:"instance,omitempty"`
+	Schema     string            `json:"schema,omitempty"`
+	Status     string            `json:"status"`
+	Statements []*StatementState `json:"statements"`
+	Error      string            `json:"error,omitempty"`
+	Warnings   []string          `json:"warnings,omitempty"`
+}
+
+// StatementState represents a single executed DDL statement. Table is empty
+// for schema-level DDL.
+type StatementState struct {
+	Table       string    `json:"table,omitempty"`
+	Statement   string    `json:"statement"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// NewPushState returns an empty PushState for the named environment, which
+// will be written to the file at path.
+func NewPushState(path, environment string) *PushState {
+	return &PushState{
+		Version:     stateVersion,
+		Environment: environment,
+		StartedAt:   time.Now().UTC(),
+		Targets:     []*TargetState{},
+		path:        path,
+		Mutex:       new(sync.Mutex),
+	}
+}
+
+// ReadPushState reads and returns the PushState stored in the file at path.
+func ReadPushState(path string) (*PushState, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ps := &PushState{path: path, Mutex: new(sync.Mutex)}
+	if err := json.Unmarshal(data, ps); err != nil {
+		return nil, fmt.Errorf("Unable to parse state file %s: %s", path, err)
+	}
+	if ps.Version != stateVersion {
+		return nil, fmt.Errorf("State file %s has unsupported version %d", path, ps.Version)
+	}
+	if ps.Targets == nil {
+		ps.Targets = []*TargetState{}
+	}
+	return ps, nil
+}
+
+// Completed returns true if t was previously pushed successfully in full.
+func (ps *PushState) Completed(t *Target) bool {
+	if ps == nil {
+		return false
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	ts := ps.find(targetStateKey(t))
+	return ts != nil && ts.Status == TargetComplete
+}
+
+// Begin marks t as pending, and returns the set of statements previously
+// executed for t, if any. Entries recorded for t's dir by an earlier attempt
+// which failed before an instance or schema could be determined are removed,
+// since they are superseded by this one.
+func (ps *PushState) Begin(t *Target) map[string]bool {
+	if ps == nil {
+		return nil
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	dir, instance, schema := targetStateKey(t)
+	ps.removeSuperseded(dir, instance, schema)
+	ts := ps.findOrAdd(dir, instance, schema)
+	ts.Status = TargetPending
+	ts.Error = ""
+	ts.Warnings = nil
+	previous := make(map[string]bool, len(ts.Statements))
+	for _, stmt := range ts.Statements {
+		previous[stmt.Statement] = true
+	}
+	ps.save()
+	return previous
+}
+
+// Queue records each of targets as pending, unless it was already completed.
+// This should be called before beginning any work, so that targets which are
+// never begun, due to an interrupt or fatal error, are still tracked. Entries
+// for failed targets from an earlier attempt are retained until Begin is
+// called for them.
+func (ps *PushState) Queue(targets []*Target) {
+	if ps == nil {
+		return
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	for _, t := range targets {
+		dir, instance, schema := targetStateKey(t)
+		ps.removeSuperseded(dir, instance, schema)
+		ps.findOrAdd(dir, instance, schema)
+	}
+	ps.save()
+}
+
+// RecordStatement records that statement was successfully executed for t.
+func (ps *PushState) RecordStatement(t *Target, tableName, statement string) {
+	if ps == nil {
+		return
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	ts := ps.findOrAdd(targetStateKey(t))
+	ts.Statements = append(ts.Statements, &StatementState{
+		Table:       tableName,
+		Statement:   statement,
+		CompletedAt: time.Now().UTC(),
+	})
+	ps.save()
+}
+
+// Fail marks t as failed. Only the first failure message for each attempt is
+// retained.
+func (ps *PushState) Fail(t *Target, format string, a ...interface{}) {
+	if ps == nil {
+		return
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	ts := ps.findOrAdd(targetStateKey(t))
+	if ts.Status != TargetFailed {
+		ts.Status = TargetFailed
+		ts.Error = fmt.Sprintf(format, a...)
+		ps.save()
+	}
+}
+
+// Warn records a problem with t which does not prevent it from completing.
+func (ps *PushState) Warn(t *Target, format string, a ...interface{}) {
+	if ps == nil {
+		return
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	ts := ps.findOrAdd(targetStateKey(t))
+	ts.Warnings = append(ts.Warnings, fmt.Sprintf(format, a...))
+	ps.save()
+}
+
+// Finish marks t as complete, unless a failure was recorded for it.
+func (ps *PushState) Finish(t *Target) {
+	if ps == nil {
+		return
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	ts := ps.findOrAdd(targetStateKey(t))
+	if ts.Status != TargetFailed {
+		ts.Status = TargetComplete
+		ps.save()
+	}
+}
+
+// Pending returns the targets which are not yet complete, sorted by dir,
+// instance, and schema.
+func (ps *PushState) Pending() []*TargetState {
+	if ps == nil {
+		return nil
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	var pending []*TargetState
+	for _, ts := range ps.Targets {
+		if ts.Status != TargetComplete {
+			pending = append(pending, ts)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		a, b := pending[i], pending[j]
+		if a.Dir != b.Dir {
+			return a.Dir < b.Dir
+		} else if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return a.Schema < b.Schema
+	})
+	return pending
+}
+
+// Err returns the first error encountered writing the state file, if any.
+func (ps *PushState) Err() error {
+	if ps == nil {
+		return nil
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	return ps.err
+}
+
+// Write writes the state file, returning any error.
+func (ps *PushState) Write() error {
+	ps.Lock()
+	defer ps.Unlock()
+	ps.save()
+	return ps.err
+}
+
+// save writes the state file, by way of a temporary file in the same directory
+// which is then renamed, so that an interrupted write cannot corrupt the
+// previous contents. Errors are retained for retrieval by Err. The caller must
+// hold the lock.
+func (ps *PushState) save() {
+	ps.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(ps, "", "  ")
+	if err == nil {
+		tempPath := filepath.Join(filepath.Dir(ps.path), "."+filepath.Base(ps.path)+".tmp")
+		if err = ioutil.WriteFile(tempPath, append(data, '\n'), 0644); err == nil {
+			err = os.Rename(tempPath, ps.path)
+		}
+	}
+	if err != nil && ps.err == nil {
+		ps.err = err
+	}
+}
+
+func (ps *PushState) find(dir, instance, schema string) *TargetState {
+	for _, ts := range ps.Targets {
+		if ts.Dir == dir && ts.Instance == instance && ts.Schema == schema {
+			return ts
+		}
+	}
+	return nil
+}
+
+// removeSuperseded removes incomplete entries for dir which were recorded by an
+// earlier attempt that failed before an instance or schema could be determined,
+// if the supplied instance and schema are more specific. The caller must hold
+// the lock.
+func (ps *PushState) removeSuperseded(dir, instance, schema string) {
+	kept := ps.Targets[:0]
+	for _, ts := range ps.Targets {
+		superseded := ts.Dir == dir && ts.Status != TargetComplete &&
+			((ts.Instance == "" && instance != "") || (ts.Instance == instance && ts.Schema == "" && schema != ""))
+		if !superseded {
+			kept = append(kept, ts)
+		}
+	}
+	ps.Targets = kept
+}
+
+func (ps *PushState) findOrAdd(dir, instance, schema string) *TargetState {
+	if ts := ps.find(dir, instance, schema); ts != nil {
+		return ts
+	}
+	ts := &TargetState{
+		Dir:        dir,
+		Instance:   instance,
+		Schema:     schema,
+		Status:     TargetPending,
+		Statements: []*StatementState{},
+	}
+	ps.Targets = append(ps.Targets, ts)
+	return ts
+}
+
+// targetStateKey returns the dir path, instance, and schema name identifying
+// t. The instance and schema name may be empty if t could not be fully
+// determined due to an error.
+func targetStateKey(t *Target) (dir, instance, schema string) {
+	dir = t.Dir.Path
+	if t.Instance != nil {
+		instance = t.Instance.String()
+	}
+	if t.SchemaFromDir != nil {
+		schema = t.SchemaFromDir.Name
+	}
+	return
+}
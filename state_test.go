@@ -0,0 +1,196 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skeema/tengo"
+)
+
+func TestPushState(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "skeema-state")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "state.json")
+
+	inst, err := tengo.NewInstance("mysql", "root:@tcp(127.0.0.1:3306)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	dir := &Dir{Path: "/tmp/product"}
+	unreachable := &Target{Dir: dir, Instance: inst}
+	product := &Target{Dir: dir, Instance: inst, SchemaFromDir: &tengo.Schema{Name: "product"}}
+	analytics := &Target{Dir: &Dir{Path: "/tmp/analytics"}, Instance: inst, SchemaFromDir: &tengo.Schema{Name: "analytics"}}
+
+	// First attempt: one target fails before its schema could be determined, and
+	// another fails partway through
+	ps := NewPushState(path, "production")
+	ps.Begin(unreachable)
+	ps.Fail(unreachable, "connection refused")
+	ps.Begin(analytics)
+	ps.RecordStatement(analytics, "", "CREATE DATABASE `analytics`")
+	ps.RecordStatement(analytics, "events", "CREATE TABLE `events` (`id` int)")
+	ps.Fail(analytics, "Error running DDL for table %s", "sessions")
+	ps.Fail(analytics, "this message should not replace the first one")
+	if err := ps.Err(); err != nil {
+		t.Fatalf("Unexpected error writing state file: %s", err)
+	}
+	if pending := ps.Pending(); len(pending) != 2 || pending[0].Dir != "/tmp/analytics" || pending[1].Schema != "" {
+		t.Fatalf("Unexpected result from Pending: %+v", pending)
+	} else if pending[0].Error != "Error running DDL for table sessions" || pending[1].Error != "connection refused" {
+		t.Errorf("Unexpected errors in pending targets: %q, %q", pending[0].Error, pending[1].Error)
+	}
+
+	// Second attempt, reading state from the file
+	ps, err = ReadPushState(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from ReadPushState: %s", err)
+	}
+	if ps.Environment != "production" || len(ps.Targets) != 2 {
+		t.Fatalf("Unexpected state after roundtrip: %+v", ps)
+	}
+	if ps.Completed(product) || ps.Completed(analytics) {
+		t.Error("Expected no targets to be completed yet")
+	}
+	ps.Begin(product) // supersedes the entry for unreachable
+	ps.Finish(product)
+	previous := ps.Begin(analytics)
+	if len(previous) != 2 || !previous["CREATE TABLE `events` (`id` int)"] {
+		t.Errorf("Unexpected previous statements from Begin: %v", previous)
+	}
+	if pending := ps.Pending(); len(pending) != 1 || pending[0].Status != TargetPending || pending[0].Error != "" {
+		t.Errorf("Unexpected result from Pending: %+v", pending)
+	}
+	ps.RecordStatement(analytics, "sessions", "CREATE TABLE `sessions` (`id` int)")
+	ps.Finish(analytics)
+	if !ps.Completed(product) || !ps.Completed(analytics) || len(ps.Pending()) != 0 {
+		t.Errorf("Expected all targets to be completed; instead pending=%+v", ps.Pending())
+	}
+	if len(ps.Targets) != 2 || len(ps.Targets[0].Statements) != 3 {
+		t.Errorf("Unexpected targets in state: %+v", ps.Targets)
+	}
+
+	// Methods should be no-ops on a nil PushState
+	var nilState *PushState
+	nilState.Begin(product)
+	nilState.Fail(product, "error")
+	nilState.Finish(product)
+	if nilState.Completed(product) || nilState.Pending() != nil || nilState.Err() != nil {
+		t.Error("Unexpected result from method on nil PushState")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"version": 99}`), 0644); err != nil {
+		t.Fatalf("Unable to write file: %s", err)
+	}
+	if _, err := ReadPushState(path); err == nil {
+		t.Error("Expected error from ReadPushState on unsupported version, but err was nil")
+	}
+}
+
+func TestPushStateResumeFailed(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "skeema-state")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "state.json")
+
+	inst, err := tengo.NewInstance("mysql", "root:@tcp(127.0.0.1:3306)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	target := &Target{Dir: &Dir{Path: "/tmp/product"}, Instance: inst, SchemaFromDir: &tengo.Schema{Name: "product"}}
+
+	// First attempt fails, and also has a table with unsupported features
+	ps := NewPushState(path, "production")
+	ps.Begin(target)
+	ps.Warn(target, "Unable to generate ALTER TABLE for table %s due to use of unsupported features", "orders")
+	ps.Fail(target, "Error running DDL for table %s", "users")
+	ps.Finish(target)
+	if ps.Completed(target) {
+		t.Fatal("Expected failed target to not be completed")
+	}
+
+	// Resumed attempt no longer hits the failure, so the target is completed
+	// despite the unsupported table
+	ps, err = ReadPushState(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from ReadPushState: %s", err)
+	}
+	if pending := ps.Pending(); len(pending) != 1 || pending[0].Status != TargetFailed || len(pending[0].Warnings) != 1 {
+		t.Fatalf("Unexpected result from Pending after roundtrip: %+v", pending)
+	}
+	ps.Begin(target)
+	if ts := ps.Pending()[0]; ts.Error != "" || len(ts.Warnings) != 0 {
+		t.Errorf("Expected Begin to clear error and warnings from previous attempt, instead found %+v", ts)
+	}
+	ps.Warn(target, "Unable to generate ALTER TABLE for table %s due to use of unsupported features", "orders")
+	ps.Finish(target)
+	if !ps.Completed(target) || len(ps.Pending()) != 0 {
+		t.Errorf("Expected target to be completed; instead pending=%+v", ps.Pending())
+	}
+
+	// Completion is persisted, along with the warning
+	ps, err = ReadPushState(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from ReadPushState: %s", err)
+	}
+	if !ps.Completed(target) || len(ps.Targets) != 1 || len(ps.Targets[0].Warnings) != 1 {
+		t.Errorf("Unexpected state after roundtrip: %+v", ps.Targets)
+	}
+
+	var nilState *PushState
+	nilState.Warn(target, "warning")
+}
+
+func TestPushStateQueue(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "skeema-state")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "state.json")
+
+	inst, err := tengo.NewInstance("mysql", "root:@tcp(127.0.0.1:3306)/")
+	if err != nil {
+		t.Fatalf("Unable to create instance: %s", err)
+	}
+	dir := &Dir{Path: "/tmp/product"}
+	unreachable := &Target{Dir: dir, Instance: inst}
+	product := &Target{Dir: dir, Instance: inst, SchemaFromDir: &tengo.Schema{Name: "product"}}
+	analytics := &Target{Dir: &Dir{Path: "/tmp/analytics"}, Instance: inst, SchemaFromDir: &tengo.Schema{Name: "analytics"}}
+	orders := &Target{Dir: &Dir{Path: "/tmp/orders"}, Instance: inst, SchemaFromDir: &tengo.Schema{Name: "orders"}}
+
+	// First attempt: one target completes, one fails before its schema could be
+	// determined, and the others are never begun
+	ps := NewPushState(path, "production")
+	ps.Queue([]*Target{analytics, unreachable, orders})
+	ps.Begin(analytics)
+	ps.Finish(analytics)
+	ps.Begin(unreachable)
+	ps.Fail(unreachable, "connection refused")
+	if pending := ps.Pending(); len(pending) != 2 || pending[0].Dir != "/tmp/orders" || pending[0].Status != TargetPending || pending[1].Error != "connection refused" {
+		t.Fatalf("Unexpected result from Pending: %+v", pending)
+	}
+
+	// Second attempt: queueing does not alter completed targets, and supersedes
+	// the entry for unreachable
+	ps, err = ReadPushState(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from ReadPushState: %s", err)
+	}
+	ps.Queue([]*Target{analytics, product, orders})
+	if !ps.Completed(analytics) || len(ps.Targets) != 3 {
+		t.Errorf("Unexpected targets after Queue: %+v", ps.Targets)
+	}
+	if pending := ps.Pending(); len(pending) != 2 || pending[0].Dir != "/tmp/orders" || pending[1].Schema != "product" || pending[1].Status != TargetPending {
+		t.Errorf("Unexpected result from Pending: %+v", pending)
+	}
+
+	var nilState *PushState
+	nilState.Queue([]*Target{product})
+}
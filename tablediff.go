@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// ANSI escape sequences used for colorizing unified diff output
+const (
+	ansiReset       = "\x1b[0m"
+	ansiBold        = "\x1b[1m"
+	ansiBrightRed   = "\x1b[31;1m"
+	ansiBrightGreen = "\x1b[32;1m"
+	ansiBrightCyan  = "\x1b[36;1m"
+)
+
+// CreateStatementDiff returns a unified diff between two CREATE TABLE
+// statements, as a slice of lines without trailing newlines. The diff includes
+// the supplied number of lines of context around each change. If the
+// statements are identical, an empty slice is returned.
+func CreateStatementDiff(fromCreate, toCreate, fromLabel, toLabel string, context int) ([]string, error) {
+	diff := difflib.UnifiedDiff{
+		A:        difflib.SplitLines(fromCreate),
+		B:        difflib.SplitLines(toCreate),
+		FromFile: fromLabel,
+		ToFile:   toLabel,
+		Context:  context,
+	}
+	diffText, err := difflib.GetUnifiedDiffString(diff)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(diffText, "\n") {
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// colorizeDiffLine wraps a single line of unified diff output in ANSI color
+// codes based on its type: file headers in bold, hunk headers in cyan, removed
+// lines in red, and added lines in green. Context lines are returned as-is.
+func colorizeDiffLine(line string) string {
+	var color string
+	switch {
+	case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+		color = ansiBold
+	case strings.HasPrefix(line, "@@"):
+		color = ansiBrightCyan
+	case strings.HasPrefix(line, "-"):
+		color = ansiBrightRed
+	case strings.HasPrefix(line, "+"):
+		color = ansiBrightGreen
+	default:
+		return line
+	}
+	return color + line + ansiReset
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCreateStatementDiff(t *testing.T) {
+	from := "CREATE TABLE `foo` (\n  `id` int(10) unsigned NOT NULL,\n  `name` varchar(30) DEFAULT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=latin1"
+	to := "CREATE TABLE `foo` (\n  `id` int(10) unsigned NOT NULL,\n  `name` varchar(40) DEFAULT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=latin1"
+	lines, err := CreateStatementDiff(from, to, "instance", "filesystem", 1)
+	if err != nil {
+		t.Fatalf("Unexpected error from CreateStatementDiff: %s", err)
+	}
+	expected := []string{
+		"--- instance",
+		"+++ filesystem",
+		"@@ -2,3 +2,3 @@",
+		"   `id` int(10) unsigned NOT NULL,",
+		"-  `name` varchar(30) DEFAULT NULL,",
+		"+  `name` varchar(40) DEFAULT NULL,",
+		"   PRIMARY KEY (`id`)",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, instead found %d: %q", len(expected), len(lines), lines)
+	}
+	for n := range lines {
+		if lines[n] != expected[n] {
+			t.Errorf("Line %d: expected %q, found %q", n, expected[n], lines[n])
+		}
+	}
+
+	if lines, err := CreateStatementDiff(from, from, "instance", "filesystem", 3); err != nil || len(lines) != 0 {
+		t.Errorf("Expected no lines and no error for identical input, instead found %q, %v", lines, err)
+	}
+}
+
+func TestColorizeDiffLine(t *testing.T) {
+	cases := map[string]string{
+		"--- instance":      ansiBold + "--- instance" + ansiReset,
+		"+++ filesystem":    ansiBold + "+++ filesystem" + ansiReset,
+		"@@ -2,3 +2,3 @@":   ansiBrightCyan + "@@ -2,3 +2,3 @@" + ansiReset,
+		"-  `name` int":     ansiBrightRed + "-  `name` int" + ansiReset,
+		"+  `name` bigint":  ansiBrightGreen + "+  `name` bigint" + ansiReset,
+		"   PRIMARY KEY ()": "   PRIMARY KEY ()",
+	}
+	for input, expected := range cases {
+		if actual := colorizeDiffLine(input); actual != expected {
+			t.Errorf("colorizeDiffLine(%q): expected %q, found %q", input, expected, actual)
+		}
+	}
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"strings"
+	"path"
 	"time"
 
-	"github.com/pmezard/go-difflib/difflib"
 	log "github.com/sirupsen/logrus"
 	"github.com/skeema/tengo"
 )
@@ -78,20 +79,31 @@ func (tgm TargetGroupMap) AddInstanceError(instance *tengo.Instance, dir *Dir, e
 // true, any file with an invalid CREATE TABLE will cause a single instanceless
 // error Target to be used for the directory.
 //
+// Once ctx is canceled, no further operations are performed on database
+// instances. Each remaining dir that defines a host+schema is instead recorded
+// as an instanceless error Target, so that callers can track it as not having
+// been processed.
+//
 // The return values indicate the count of dirs (this dir + all subdirs) that
 // did or did not (respectively) define a host+schema for at least one
 // environment.
-func generateTargetsForDir(dir *Dir, targetsByInstance TargetGroupMap, firstOnly, fatalSQLFileErrors bool) (skeemaDirs, otherDirs int) {
+func generateTargetsForDir(ctx context.Context, dir *Dir, targetsByInstance TargetGroupMap, firstOnly, fatalSQLFileErrors bool) (skeemaDirs, otherDirs int) {
 	// Generate targets if this dir's .skeema file defines a schema (for current
 	// environment section), and the dir's config hierarchy defines a host
 	// somewhere (here, or a parent dir)
-	if dir.Config.Changed("host") && dir.HasSchema() {
+	if dir.Config.Changed("host") && dir.HasSchema() && ctx.Err() != nil {
+		targetsByInstance.AddDirError(dir, fmt.Errorf("Not processed: %s", ctx.Err()))
+		skeemaDirs++
+	} else if dir.Config.Changed("host") && dir.HasSchema() {
 		var instances []*tengo.Instance
 		var instancesErr error
 
 		if firstOnly {
 			var onlyInstance *tengo.Instance
-			onlyInstance, instancesErr = dir.FirstInstance()
+			instancesErr = callWithContext(ctx, func() (err error) {
+				onlyInstance, err = dir.FirstInstance()
+				return err
+			})
 			if onlyInstance == nil && instancesErr == nil {
 				instancesErr = fmt.Errorf("No instance defined for %s", dir)
 			}
@@ -104,7 +116,13 @@ func generateTargetsForDir(dir *Dir, targetsByInstance TargetGroupMap, firstOnly
 			rawInstances, instancesErr = dir.Instances()
 			// dir.Instances doesn't pre-check for connectivity problems, so do that now
 			for _, inst := range rawInstances {
-				if ok, err := inst.CanConnect(); !ok {
+				inst := inst // may still be in use by an abandoned call after the loop advances
+				err := callWithContext(ctx, func() error {
+					_, err := inst.CanConnect()
+					return err
+				})
+				if err != nil {
+					log.WithFields(log.Fields{"dir": dir.Path, "instance": inst.String()}).Debugf("Unable to connect to %s: %s", inst, err)
 					targetsByInstance.AddInstanceError(inst, dir, err)
 				} else {
 					instances = append(instances, inst)
@@ -122,7 +140,7 @@ func generateTargetsForDir(dir *Dir, targetsByInstance TargetGroupMap, firstOnly
 		// Targets.
 		var template Target
 		if len(instances) > 0 {
-			template = dir.TargetTemplate(instances[0])
+			template = dir.TargetTemplate(ctx, instances[0])
 
 			if template.Err == nil && fatalSQLFileErrors && len(template.SQLFileErrors) > 0 {
 				for _, sf := range template.SQLFileErrors {
@@ -141,12 +159,21 @@ func generateTargetsForDir(dir *Dir, targetsByInstance TargetGroupMap, firstOnly
 		}
 
 		for _, inst := range instances {
-			schemaNames, err := dir.SchemaNames(inst)
+			inst := inst // may still be in use by an abandoned call after the loop advances
+			var schemaNames []string
+			var schemasByName map[string]*tengo.Schema
+			err := callWithContext(ctx, func() (err error) {
+				schemaNames, err = dir.SchemaNames(inst)
+				return err
+			})
 			if err != nil {
 				targetsByInstance.AddInstanceError(inst, dir, err)
 				continue
 			}
-			schemasByName, err := inst.SchemasByName()
+			err = callWithContext(ctx, func() (err error) {
+				schemasByName, err = inst.SchemasByName()
+				return err
+			})
 			if err != nil {
 				targetsByInstance.AddInstanceError(inst, dir, err)
 				continue
@@ -170,12 +197,12 @@ func generateTargetsForDir(dir *Dir, targetsByInstance TargetGroupMap, firstOnly
 		skeemaDirs++
 	} else if !dir.Config.Changed("host") && dir.HasSchema() {
 		// If we have a schema defined but no host, display a warning
-		log.Warnf("Skipping %s: no host defined for environment \"%s\"\n", dir, dir.section)
+		log.WithField("dir", dir.Path).Warnf("Skipping %s: no host defined for environment \"%s\"\n", dir, dir.section)
 		skeemaDirs++ // still counts as a skeema-relevant dir though
 	} else if f, err := dir.OptionFile(); err == nil && f.SomeSectionHasOption("schema") {
 		// If we don't have a schema defined, but we would if some other environment
 		// had been selected, display a warning
-		log.Warnf("Skipping %s: no schema defined for environment \"%s\"\n", dir, dir.section)
+		log.WithField("dir", dir.Path).Warnf("Skipping %s: no schema defined for environment \"%s\"\n", dir, dir.section)
 		skeemaDirs++ // still counts as a skeema-relevant dir though
 	} else {
 		otherDirs++ // no combination of host+schema defined here, for any environment
@@ -196,7 +223,7 @@ func generateTargetsForDir(dir *Dir, targetsByInstance TargetGroupMap, firstOnly
 			// Recurse into the subdir, halting early if we've encountered too many
 			// irrelevant subdirs, possibly indicating that skeema was invoked in the
 			// wrong directory tree
-			skeemaSubdirs, otherSubdirs := generateTargetsForDir(subdir, targetsByInstance, firstOnly, fatalSQLFileErrors)
+			skeemaSubdirs, otherSubdirs := generateTargetsForDir(ctx, subdir, targetsByInstance, firstOnly, fatalSQLFileErrors)
 			skeemaDirs += skeemaSubdirs
 			otherDirs += otherSubdirs
 			if otherDirs >= MaxNonSkeemaDirs && skeemaDirs == 0 {
@@ -207,18 +234,32 @@ func generateTargetsForDir(dir *Dir, targetsByInstance TargetGroupMap, firstOnly
 	return
 }
 
+// Logger returns a log entry with fields identifying the target's dir, as well
+// as its instance and schema if known. This is used to attach structured
+// fields to log messages pertaining to the target.
+func (t *Target) Logger() *log.Entry {
+	fields := log.Fields{"dir": t.Dir.Path}
+	if t.Instance != nil {
+		fields["instance"] = t.Instance.String()
+	}
+	if t.SchemaFromDir != nil {
+		fields["schema"] = t.SchemaFromDir.Name
+	}
+	return log.WithFields(fields)
+}
+
 // verifyDiff verifies the result of all AlterTable values found in
 // diff.TableDiffs, confirming that applying the corresponding ALTER would
 // bring a table from the version in SchemaFromInstance to the version in
-// SchemaFromDir.
-func (t *Target) verifyDiff(diff *tengo.SchemaDiff) (err error) {
+// SchemaFromDir. If ctx is canceled, verifyDiff returns early with an error.
+func (t *Target) verifyDiff(ctx context.Context, diff *tengo.SchemaDiff) (err error) {
 	// Populate the temp schema with a copy of the tables from SchemaFromInstance,
 	// the "before" state of the tables
 	tempSchemaName := t.Dir.Config.Get("temp-schema")
 
 	// TODO: want to skip binlogging for all temp schema actions, if super priv available
 	var tx *sql.Tx
-	if tx, err = t.lockTempSchema(30 * time.Second); err != nil {
+	if tx, err = t.lockTempSchema(ctx, 30*time.Second); err != nil {
 		return fmt.Errorf("verifyDiff: %s", err)
 	}
 	defer func() {
@@ -228,9 +269,15 @@ func (t *Target) verifyDiff(diff *tengo.SchemaDiff) (err error) {
 		}
 	}()
 
-	tempSchema, err := t.Instance.Schema(tempSchemaName)
+	var tempSchema *tengo.Schema
+	err = callWithContext(ctx, func() (err error) {
+		tempSchema, err = t.Instance.Schema(tempSchemaName)
+		return err
+	})
 	if err != nil {
 		return err
+	} else if err = ctx.Err(); err != nil {
+		return fmt.Errorf("verifyDiff: %s", err)
 	}
 	if tempSchema != nil {
 		// Attempt to drop any tables already present in tempSchema, but fail if
@@ -269,13 +316,19 @@ func (t *Target) verifyDiff(diff *tengo.SchemaDiff) (err error) {
 		if stmt == "" {
 			continue
 		}
-		if _, err = db.Exec(stmt); err != nil {
+		if _, err = db.ExecContext(ctx, stmt); err != nil {
 			return err
 		}
 		tableNameToDDL[alter.Table.Name] = stmt
 	}
-	postAlterTables, err := tempSchema.TablesByName()
+	var postAlterTables map[string]*tengo.Table
+	err = callWithContext(ctx, func() (err error) {
+		postAlterTables, err = tempSchema.TablesByName()
+		return err
+	})
 	if err != nil {
+		// If canceled, introspection may still be in progress in the background, so
+		// the temporary schema is left in place for the next run to clean up
 		return err
 	}
 	expectTables, _ := t.SchemaFromDir.TablesByName() // can ignore error since we know table list already cached
@@ -325,24 +378,45 @@ func (t *Target) logUnsupportedTableDiff(name string) {
 		return
 	}
 
-	diff := difflib.UnifiedDiff{
-		A:        difflib.SplitLines(expectedCreate),
-		B:        difflib.SplitLines(actualCreate),
-		FromFile: "Skeema-expected",
-		ToFile:   "MySQL-actual",
-		Context:  0,
-	}
-	diffText, err := difflib.GetUnifiedDiffString(diff)
+	lines, err := CreateStatementDiff(expectedCreate, actualCreate, "Skeema-expected", "MySQL-actual", 0)
 	if err == nil {
-		for _, line := range strings.Split(diffText, "\n") {
-			if len(line) > 0 {
-				log.Debug(line)
-			}
+		for _, line := range lines {
+			log.Debug(line)
+		}
+	}
+}
+
+// tableDiffComment returns a unified diff between the instance's and the
+// filesystem's CREATE TABLE for the named table. Each line is formatted as a
+// SQL comment, and optionally colorized for terminal output. The returned
+// string ends in a newline, unless it is empty due to either version of the
+// table not being available.
+func (t *Target) tableDiffComment(name string, colorize bool) string {
+	instTable, err := t.SchemaFromInstance.Table(name)
+	if err != nil || instTable == nil {
+		return ""
+	}
+	dirTable, err := t.SchemaFromDir.Table(name)
+	if err != nil || dirTable == nil {
+		return ""
+	}
+	fromLabel := fmt.Sprintf("%s %s.%s", t.Instance, t.SchemaFromDir.Name, name)
+	toLabel := path.Join(t.Dir.Path, fmt.Sprintf("%s.sql", name))
+	lines, err := CreateStatementDiff(instTable.CreateStatement(), dirTable.CreateStatement(), fromLabel, toLabel, 3)
+	if err != nil || len(lines) == 0 {
+		return ""
+	}
+	var b bytes.Buffer
+	for _, line := range lines {
+		if colorize {
+			line = colorizeDiffLine(line)
 		}
+		fmt.Fprintf(&b, "-- %s\n", line)
 	}
+	return b.String()
 }
 
-func (t *Target) lockTempSchema(maxWait time.Duration) (*sql.Tx, error) {
+func (t *Target) lockTempSchema(ctx context.Context, maxWait time.Duration) (*sql.Tx, error) {
 	db, err := t.Instance.Connect("", "")
 	if err != nil {
 		return nil, err
@@ -359,9 +433,12 @@ func (t *Target) lockTempSchema(maxWait time.Duration) (*sql.Tx, error) {
 	for time.Since(start) < maxWait {
 		// Only using a timeout of 1 sec on each query to avoid potential issues with
 		// query killers, spurious slow query logging, etc
-		err := tx.QueryRow("SELECT GET_LOCK(?, 1)", lockName).Scan(&getLockResult)
+		err := tx.QueryRowContext(ctx, "SELECT GET_LOCK(?, 1)", lockName).Scan(&getLockResult)
 		if err == nil && getLockResult == 1 {
 			return tx, nil
+		} else if ctxErr := ctx.Err(); ctxErr != nil {
+			tx.Rollback()
+			return nil, ctxErr
 		}
 	}
 	return nil, errors.New("Unable to acquire lock")
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTLSOptionsDriverParam(t *testing.T) {
+	assertParam := func(opts TLSOptions, expectedPrefix string) {
+		param, err := opts.DriverParam()
+		if err != nil {
+			t.Errorf("Unexpected error from %+v: %s", opts, err)
+		} else if !strings.HasPrefix(param, expectedPrefix) || (expectedPrefix == "" && param != "") {
+			t.Errorf("Expected %+v to return param with prefix %q, instead found %q", opts, expectedPrefix, param)
+		}
+	}
+	assertParam(TLSOptions{}, "")
+	assertParam(TLSOptions{Mode: "PREFERRED"}, "")
+	assertParam(TLSOptions{Mode: "DISABLED", CA: "/does/not/exist"}, "false")
+	assertParam(TLSOptions{Mode: "REQUIRED"}, "skeema_")
+
+	expectError := []TLSOptions{
+		{Mode: "VERIFY_CA"},
+		{Mode: "VERIFY_IDENTITY"},
+		{Mode: "BOGUS"},
+		{Mode: "REQUIRED", Cert: "/tmp/cert.pem"},
+		{Mode: "PREFERRED", CA: "/tmp/ca.pem"},
+		{Mode: "PREFERRED", Cert: "/tmp/cert.pem", Key: "/tmp/key.pem"},
+		{CA: "/does/not/exist"},
+	}
+	for _, opts := range expectError {
+		if _, err := opts.DriverParam(); err == nil {
+			t.Errorf("Expected error from %+v, but err was nil", opts)
+		}
+	}
+
+	if mode := (TLSOptions{CA: "/tmp/ca.pem"}).EffectiveMode(); mode != "VERIFY_CA" {
+		t.Errorf("Expected ssl-ca alone to imply VERIFY_CA, instead found %s", mode)
+	}
+	if mode := (TLSOptions{Cert: "/tmp/cert.pem", Key: "/tmp/key.pem"}).EffectiveMode(); mode != "REQUIRED" {
+		t.Errorf("Expected ssl-cert and ssl-key to imply REQUIRED, instead found %s", mode)
+	}
+}
+
+func TestInstanceDefaultParamsTLS(t *testing.T) {
+	getDir := func(values map[string]string) *Dir {
+		return &Dir{
+			Path:    "/tmp/dummydir",
+			Config:  getGlobalConfig(values), // see dir_test.go
+			section: "production",
+		}
+	}
+
+	params, err := getDir(map[string]string{"ssl-mode": "required"}).InstanceDefaultParams()
+	if err != nil {
+		t.Errorf("Unexpected error from InstanceDefaultParams: %s", err)
+	} else if !strings.Contains(params, "tls=skeema_") {
+		t.Errorf("Expected params to contain custom tls config name, instead found %s", params)
+	}
+
+	params, err = getDir(map[string]string{"ssl-mode": "disabled"}).InstanceDefaultParams()
+	if err != nil {
+		t.Errorf("Unexpected error from InstanceDefaultParams: %s", err)
+	} else if !strings.Contains(params, "tls=false") {
+		t.Errorf("Expected params to contain tls=false, instead found %s", params)
+	}
+
+	if _, err := getDir(map[string]string{"ssl-mode": "required", "connect-options": "tls=true"}).InstanceDefaultParams(); err == nil {
+		t.Error("Expected error from combining ssl-mode with tls in connect-options, but err was nil")
+	}
+	if _, err := getDir(map[string]string{"ssl-mode": "sometimes"}).InstanceDefaultParams(); err == nil {
+		t.Error("Expected error from invalid ssl-mode, but err was nil")
+	}
+}